@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/criston04/TaxyTac/backend/internal/dispatch"
+	"github.com/criston04/TaxyTac/backend/internal/ingest"
 	"github.com/criston04/TaxyTac/backend/internal/server"
 	"github.com/sirupsen/logrus"
 )
@@ -24,13 +29,79 @@ func main() {
 	port := getEnv("PORT", "8080")
 	dbURL := getEnv("DATABASE_URL", "postgres://postgres:postgres@db:5432/taxytac?sslmode=disable")
 	redisURL := getEnv("REDIS_URL", "redis:6379")
-	jwtSecret := getEnv("JWT_SECRET", "devsecret")
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		// Un secreto conocido permitiría a cualquiera firmar tokens válidos
+		if os.Getenv("GIN_MODE") == "release" {
+			log.Fatal("JWT_SECRET is required when GIN_MODE=release")
+		}
+		log.Error("JWT_SECRET is not set, using an insecure development secret")
+		jwtSecret = "devsecret"
+	}
+	accessTTL, err := time.ParseDuration(getEnv("ACCESS_TOKEN_TTL", "15m"))
+	if err != nil {
+		log.Fatalf("Invalid ACCESS_TOKEN_TTL: %v", err)
+	}
+	refreshTTL, err := time.ParseDuration(getEnv("REFRESH_TOKEN_TTL", "720h"))
+	if err != nil {
+		log.Fatalf("Invalid REFRESH_TOKEN_TTL: %v", err)
+	}
+
+	locationFilter, err := locationFilterConfig()
+	if err != nil {
+		log.Fatalf("Invalid location filter: %v", err)
+	}
+
+	nearbySearch, err := nearbySearchConfig()
+	if err != nil {
+		log.Fatalf("Invalid nearby search config: %v", err)
+	}
+
+	dispatchCfg, err := dispatchConfig()
+	if err != nil {
+		log.Fatalf("Invalid dispatch config: %v", err)
+	}
 
 	cfg := server.Config{
-		Port:      port,
-		Database:  dbURL,
-		Redis:     redisURL,
-		JWTSecret: jwtSecret,
+		Port:                 port,
+		Database:             dbURL,
+		Redis:                redisURL,
+		JWTSecret:            jwtSecret,
+		JWTPrivateKeyFile:    os.Getenv("JWT_PRIVATE_KEY_FILE"),
+		AccessTokenTTL:       accessTTL,
+		RefreshTokenTTL:      refreshTTL,
+		SMSSender:            getEnv("SMS_SENDER", "log"),
+		SMSOutboxFile:        os.Getenv("SMS_OUTBOX_FILE"),
+		EmailSender:          getEnv("EMAIL_SENDER", "log"),
+		AppBaseURL:           os.Getenv("APP_BASE_URL"),
+		RequireVerifiedEmail: getEnv("REQUIRE_VERIFIED_EMAIL", "false") == "true",
+		AllowedOrigins:       splitList(os.Getenv("WS_ALLOWED_ORIGINS")),
+		LocationFilter:       locationFilter,
+		NearbySearch:         nearbySearch,
+		MQTTBroker:           os.Getenv("MQTT_BROKER_URL"),
+		MQTTClientID:         os.Getenv("MQTT_CLIENT_ID"),
+		MQTTJWTSecret:        os.Getenv("MQTT_JWT_SECRET"),
+		Dispatch:             dispatchCfg,
+	}
+
+	// Subcomando: taxytac migrate <up|down|status|force>
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := migrateCommand(ctx, dbURL, log, os.Args[2:])
+		if errors.Is(err, errMigrateUsage) {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			os.Exit(2)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	// Aplicar migraciones pendientes antes de aceptar tráfico
+	if getEnv("MIGRATE_ON_START", "true") == "true" {
+		if err := runMigrations(ctx, dbURL, log); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
 	}
 
 	log.WithFields(logrus.Fields{
@@ -62,9 +133,13 @@ func main() {
 	sig := <-sigChan
 	log.Infof("Received signal: %v. Shutting down gracefully...", sig)
 
-	// Graceful shutdown
+	// Graceful shutdown: dejar de aceptar tráfico y escribir las ubicaciones pendientes
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.WithError(err).Warn("Shutdown did not complete cleanly")
+	}
 	cancel()
-	time.Sleep(2 * time.Second)
 	log.Info("Server stopped")
 }
 
@@ -74,3 +149,92 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// splitList separa una lista por comas ignorando espacios y vacíos
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// locationFilterConfig lee los límites del filtro de ubicaciones
+func locationFilterConfig() (ingest.FilterConfig, error) {
+	cfg := ingest.DefaultFilterConfig()
+
+	maxSpeed, err := strconv.ParseFloat(getEnv("LOCATION_MAX_SPEED_KMH", "120"), 64)
+	if err != nil {
+		return cfg, fmt.Errorf("LOCATION_MAX_SPEED_KMH: %w", err)
+	}
+	cfg.MaxSpeedMps = maxSpeed / 3.6
+
+	if cfg.MaxClockSkew, err = time.ParseDuration(getEnv("LOCATION_MAX_CLOCK_SKEW", "30s")); err != nil {
+		return cfg, fmt.Errorf("LOCATION_MAX_CLOCK_SKEW: %w", err)
+	}
+	if cfg.MaxAge, err = time.ParseDuration(getEnv("LOCATION_MAX_AGE", "10m")); err != nil {
+		return cfg, fmt.Errorf("LOCATION_MAX_AGE: %w", err)
+	}
+	if cfg.MaxBufferedAge, err = time.ParseDuration(getEnv("LOCATION_MAX_BUFFERED_AGE", "6h")); err != nil {
+		return cfg, fmt.Errorf("LOCATION_MAX_BUFFERED_AGE: %w", err)
+	}
+	if cfg.Bounds, err = ingest.ParseBBox(os.Getenv("SERVICE_AREA_BBOX")); err != nil {
+		return cfg, fmt.Errorf("SERVICE_AREA_BBOX: %w", err)
+	}
+	return cfg, nil
+}
+
+// nearbySearchConfig lee el radio y el límite de la búsqueda de drivers cercanos
+func nearbySearchConfig() (server.NearbySearch, error) {
+	cfg := server.DefaultNearbySearch()
+
+	var err error
+	if cfg.DefaultRadiusM, err = strconv.ParseFloat(getEnv("NEARBY_DEFAULT_RADIUS_M", "1000"), 64); err != nil {
+		return cfg, fmt.Errorf("NEARBY_DEFAULT_RADIUS_M: %w", err)
+	}
+	if cfg.MaxRadiusM, err = strconv.ParseFloat(getEnv("NEARBY_MAX_RADIUS_M", "5000"), 64); err != nil {
+		return cfg, fmt.Errorf("NEARBY_MAX_RADIUS_M: %w", err)
+	}
+	if cfg.MinDrivers, err = strconv.Atoi(getEnv("NEARBY_MIN_DRIVERS", "3")); err != nil {
+		return cfg, fmt.Errorf("NEARBY_MIN_DRIVERS: %w", err)
+	}
+	if cfg.DefaultLimit, err = strconv.Atoi(getEnv("NEARBY_DEFAULT_LIMIT", "20")); err != nil {
+		return cfg, fmt.Errorf("NEARBY_DEFAULT_LIMIT: %w", err)
+	}
+	if cfg.MaxLimit, err = strconv.Atoi(getEnv("NEARBY_MAX_LIMIT", "50")); err != nil {
+		return cfg, fmt.Errorf("NEARBY_MAX_LIMIT: %w", err)
+	}
+	return cfg, nil
+}
+
+// dispatchConfig lee cómo se ofrecen los viajes a los drivers
+func dispatchConfig() (dispatch.Config, error) {
+	cfg := dispatch.DefaultConfig()
+
+	switch mode := dispatch.Mode(getEnv("DISPATCH_MODE", string(cfg.Mode))); mode {
+	case dispatch.ModeOff, dispatch.ModeSequential, dispatch.ModeParallel, dispatch.ModeBatch:
+		cfg.Mode = mode
+	default:
+		return cfg, fmt.Errorf("DISPATCH_MODE: unknown mode %q", mode)
+	}
+
+	var err error
+	if cfg.OfferTimeout, err = time.ParseDuration(getEnv("DISPATCH_OFFER_TIMEOUT", "15s")); err != nil {
+		return cfg, fmt.Errorf("DISPATCH_OFFER_TIMEOUT: %w", err)
+	}
+	if cfg.ParallelOffers, err = strconv.Atoi(getEnv("DISPATCH_PARALLEL_OFFERS", "3")); err != nil {
+		return cfg, fmt.Errorf("DISPATCH_PARALLEL_OFFERS: %w", err)
+	}
+	if cfg.MaxOffers, err = strconv.Atoi(getEnv("DISPATCH_MAX_OFFERS", "10")); err != nil {
+		return cfg, fmt.Errorf("DISPATCH_MAX_OFFERS: %w", err)
+	}
+	if cfg.RadiusM, err = strconv.ParseFloat(getEnv("DISPATCH_RADIUS_M", "3000"), 64); err != nil {
+		return cfg, fmt.Errorf("DISPATCH_RADIUS_M: %w", err)
+	}
+	if cfg.BatchWindow, err = time.ParseDuration(getEnv("DISPATCH_BATCH_WINDOW", "2s")); err != nil {
+		return cfg, fmt.Errorf("DISPATCH_BATCH_WINDOW: %w", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/criston04/TaxyTac/backend/internal/migrate"
+	"github.com/criston04/TaxyTac/backend/migrations"
+	"github.com/sirupsen/logrus"
+)
+
+const migrateUsage = `Uso: taxytac migrate <comando>
+
+Comandos:
+  up          Aplica todas las migraciones pendientes
+  down [N]    Revierte las últimas N migraciones (por defecto 1)
+  status      Muestra el estado de cada migración
+  force V     Marca como aplicadas las migraciones hasta V sin ejecutarlas`
+
+var errMigrateUsage = errors.New("invalid migrate command")
+
+// runMigrations aplica las migraciones pendientes (usado al arrancar el servidor)
+func runMigrations(ctx context.Context, dbURL string, log *logrus.Logger) error {
+	runner, err := migrate.NewRunner(ctx, dbURL, migrations.FS, log)
+	if err != nil {
+		return err
+	}
+	defer runner.Close(ctx)
+
+	applied, err := runner.Up(ctx)
+	if err != nil {
+		return err
+	}
+	log.WithField("applied", applied).Info("Database schema up to date")
+	return nil
+}
+
+// migrateCommand implementa el subcomando `migrate`
+func migrateCommand(ctx context.Context, dbURL string, log *logrus.Logger, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+	switch args[0] {
+	case "up", "down", "status", "force":
+	default:
+		return errMigrateUsage
+	}
+
+	runner, err := migrate.NewRunner(ctx, dbURL, migrations.FS, log)
+	if err != nil {
+		return err
+	}
+	defer runner.Close(ctx)
+
+	switch args[0] {
+	case "up":
+		applied, err := runner.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migration(s) applied\n", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %q", args[1])
+			}
+		}
+		reverted, err := runner.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migration(s) reverted\n", reverted)
+
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, st := range statuses {
+			appliedAt := "-"
+			if st.AppliedAt != nil {
+				appliedAt = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", st.Version, st.Name, st.State, appliedAt)
+		}
+		return w.Flush()
+
+	case "force":
+		if len(args) < 2 {
+			return fmt.Errorf("force requires a version")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version: %q", args[1])
+		}
+		return runner.Force(ctx, version)
+	}
+
+	return nil
+}
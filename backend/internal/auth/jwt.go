@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	issuer = "taxytac"
+	// audience distingue los access tokens de la API de otros JWT firmados
+	// por el backend
+	audience = "taxytac-api"
+)
+
+// Roles de usuario. "passenger" y "rider" son equivalentes (pasajero).
+const (
+	RoleRider     = "rider"
+	RolePassenger = "passenger"
+	RoleDriver    = "driver"
+	RoleAdmin     = "admin"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims son los datos que viajan dentro del access token
+type Claims struct {
+	Email string `json:"email,omitempty"`
+	Role  string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// UserID devuelve el id del usuario dueño del token
+func (c *Claims) UserID() string {
+	return c.Subject
+}
+
+// IsAdmin indica si el token pertenece a un administrador
+func (c *Claims) IsAdmin() bool {
+	return c.Role == RoleAdmin
+}
+
+// TokenManager firma y verifica access tokens (HS256 o RS256)
+type TokenManager struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	ttl       time.Duration
+}
+
+// NewHS256 crea un TokenManager que firma con un secreto compartido
+func NewHS256(secret string, ttl time.Duration) (*TokenManager, error) {
+	if secret == "" {
+		return nil, errors.New("jwt secret is empty")
+	}
+	return &TokenManager{
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+		ttl:       ttl,
+	}, nil
+}
+
+// NewRS256 crea un TokenManager a partir de una llave privada RSA en formato PEM
+func NewRS256(privateKeyPEM []byte, ttl time.Duration) (*TokenManager, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parse rsa private key: %w", err)
+	}
+	return &TokenManager{
+		method:    jwt.SigningMethodRS256,
+		signKey:   key,
+		verifyKey: &key.PublicKey,
+		ttl:       ttl,
+	}, nil
+}
+
+// PublicKey devuelve la llave pública RSA (nil si se usa HS256)
+func (m *TokenManager) PublicKey() *rsa.PublicKey {
+	pub, _ := m.verifyKey.(*rsa.PublicKey)
+	return pub
+}
+
+// TTL devuelve la duración de los access tokens emitidos
+func (m *TokenManager) TTL() time.Duration {
+	return m.ttl
+}
+
+// Issue genera un access token firmado para el usuario
+func (m *TokenManager) Issue(userID, email, role string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(m.ttl)
+
+	claims := Claims{
+		Email: email,
+		Role:  role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// Verify valida firma, algoritmo, emisor, audiencia y expiración del token
+func (m *TokenManager) Verify(token string) (*Claims, error) {
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims,
+		func(t *jwt.Token) (interface{}, error) { return m.verifyKey, nil },
+		jwt.WithValidMethods([]string{m.method.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !parsed.Valid {
+		return nil, ErrInvalidToken
+	}
+	if claims.Subject == "" || claims.Role == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+func newTestRSAKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// validClaims son los claims que emitiría Issue; cada caso cambia uno
+func validClaims() Claims {
+	now := time.Now()
+	return Claims{
+		Role: RoleDriver,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			Subject:   "user-1",
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, claims Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestTokenManagerRoundTrip(t *testing.T) {
+	hs, err := NewHS256(testSecret, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, keyPEM := newTestRSAKey(t)
+	rs, err := NewRS256(keyPEM, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, m := range map[string]*TokenManager{"HS256": hs, "RS256": rs} {
+		t.Run(name, func(t *testing.T) {
+			token, expiresAt, err := m.Issue("user-1", "juan@example.com", RoleDriver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := time.Until(expiresAt); d <= 0 || d > time.Minute {
+				t.Errorf("expires in %v, want within the TTL", d)
+			}
+
+			claims, err := m.Verify(token)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if claims.UserID() != "user-1" || claims.Email != "juan@example.com" || claims.Role != RoleDriver {
+				t.Errorf("claims = %+v", claims)
+			}
+			if claims.ID == "" {
+				t.Error("token has no jti")
+			}
+		})
+	}
+}
+
+func TestTokenManagerRejects(t *testing.T) {
+	hs, err := NewHS256(testSecret, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, keyPEM := newTestRSAKey(t)
+	rs, err := NewRS256(keyPEM, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _ := newTestRSAKey(t)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: mustMarshalPublic(t, &rsaKey.PublicKey)})
+
+	with := func(change func(*Claims)) Claims {
+		c := validClaims()
+		change(&c)
+		return c
+	}
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name  string
+		m     *TokenManager
+		token string
+	}{
+		{"alg none", hs, sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims())},
+		{"alg none on RS256", rs, sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims())},
+		// HS256 firmado con la llave pública como secreto: el ataque clásico
+		// de confusión de algoritmos contra un verificador RS256
+		{"HS256 signed with the public key", rs, sign(t, jwt.SigningMethodHS256, publicPEM, validClaims())},
+		{"HS384 on HS256", hs, sign(t, jwt.SigningMethodHS384, []byte(testSecret), validClaims())},
+		{"RS256 on HS256", hs, sign(t, jwt.SigningMethodRS256, rsaKey, validClaims())},
+		{"wrong secret", hs, sign(t, jwt.SigningMethodHS256, []byte("other-secret"), validClaims())},
+		{"wrong RSA key", rs, sign(t, jwt.SigningMethodRS256, otherKey, validClaims())},
+		{"expired", hs, sign(t, jwt.SigningMethodHS256, []byte(testSecret), with(func(c *Claims) {
+			c.IssuedAt, c.NotBefore, c.ExpiresAt = jwt.NewNumericDate(past), jwt.NewNumericDate(past), jwt.NewNumericDate(past.Add(time.Minute))
+		}))},
+		{"no expiration", hs, sign(t, jwt.SigningMethodHS256, []byte(testSecret), with(func(c *Claims) { c.ExpiresAt = nil }))},
+		{"not yet valid", hs, sign(t, jwt.SigningMethodHS256, []byte(testSecret), with(func(c *Claims) {
+			c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		}))},
+		{"wrong issuer", hs, sign(t, jwt.SigningMethodHS256, []byte(testSecret), with(func(c *Claims) { c.Issuer = "someone-else" }))},
+		{"no issuer", hs, sign(t, jwt.SigningMethodHS256, []byte(testSecret), with(func(c *Claims) { c.Issuer = "" }))},
+		{"wrong audience", hs, sign(t, jwt.SigningMethodHS256, []byte(testSecret), with(func(c *Claims) { c.Audience = jwt.ClaimStrings{"taxytac-mqtt"} }))},
+		{"no audience", hs, sign(t, jwt.SigningMethodHS256, []byte(testSecret), with(func(c *Claims) { c.Audience = nil }))},
+		{"no subject", hs, sign(t, jwt.SigningMethodHS256, []byte(testSecret), with(func(c *Claims) { c.Subject = "" }))},
+		{"no role", hs, sign(t, jwt.SigningMethodHS256, []byte(testSecret), with(func(c *Claims) { c.Role = "" }))},
+		{"garbage", hs, "not.a.jwt"},
+		{"empty", hs, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.m.Verify(tt.token)
+			if !errors.Is(err, ErrInvalidToken) || claims != nil {
+				t.Fatalf("Verify = %+v, %v; want ErrInvalidToken", claims, err)
+			}
+		})
+	}
+}
+
+// Un token MQTT, aunque compartiera el secreto, no sirve como access token
+func TestMQTTTokenIsNotAnAccessToken(t *testing.T) {
+	hs, err := NewHS256(testSecret, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mqtt, err := NewMQTTTokens(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := mqtt.Issue("driver-1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hs.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify(mqtt token) = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestNewTokenManagerErrors(t *testing.T) {
+	if _, err := NewHS256("", time.Minute); err == nil {
+		t.Error("NewHS256 accepted an empty secret")
+	}
+	if _, err := NewRS256([]byte("not a pem"), time.Minute); err == nil {
+		t.Error("NewRS256 accepted an invalid key")
+	}
+	if _, err := NewMQTTTokens(""); err == nil {
+		t.Error("NewMQTTTokens accepted an empty secret")
+	}
+}
+
+func mustMarshalPublic(t *testing.T, pub *rsa.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const mqttIssuer = "taxytac-mqtt"
+
+// MQTTClaims son los datos del token con el que un cliente se conecta al
+// broker. El broker exige que Username coincida con el usuario MQTT y su ACL
+// limita a cada usuario a drivers/<username>/#.
+type MQTTClaims struct {
+	Username string `json:"username"`
+	jwt.RegisteredClaims
+}
+
+// MQTTTokens firma los tokens del broker con un secreto propio (HS256), así
+// un token MQTT no sirve como access token de la API ni al revés
+type MQTTTokens struct {
+	secret []byte
+}
+
+// NewMQTTTokens exige el secreto compartido con el autenticador JWT de EMQX
+func NewMQTTTokens(secret string) (*MQTTTokens, error) {
+	if secret == "" {
+		return nil, errors.New("mqtt jwt secret is empty")
+	}
+	return &MQTTTokens{secret: []byte(secret)}, nil
+}
+
+// Issue genera la contraseña MQTT del usuario, válida por ttl
+func (m *MQTTTokens) Issue(username string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	claims := MQTTClaims{
+		Username: username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    mqttIssuer,
+			Subject:   username,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Propósitos de los tokens de un solo uso enviados por correo
+const (
+	PurposePasswordReset = "password_reset"
+	PurposeVerifyEmail   = "verify_email"
+)
+
+const oneTimePrefix = "onetime:"
+
+var ErrOneTimeInvalid = errors.New("one-time token invalid or expired")
+
+// issueOneTimeScript guarda el token nuevo y borra el anterior del mismo
+// usuario y propósito, así sólo vale el último link enviado
+var issueOneTimeScript = redis.NewScript(`
+local prev = redis.call('GET', KEYS[2])
+if prev then
+	redis.call('DEL', ARGV[1] .. prev)
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+redis.call('SET', KEYS[2], ARGV[4], 'PX', ARGV[3])
+return 1
+`)
+
+// OneTimeTokens emite tokens opacos de un solo uso ligados a un usuario y un
+// propósito. Redis sólo guarda el hash, así que una fuga no expone los links.
+type OneTimeTokens struct {
+	rdb *redis.Client
+}
+
+func NewOneTimeTokens(rdb *redis.Client) *OneTimeTokens {
+	return &OneTimeTokens{rdb: rdb}
+}
+
+// Issue genera un token para el usuario que vence en ttl e invalida el que se
+// le había emitido antes para el mismo propósito
+func (t *OneTimeTokens) Issue(ctx context.Context, purpose, userID string, ttl time.Duration) (string, error) {
+	token, err := RandomToken()
+	if err != nil {
+		return "", err
+	}
+	hash := HashToken(token)
+	keys := []string{t.prefix(purpose) + hash, t.prefix(purpose) + "user:" + userID}
+	err = issueOneTimeScript.Run(ctx, t.rdb, keys, t.prefix(purpose), userID, ttl.Milliseconds(), hash).Err()
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Consume valida el token y lo invalida en la misma operación
+func (t *OneTimeTokens) Consume(ctx context.Context, purpose, token string) (string, error) {
+	userID, err := t.rdb.GetDel(ctx, t.prefix(purpose)+HashToken(token)).Result()
+	if err == redis.Nil {
+		return "", ErrOneTimeInvalid
+	}
+	return userID, err
+}
+
+func (t *OneTimeTokens) prefix(purpose string) string {
+	return oneTimePrefix + purpose + ":"
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return mr, rdb
+}
+
+func TestOneTimeTokensConsumeOnce(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	tokens := NewOneTimeTokens(rdb)
+	ctx := context.Background()
+
+	token, err := tokens.Issue(ctx, PurposePasswordReset, "user-1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Otro propósito no acepta el token
+	if _, err := tokens.Consume(ctx, PurposeVerifyEmail, token); !errors.Is(err, ErrOneTimeInvalid) {
+		t.Fatalf("consume with another purpose: err = %v, want ErrOneTimeInvalid", err)
+	}
+
+	userID, err := tokens.Consume(ctx, PurposePasswordReset, token)
+	if err != nil || userID != "user-1" {
+		t.Fatalf("Consume = %q, %v; want user-1", userID, err)
+	}
+	if _, err := tokens.Consume(ctx, PurposePasswordReset, token); !errors.Is(err, ErrOneTimeInvalid) {
+		t.Fatalf("second consume: err = %v, want ErrOneTimeInvalid", err)
+	}
+}
+
+func TestOneTimeTokensIssueInvalidatesPrevious(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	tokens := NewOneTimeTokens(rdb)
+	ctx := context.Background()
+
+	first, err := tokens.Issue(ctx, PurposePasswordReset, "user-1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := tokens.Issue(ctx, PurposePasswordReset, "user-2", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify, err := tokens.Issue(ctx, PurposeVerifyEmail, "user-1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := tokens.Issue(ctx, PurposePasswordReset, "user-1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tokens.Consume(ctx, PurposePasswordReset, first); !errors.Is(err, ErrOneTimeInvalid) {
+		t.Fatalf("earlier reset token: err = %v, want ErrOneTimeInvalid", err)
+	}
+	// Los tokens de otros usuarios y propósitos siguen valiendo
+	for _, tt := range []struct{ purpose, token, user string }{
+		{PurposePasswordReset, second, "user-1"},
+		{PurposePasswordReset, other, "user-2"},
+		{PurposeVerifyEmail, verify, "user-1"},
+	} {
+		if userID, err := tokens.Consume(ctx, tt.purpose, tt.token); err != nil || userID != tt.user {
+			t.Errorf("%s token of %s: Consume = %q, %v", tt.purpose, tt.user, userID, err)
+		}
+	}
+}
+
+func TestOneTimeTokensExpire(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	tokens := NewOneTimeTokens(rdb)
+	ctx := context.Background()
+
+	token, err := tokens.Issue(ctx, PurposeVerifyEmail, "user-1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(2 * time.Minute)
+	if _, err := tokens.Consume(ctx, PurposeVerifyEmail, token); !errors.Is(err, ErrOneTimeInvalid) {
+		t.Fatalf("expired token: err = %v, want ErrOneTimeInvalid", err)
+	}
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	OTPLength         = 6
+	OTPTTL            = 5 * time.Minute
+	OTPResendCooldown = 60 * time.Second
+	OTPMaxAttempts    = 5
+	// OTPMaxFailures códigos errados por teléfono en OTPFailureWindow (sumando
+	// todos los códigos pedidos) bloquean el login por SMS hasta que los más
+	// viejos salen de la ventana
+	OTPMaxFailures   = 10
+	OTPFailureWindow = time.Hour
+
+	otpCodePrefix     = "otp:code:"
+	otpCooldownPrefix = "otp:cooldown:"
+	otpFailuresPrefix = "otp:failures:"
+)
+
+var (
+	ErrOTPCooldown        = errors.New("otp requested too recently")
+	ErrOTPNotFound        = errors.New("otp not found or expired")
+	ErrOTPInvalid         = errors.New("otp invalid")
+	ErrOTPTooManyAttempts = errors.New("otp too many attempts")
+	ErrOTPLocked          = errors.New("otp too many failures for this phone")
+)
+
+// verifyOTPScript cuenta el intento y, si el hash coincide, consume el código.
+// Los fallos se registran en un sorted set por teléfono (score = ms) para
+// limitarlos en una ventana móvil. Devuelve 1 si es válido, 0 si no, -1 si no
+// existe, -2 si se agotaron los intentos del código y -3 si el teléfono está
+// bloqueado.
+var verifyOTPScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', tonumber(ARGV[3]) - tonumber(ARGV[4]))
+if redis.call('ZCARD', KEYS[2]) >= tonumber(ARGV[5]) then
+	redis.call('DEL', KEYS[1])
+	return -3
+end
+local stored = redis.call('HGET', KEYS[1], 'hash')
+if not stored then
+	return -1
+end
+local attempts = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+if attempts > tonumber(ARGV[2]) then
+	redis.call('DEL', KEYS[1])
+	return -2
+end
+if stored == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	return 1
+end
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[6])
+redis.call('PEXPIRE', KEYS[2], ARGV[4])
+return 0
+`)
+
+// OTPStore guarda códigos de un solo uso por teléfono (hasheados) en Redis
+type OTPStore struct {
+	rdb    *redis.Client
+	secret []byte
+	now    func() time.Time
+}
+
+func NewOTPStore(rdb *redis.Client, secret string) *OTPStore {
+	return &OTPStore{rdb: rdb, secret: []byte(secret), now: time.Now}
+}
+
+// Request genera un código nuevo para el teléfono respetando el cooldown de
+// reenvío. Un teléfono bloqueado por fallos no recibe códigos.
+func (s *OTPStore) Request(ctx context.Context, phone string) (string, error) {
+	if s.LockRemaining(ctx, phone) > 0 {
+		return "", ErrOTPLocked
+	}
+
+	ok, err := s.rdb.SetNX(ctx, otpCooldownPrefix+phone, 1, OTPResendCooldown).Result()
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrOTPCooldown
+	}
+
+	code, err := randomDigits(OTPLength)
+	if err != nil {
+		return "", err
+	}
+
+	key := otpCodePrefix + phone
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, "hash", s.hash(phone, code), "attempts", 0)
+	pipe.Expire(ctx, key, OTPTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("store otp: %w", err)
+	}
+	return code, nil
+}
+
+// Cancel descarta el código y el cooldown del teléfono, p. ej. si el SMS no
+// se pudo enviar y el usuario debe poder pedir otro de inmediato
+func (s *OTPStore) Cancel(ctx context.Context, phone string) error {
+	return s.rdb.Del(ctx, otpCodePrefix+phone, otpCooldownPrefix+phone).Err()
+}
+
+// LockRemaining devuelve cuánto falta para que el teléfono salga del bloqueo
+// por fallos (0 si no está bloqueado)
+func (s *OTPStore) LockRemaining(ctx context.Context, phone string) time.Duration {
+	now := s.now()
+	failures, err := s.rdb.ZRangeByScoreWithScores(ctx, otpFailuresPrefix+phone, &redis.ZRangeBy{
+		Min: strconv.FormatInt(now.Add(-OTPFailureWindow).UnixMilli()+1, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil || len(failures) < OTPMaxFailures {
+		return 0
+	}
+	// Se desbloquea cuando sale de la ventana el fallo que deja el resto
+	// por debajo del máximo
+	unlock := time.UnixMilli(int64(failures[len(failures)-OTPMaxFailures].Score)).Add(OTPFailureWindow)
+	return unlock.Sub(now)
+}
+
+// CooldownRemaining devuelve cuánto falta para poder pedir otro código
+func (s *OTPStore) CooldownRemaining(ctx context.Context, phone string) time.Duration {
+	ttl, err := s.rdb.TTL(ctx, otpCooldownPrefix+phone).Result()
+	if err != nil || ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+// Verify comprueba el código; un código válido sólo se puede usar una vez
+func (s *OTPStore) Verify(ctx context.Context, phone, code string) error {
+	// Cada fallo es un miembro distinto del sorted set aunque coincida el ms
+	failureID, err := RandomToken()
+	if err != nil {
+		return err
+	}
+	res, err := verifyOTPScript.Run(ctx, s.rdb,
+		[]string{otpCodePrefix + phone, otpFailuresPrefix + phone},
+		s.hash(phone, code), OTPMaxAttempts,
+		s.now().UnixMilli(), OTPFailureWindow.Milliseconds(), OTPMaxFailures, failureID).Int()
+	if err != nil {
+		return err
+	}
+
+	switch res {
+	case 1:
+		return nil
+	case -1:
+		return ErrOTPNotFound
+	case -2:
+		return ErrOTPTooManyAttempts
+	case -3:
+		return ErrOTPLocked
+	default:
+		return ErrOTPInvalid
+	}
+}
+
+// hash usa HMAC con el secreto del servidor: un código de 6 dígitos con sha256
+// simple se podría recuperar por fuerza bruta si se filtra Redis
+func (s *OTPStore) hash(phone, code string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(phone + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomDigits(n int) (string, error) {
+	max := big.NewInt(10)
+	buf := make([]byte, n)
+	for i := range buf {
+		d, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		buf[i] = byte('0' + d.Int64())
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+const testPhone = "987654321"
+
+// newTestOTPStore usa un reloj que avanza junto con el de miniredis
+func newTestOTPStore(t *testing.T) (*OTPStore, *miniredis.Miniredis, func(time.Duration)) {
+	mr, rdb := newTestRedis(t)
+	store := NewOTPStore(rdb, testSecret)
+	now := time.UnixMilli(1_700_000_000_000)
+	store.now = func() time.Time { return now }
+	advance := func(d time.Duration) {
+		now = now.Add(d)
+		mr.FastForward(d)
+	}
+	return store, mr, advance
+}
+
+// wrongCode es un código distinto de code
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestOTPVerify(t *testing.T) {
+	store, _, _ := newTestOTPStore(t)
+	ctx := context.Background()
+
+	code, err := store.Request(ctx, testPhone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != OTPLength {
+		t.Fatalf("code %q has %d digits, want %d", code, len(code), OTPLength)
+	}
+	if err := store.Verify(ctx, "999999999", code); !errors.Is(err, ErrOTPNotFound) {
+		t.Errorf("other phone: err = %v, want ErrOTPNotFound", err)
+	}
+	if err := store.Verify(ctx, testPhone, wrongCode(code)); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("wrong code: err = %v, want ErrOTPInvalid", err)
+	}
+	if err := store.Verify(ctx, testPhone, code); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := store.Verify(ctx, testPhone, code); !errors.Is(err, ErrOTPNotFound) {
+		t.Errorf("reused code: err = %v, want ErrOTPNotFound", err)
+	}
+}
+
+func TestOTPExpiryAndCooldown(t *testing.T) {
+	store, _, advance := newTestOTPStore(t)
+	ctx := context.Background()
+
+	code, err := store.Request(ctx, testPhone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Request(ctx, testPhone); !errors.Is(err, ErrOTPCooldown) {
+		t.Fatalf("second request: err = %v, want ErrOTPCooldown", err)
+	}
+	if d := store.CooldownRemaining(ctx, testPhone); d <= 0 || d > OTPResendCooldown {
+		t.Errorf("CooldownRemaining = %v", d)
+	}
+
+	advance(OTPTTL)
+	if err := store.Verify(ctx, testPhone, code); !errors.Is(err, ErrOTPNotFound) {
+		t.Errorf("expired code: err = %v, want ErrOTPNotFound", err)
+	}
+	if _, err := store.Request(ctx, testPhone); err != nil {
+		t.Errorf("request after the cooldown: %v", err)
+	}
+}
+
+func TestOTPCancel(t *testing.T) {
+	store, _, _ := newTestOTPStore(t)
+	ctx := context.Background()
+
+	code, err := store.Request(ctx, testPhone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Cancel(ctx, testPhone); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if err := store.Verify(ctx, testPhone, code); !errors.Is(err, ErrOTPNotFound) {
+		t.Errorf("cancelled code: err = %v, want ErrOTPNotFound", err)
+	}
+	if _, err := store.Request(ctx, testPhone); err != nil {
+		t.Errorf("request after Cancel: %v", err)
+	}
+}
+
+func TestOTPMaxAttempts(t *testing.T) {
+	store, _, _ := newTestOTPStore(t)
+	ctx := context.Background()
+
+	code, err := store.Request(ctx, testPhone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < OTPMaxAttempts; i++ {
+		if err := store.Verify(ctx, testPhone, wrongCode(code)); !errors.Is(err, ErrOTPInvalid) {
+			t.Fatalf("attempt %d: err = %v, want ErrOTPInvalid", i+1, err)
+		}
+	}
+	// Agotados los intentos el código se descarta, aunque ahora sea el correcto
+	if err := store.Verify(ctx, testPhone, code); !errors.Is(err, ErrOTPTooManyAttempts) {
+		t.Fatalf("attempt after the limit: err = %v, want ErrOTPTooManyAttempts", err)
+	}
+	if err := store.Verify(ctx, testPhone, code); !errors.Is(err, ErrOTPNotFound) {
+		t.Errorf("discarded code: err = %v, want ErrOTPNotFound", err)
+	}
+}
+
+// Pedir códigos nuevos no reinicia el límite de fallos del teléfono
+func TestOTPFailureLock(t *testing.T) {
+	store, _, advance := newTestOTPStore(t)
+	ctx := context.Background()
+
+	failures := 0
+	for failures < OTPMaxFailures {
+		code, err := store.Request(ctx, testPhone)
+		if err != nil {
+			t.Fatalf("request after %d failures: %v", failures, err)
+		}
+		for i := 0; i < 3 && failures < OTPMaxFailures; i++ {
+			if err := store.Verify(ctx, testPhone, wrongCode(code)); !errors.Is(err, ErrOTPInvalid) {
+				t.Fatalf("failure %d: err = %v, want ErrOTPInvalid", failures+1, err)
+			}
+			failures++
+			advance(time.Minute)
+		}
+		advance(OTPResendCooldown)
+	}
+
+	if _, err := store.Request(ctx, testPhone); !errors.Is(err, ErrOTPLocked) {
+		t.Fatalf("request while locked: err = %v, want ErrOTPLocked", err)
+	}
+	if err := store.Verify(ctx, testPhone, "123456"); !errors.Is(err, ErrOTPLocked) {
+		t.Fatalf("verify while locked: err = %v, want ErrOTPLocked", err)
+	}
+	remaining := store.LockRemaining(ctx, testPhone)
+	if remaining <= 0 || remaining > OTPFailureWindow {
+		t.Fatalf("LockRemaining = %v", remaining)
+	}
+	if store.LockRemaining(ctx, "999999999") != 0 {
+		t.Error("other phone is locked")
+	}
+
+	// Ventana móvil: al salir el fallo más viejo se vuelve a poder intentar,
+	// pero un solo fallo más lo bloquea otra vez
+	advance(remaining)
+	if d := store.LockRemaining(ctx, testPhone); d != 0 {
+		t.Fatalf("LockRemaining after the oldest failure left the window = %v", d)
+	}
+	code, err := store.Request(ctx, testPhone)
+	if err != nil {
+		t.Fatalf("request after the lock: %v", err)
+	}
+	if err := store.Verify(ctx, testPhone, wrongCode(code)); !errors.Is(err, ErrOTPInvalid) {
+		t.Fatalf("failure after the lock: err = %v, want ErrOTPInvalid", err)
+	}
+	if err := store.Verify(ctx, testPhone, code); !errors.Is(err, ErrOTPLocked) {
+		t.Fatalf("verify after a new failure: err = %v, want ErrOTPLocked", err)
+	}
+
+	advance(OTPFailureWindow)
+	code, err = store.Request(ctx, testPhone)
+	if err != nil {
+		t.Fatalf("request after the window: %v", err)
+	}
+	if err := store.Verify(ctx, testPhone, code); err != nil {
+		t.Errorf("verify after the window: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	refreshTokenPrefix  = "refresh:token:"
+	refreshFamilyPrefix = "refresh:family:"
+	refreshUserPrefix   = "refresh:user:"
+)
+
+var (
+	ErrRefreshNotFound = errors.New("refresh token not found")
+	ErrRefreshRevoked  = errors.New("refresh token revoked")
+	ErrRefreshReused   = errors.New("refresh token reused")
+)
+
+// rotateScript marca el token como usado de forma atómica. Si ya estaba usado
+// se considera un robo y se elimina la familia completa.
+var rotateScript = redis.NewScript(`
+local fields = redis.call('HMGET', KEYS[1], 'user_id', 'family', 'used')
+if not fields[1] then
+	return {'missing'}
+end
+local familyKey = ARGV[1] .. fields[2]
+if fields[3] == '1' then
+	redis.call('DEL', familyKey)
+	return {'reused', fields[1], fields[2]}
+end
+if redis.call('EXISTS', familyKey) == 0 then
+	return {'revoked', fields[1], fields[2]}
+end
+redis.call('HSET', KEYS[1], 'used', '1')
+return {'ok', fields[1], fields[2]}
+`)
+
+// RefreshSession identifica la sesión a la que pertenece un refresh token
+type RefreshSession struct {
+	UserID string
+	Family string
+}
+
+// RefreshStore guarda refresh tokens opacos (hasheados) en Redis. Cada login
+// abre una familia; cada rotación emite un token nuevo dentro de la misma
+// familia y revocar la familia invalida todos sus tokens.
+type RefreshStore struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+func NewRefreshStore(rdb *redis.Client, ttl time.Duration) *RefreshStore {
+	return &RefreshStore{rdb: rdb, ttl: ttl}
+}
+
+// RandomToken genera un token opaco aleatorio apto para URLs
+func RandomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken devuelve el sha256 en hex de un token opaco
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create abre una nueva familia de sesión y devuelve su primer refresh token
+func (s *RefreshStore) Create(ctx context.Context, userID string) (string, error) {
+	family := uuid.New().String()
+	userKey := refreshUserPrefix + userID
+
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, refreshFamilyPrefix+family, userID, s.ttl)
+	pipe.SAdd(ctx, userKey, family)
+	pipe.Expire(ctx, userKey, s.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return s.issue(ctx, userID, family)
+}
+
+// Rotate consume el refresh token y emite uno nuevo en la misma familia.
+// Presentar un token ya rotado revoca la familia entera.
+func (s *RefreshStore) Rotate(ctx context.Context, token string) (string, *RefreshSession, error) {
+	res, err := rotateScript.Run(ctx, s.rdb,
+		[]string{refreshTokenPrefix + HashToken(token)}, refreshFamilyPrefix).StringSlice()
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch res[0] {
+	case "missing":
+		return "", nil, ErrRefreshNotFound
+	case "reused":
+		return "", &RefreshSession{UserID: res[1], Family: res[2]}, ErrRefreshReused
+	case "revoked":
+		return "", &RefreshSession{UserID: res[1], Family: res[2]}, ErrRefreshRevoked
+	}
+
+	session := &RefreshSession{UserID: res[1], Family: res[2]}
+	if err := s.rdb.Expire(ctx, refreshFamilyPrefix+session.Family, s.ttl).Err(); err != nil {
+		return "", nil, err
+	}
+
+	next, err := s.issue(ctx, session.UserID, session.Family)
+	if err != nil {
+		return "", nil, err
+	}
+	return next, session, nil
+}
+
+// Revoke cierra la sesión (familia) a la que pertenece el token
+func (s *RefreshStore) Revoke(ctx context.Context, token string) error {
+	family, err := s.rdb.HGet(ctx, refreshTokenPrefix+HashToken(token), "family").Result()
+	if err == redis.Nil {
+		return ErrRefreshNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.RevokeFamily(ctx, family)
+}
+
+// RevokeFamily invalida todos los refresh tokens de una familia
+func (s *RefreshStore) RevokeFamily(ctx context.Context, family string) error {
+	return s.rdb.Del(ctx, refreshFamilyPrefix+family).Err()
+}
+
+// RevokeUser cierra todas las sesiones del usuario (p. ej. tras cambiar la contraseña)
+func (s *RefreshStore) RevokeUser(ctx context.Context, userID string) error {
+	userKey := refreshUserPrefix + userID
+	families, err := s.rdb.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{userKey}
+	for _, family := range families {
+		keys = append(keys, refreshFamilyPrefix+family)
+	}
+	return s.rdb.Del(ctx, keys...).Err()
+}
+
+func (s *RefreshStore) issue(ctx context.Context, userID, family string) (string, error) {
+	token, err := RandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	key := refreshTokenPrefix + HashToken(token)
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", userID, "family", family, "used", "0")
+	pipe.Expire(ctx, key, s.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("store refresh token: %w", err)
+	}
+	return token, nil
+}
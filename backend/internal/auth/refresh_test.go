@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshRotate(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	store := NewRefreshStore(rdb, time.Hour)
+	ctx := context.Background()
+
+	first, err := store.Create(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, session, err := store.Rotate(ctx, first)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if second == first || session.UserID != "user-1" || session.Family == "" {
+		t.Fatalf("Rotate = %q, %+v", second, session)
+	}
+
+	third, next, err := store.Rotate(ctx, second)
+	if err != nil {
+		t.Fatalf("second Rotate: %v", err)
+	}
+	if next.Family != session.Family {
+		t.Errorf("rotation changed the family: %s -> %s", session.Family, next.Family)
+	}
+
+	if _, _, err := store.Rotate(ctx, "unknown"); !errors.Is(err, ErrRefreshNotFound) {
+		t.Errorf("unknown token: err = %v, want ErrRefreshNotFound", err)
+	}
+
+	// Otra sesión del mismo usuario no se ve afectada por lo que sigue
+	other, err := store.Create(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reusar un token ya rotado revoca la familia entera
+	_, reused, err := store.Rotate(ctx, first)
+	if !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("reused token: err = %v, want ErrRefreshReused", err)
+	}
+	if reused.UserID != "user-1" || reused.Family != session.Family {
+		t.Errorf("reused session = %+v, want family %s", reused, session.Family)
+	}
+	if _, _, err := store.Rotate(ctx, third); !errors.Is(err, ErrRefreshRevoked) {
+		t.Errorf("latest token after reuse: err = %v, want ErrRefreshRevoked", err)
+	}
+	if _, _, err := store.Rotate(ctx, other); err != nil {
+		t.Errorf("other session after reuse: %v", err)
+	}
+}
+
+func TestRefreshRotateConcurrent(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	store := NewRefreshStore(rdb, time.Hour)
+	ctx := context.Background()
+
+	token, err := store.Create(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const clients = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var rotated []string
+	var reused int
+	start := make(chan struct{})
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			next, _, err := store.Rotate(ctx, token)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				rotated = append(rotated, next)
+			case errors.Is(err, ErrRefreshReused):
+				reused++
+			default:
+				t.Errorf("Rotate: %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	// Sólo uno rota; el resto cuenta como reuso y revoca la familia, así que
+	// ni el token que obtuvo el ganador sirve
+	if len(rotated) != 1 || reused != clients-1 {
+		t.Fatalf("%d rotations and %d reuses, want 1 and %d", len(rotated), reused, clients-1)
+	}
+	if _, _, err := store.Rotate(ctx, rotated[0]); !errors.Is(err, ErrRefreshRevoked) {
+		t.Errorf("winner's token: err = %v, want ErrRefreshRevoked", err)
+	}
+}
+
+func TestRefreshLogout(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	store := NewRefreshStore(rdb, time.Hour)
+	ctx := context.Background()
+
+	token, err := store.Create(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := store.Create(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Revoke(ctx, token); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, _, err := store.Rotate(ctx, token); !errors.Is(err, ErrRefreshRevoked) {
+		t.Errorf("after logout: err = %v, want ErrRefreshRevoked", err)
+	}
+	if err := store.Revoke(ctx, "unknown"); !errors.Is(err, ErrRefreshNotFound) {
+		t.Errorf("Revoke(unknown) = %v, want ErrRefreshNotFound", err)
+	}
+	if _, _, err := store.Rotate(ctx, other); err != nil {
+		t.Errorf("other session after logout: %v", err)
+	}
+}
+
+func TestRefreshRevokeUser(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	store := NewRefreshStore(rdb, time.Hour)
+	ctx := context.Background()
+
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		token, err := store.Create(ctx, "user-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+	// Una sesión ya rotada también se cierra
+	rotated, _, err := store.Rotate(ctx, tokens[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens[0] = rotated
+	otherUser, err := store.Create(ctx, "user-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.RevokeUser(ctx, "user-1"); err != nil {
+		t.Fatalf("RevokeUser: %v", err)
+	}
+	for i, token := range tokens {
+		if _, _, err := store.Rotate(ctx, token); !errors.Is(err, ErrRefreshRevoked) {
+			t.Errorf("session %d: err = %v, want ErrRefreshRevoked", i, err)
+		}
+	}
+	if _, _, err := store.Rotate(ctx, otherUser); err != nil {
+		t.Errorf("other user's session: %v", err)
+	}
+}
+
+func TestRefreshExpiry(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	store := NewRefreshStore(rdb, time.Hour)
+	ctx := context.Background()
+
+	token, err := store.Create(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotar renueva la familia: se mantiene viva mientras se use
+	mr.FastForward(45 * time.Minute)
+	token, _, err = store.Rotate(ctx, token)
+	if err != nil {
+		t.Fatalf("Rotate before expiry: %v", err)
+	}
+	mr.FastForward(45 * time.Minute)
+	token, _, err = store.Rotate(ctx, token)
+	if err != nil {
+		t.Fatalf("Rotate after the first TTL: %v", err)
+	}
+
+	mr.FastForward(2 * time.Hour)
+	if _, _, err := store.Rotate(ctx, token); !errors.Is(err, ErrRefreshNotFound) {
+		t.Errorf("expired token: err = %v, want ErrRefreshNotFound", err)
+	}
+}
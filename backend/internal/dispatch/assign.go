@@ -0,0 +1,112 @@
+package dispatch
+
+import "math"
+
+// Infeasible marca en la matriz de costos un par que no se puede asignar
+// (p. ej. el driver no es candidato de ese viaje)
+var Infeasible = math.Inf(1)
+
+// Assign resuelve la asignación de costo mínimo (algoritmo húngaro, O(n³))
+// entre filas (viajes) y columnas (drivers): primero asigna la mayor cantidad
+// de filas posible y, entre esas soluciones, la de menor costo total. Devuelve
+// para cada fila la columna asignada, o -1 si quedó sin asignar.
+func Assign(cost [][]float64) []int {
+	rows := len(cost)
+	if rows == 0 {
+		return nil
+	}
+	cols := 0
+	for _, row := range cost {
+		cols = max(cols, len(row))
+	}
+
+	// Matriz cuadrada con costos finitos: los pares imposibles valen más que
+	// cualquier asignación posible y las filas/columnas de relleno valen 0
+	n := max(rows, cols)
+	big := 1.0
+	for _, row := range cost {
+		for _, c := range row {
+			if !math.IsInf(c, 0) && !math.IsNaN(c) {
+				big += math.Abs(c)
+			}
+		}
+	}
+	a := make([][]float64, n+1)
+	for i := range a {
+		a[i] = make([]float64, n+1)
+	}
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			c := big
+			if j < len(cost[i]) && !math.IsInf(cost[i][j], 0) && !math.IsNaN(cost[i][j]) {
+				c = cost[i][j]
+			}
+			a[i+1][j+1] = c
+		}
+	}
+
+	// Potenciales u (filas) y v (columnas); p[j] es la fila asignada a j
+	u := make([]float64, n+1)
+	v := make([]float64, n+1)
+	p := make([]int, n+1)
+	way := make([]int, n+1)
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		minv := make([]float64, n+1)
+		used := make([]bool, n+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+		for {
+			used[j0] = true
+			i0, delta, j1 := p[j0], math.Inf(1), 0
+			for j := 1; j <= n; j++ {
+				if used[j] {
+					continue
+				}
+				if cur := a[i0][j] - u[i0] - v[j]; cur < minv[j] {
+					minv[j] = cur
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= n; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	result := make([]int, rows)
+	for i := range result {
+		result[i] = -1
+	}
+	for j := 1; j <= n; j++ {
+		i, col := p[j]-1, j-1
+		if i >= rows || col >= cols || col >= len(cost[i]) {
+			continue
+		}
+		if c := cost[i][col]; math.IsInf(c, 0) || math.IsNaN(c) {
+			continue
+		}
+		result[i] = col
+	}
+	return result
+}
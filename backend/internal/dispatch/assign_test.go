@@ -0,0 +1,144 @@
+package dispatch
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAssignFixtures(t *testing.T) {
+	x := Infeasible
+	tests := []struct {
+		name string
+		cost [][]float64
+		want []int
+	}{
+		{"empty", nil, nil},
+		{"single", [][]float64{{5}}, []int{0}},
+		{"single infeasible", [][]float64{{x}}, []int{-1}},
+		{"all infeasible", [][]float64{{x, x}, {x, x}, {x, x}}, []int{-1, -1, -1}},
+		{
+			// El greedy le daría el driver 0 al viaje 0 y dejaría al 1 sin driver
+			name: "more matches beat lower cost",
+			cost: [][]float64{{1, 2}, {3, x}},
+			want: []int{1, 0},
+		},
+		{
+			name: "min total cost",
+			cost: [][]float64{{4, 1, 3}, {2, 0, 5}, {3, 2, 2}},
+			want: []int{1, 0, 2},
+		},
+		{
+			name: "more trips than drivers",
+			cost: [][]float64{{10, 2}, {1, 9}, {3, 3}},
+			want: []int{1, 0, -1},
+		},
+		{
+			name: "more drivers than trips",
+			cost: [][]float64{{7, 3, 9, 1}},
+			want: []int{3},
+		},
+		{
+			name: "ragged rows",
+			cost: [][]float64{{5}, {1, 2}},
+			want: []int{0, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Assign(tt.cost)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Assign = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Assign = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// TestAssignMatchesBruteForce compara con todas las asignaciones posibles en
+// matrices chicas, cuadradas y rectangulares, con pares imposibles
+func TestAssignMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 2000; iter++ {
+		rows, cols := 1+rng.Intn(5), 1+rng.Intn(5)
+		infeasible := rng.Float64() * 0.7
+		cost := make([][]float64, rows)
+		for i := range cost {
+			cost[i] = make([]float64, cols)
+			for j := range cost[i] {
+				cost[i][j] = float64(rng.Intn(100))
+				if rng.Float64() < infeasible {
+					cost[i][j] = Infeasible
+				}
+			}
+		}
+
+		got := Assign(cost)
+		gotMatched, gotTotal := evaluate(t, cost, got)
+		wantMatched, wantTotal := bruteForce(cost)
+		if gotMatched != wantMatched || math.Abs(gotTotal-wantTotal) > 1e-9 {
+			t.Fatalf("cost %v: Assign = %v (%d matched, total %.0f), optimum has %d matched, total %.0f",
+				cost, got, gotMatched, gotTotal, wantMatched, wantTotal)
+		}
+	}
+}
+
+// evaluate valida que la asignación sea consistente y devuelve cuántas filas
+// asignó y su costo total
+func evaluate(t *testing.T, cost [][]float64, assigned []int) (int, float64) {
+	t.Helper()
+	if len(assigned) != len(cost) {
+		t.Fatalf("Assign returned %d rows, want %d", len(assigned), len(cost))
+	}
+	used := make(map[int]bool)
+	matched, total := 0, 0.0
+	for i, j := range assigned {
+		if j < 0 {
+			continue
+		}
+		if used[j] {
+			t.Fatalf("column %d assigned twice: %v", j, assigned)
+		}
+		if math.IsInf(cost[i][j], 0) {
+			t.Fatalf("infeasible pair (%d, %d) assigned: %v", i, j, assigned)
+		}
+		used[j] = true
+		matched++
+		total += cost[i][j]
+	}
+	return matched, total
+}
+
+// bruteForce prueba todas las asignaciones: más filas asignadas primero y,
+// a igual cantidad, menor costo
+func bruteForce(cost [][]float64) (int, float64) {
+	cols := len(cost[0])
+	used := make([]bool, cols)
+	bestMatched, bestTotal := 0, 0.0
+
+	var walk func(i, matched int, total float64)
+	walk = func(i, matched int, total float64) {
+		if i == len(cost) {
+			if matched > bestMatched || (matched == bestMatched && total < bestTotal) {
+				bestMatched, bestTotal = matched, total
+			}
+			return
+		}
+		walk(i+1, matched, total)
+		for j := 0; j < cols; j++ {
+			if used[j] || math.IsInf(cost[i][j], 0) {
+				continue
+			}
+			used[j] = true
+			walk(i+1, matched+1, total+cost[i][j])
+			used[j] = false
+		}
+	}
+	walk(0, 0, 0)
+	return bestMatched, bestTotal
+}
@@ -0,0 +1,109 @@
+package dispatch
+
+import (
+	"context"
+	"time"
+)
+
+// batchRequest es un viaje esperando driver en la ventana actual
+type batchRequest struct {
+	tripID     string
+	candidates []Candidate
+	reply      chan batchResult
+}
+
+type batchResult struct {
+	candidate Candidate
+	ok        bool
+}
+
+// batchMatcher junta los viajes que piden driver durante una ventana y los
+// asigna todos a la vez minimizando el ETA total de recojo, en lugar de darle
+// a cada viaje el mejor driver que quede libre en el orden en que llegaron
+type batchMatcher struct {
+	window   time.Duration
+	requests chan *batchRequest
+}
+
+func newBatchMatcher(window time.Duration) *batchMatcher {
+	return &batchMatcher{window: window, requests: make(chan *batchRequest)}
+}
+
+// assign espera al cierre de la ventana y devuelve el driver que le tocó al
+// viaje; false si todos sus candidatos fueron para otros viajes
+func (m *batchMatcher) assign(ctx context.Context, tripID string, candidates []Candidate) (Candidate, bool) {
+	req := &batchRequest{tripID: tripID, candidates: candidates, reply: make(chan batchResult, 1)}
+	select {
+	case m.requests <- req:
+	case <-ctx.Done():
+		return Candidate{}, false
+	}
+
+	select {
+	case res := <-req.reply:
+		return res.candidate, res.ok
+	case <-ctx.Done():
+		return Candidate{}, false
+	}
+}
+
+// run abre una ventana con el primer viaje que llega y la resuelve al vencer
+func (m *batchMatcher) run(ctx context.Context) {
+	var batch []*batchRequest
+	var closeWindow <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-m.requests:
+			if len(batch) == 0 {
+				closeWindow = time.After(m.window)
+			}
+			batch = append(batch, req)
+		case <-closeWindow:
+			m.solve(batch)
+			batch, closeWindow = nil, nil
+		}
+	}
+}
+
+// solve arma la matriz viajes × drivers con el ETA de cada par (Infeasible si
+// el driver no es candidato del viaje) y responde a cada viaje
+func (m *batchMatcher) solve(batch []*batchRequest) {
+	column := make(map[string]int)
+	var drivers []string
+	for _, req := range batch {
+		for _, cand := range req.candidates {
+			if _, ok := column[cand.DriverID]; !ok {
+				column[cand.DriverID] = len(drivers)
+				drivers = append(drivers, cand.DriverID)
+			}
+		}
+	}
+
+	cost := make([][]float64, len(batch))
+	for i, req := range batch {
+		cost[i] = make([]float64, len(drivers))
+		for j := range cost[i] {
+			cost[i][j] = Infeasible
+		}
+		for _, cand := range req.candidates {
+			cost[i][column[cand.DriverID]] = cand.ETAS
+		}
+	}
+
+	assigned := Assign(cost)
+	for i, req := range batch {
+		res := batchResult{}
+		if j := assigned[i]; j >= 0 {
+			for _, cand := range req.candidates {
+				if cand.DriverID == drivers[j] {
+					res = batchResult{candidate: cand, ok: true}
+					break
+				}
+			}
+		}
+		req.reply <- res
+	}
+}
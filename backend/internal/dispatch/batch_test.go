@@ -0,0 +1,205 @@
+package dispatch
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/geo"
+)
+
+// Área de Lima Metropolitana donde se reparten drivers y viajes simulados
+const (
+	simMinLat, simMaxLat = -12.20, -11.95
+	simMinLng, simMaxLng = -77.10, -76.90
+	// simSpeedMps es la velocidad con la que se estima el ETA (~18 km/h)
+	simSpeedMps = 5.0
+	simRadiusM  = 3000
+)
+
+type simPoint struct{ lat, lng float64 }
+
+// TestBatchBeatsGreedy simula ventanas de viajes y drivers libres y compara la
+// asignación del modo batch (batchMatcher.solve) con la greedy, en la que cada
+// viaje toma al driver libre de menor ETA en el orden en que llegó. En cada
+// ventana batch atiende al menos tantos viajes como greedy y, cuando atienden
+// los mismos, con un ETA total que no es mayor; en el agregado es menor.
+func TestBatchBeatsGreedy(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	const windows, trips, drivers = 300, 15, 40
+
+	var equalWindows int
+	var greedyTotal, batchTotal float64
+	for w := 0; w < windows; w++ {
+		ts := simPoints(rng, trips)
+		ds := simPoints(rng, drivers)
+
+		// eta[i][j]: del driver j al recojo del viaje i; Infeasible fuera del radio
+		eta := make([][]float64, trips)
+		for i, trip := range ts {
+			eta[i] = make([]float64, drivers)
+			for j, d := range ds {
+				eta[i][j] = Infeasible
+				if dist := geo.DistanceMeters(d.lat, d.lng, trip.lat, trip.lng); dist <= simRadiusM {
+					eta[i][j] = math.Ceil(dist / simSpeedMps)
+				}
+			}
+		}
+
+		greedyMatched, greedyETA := simTotals(eta, assignGreedy(eta))
+		batchMatched, batchETA := simTotals(eta, solveBatch(eta))
+
+		if batchMatched < greedyMatched {
+			t.Fatalf("window %d: batch matched %d trips, greedy %d", w, batchMatched, greedyMatched)
+		}
+		if batchMatched == greedyMatched {
+			if batchETA > greedyETA+1e-9 {
+				t.Fatalf("window %d: batch total ETA %.0f s > greedy %.0f s with %d matches",
+					w, batchETA, greedyETA, batchMatched)
+			}
+			equalWindows++
+			greedyTotal += greedyETA
+			batchTotal += batchETA
+		}
+	}
+
+	if equalWindows < windows/2 {
+		t.Fatalf("only %d of %d windows with equal matches", equalWindows, windows)
+	}
+	if batchTotal >= greedyTotal {
+		t.Fatalf("batch total ETA %.0f s not lower than greedy %.0f s", batchTotal, greedyTotal)
+	}
+	t.Logf("%d windows with equal matches: batch total ETA %.1f%% lower than greedy",
+		equalWindows, 100*(greedyTotal-batchTotal)/greedyTotal)
+}
+
+// solveBatch resuelve la ventana con batchMatcher.solve, como el modo batch
+func solveBatch(eta [][]float64) []int {
+	m := newBatchMatcher(0)
+	batch := make([]*batchRequest, len(eta))
+	for i, row := range eta {
+		req := &batchRequest{tripID: fmt.Sprint(i), reply: make(chan batchResult, 1)}
+		for j, cost := range row {
+			if !math.IsInf(cost, 0) {
+				req.candidates = append(req.candidates, Candidate{DriverID: fmt.Sprint(j), ETAS: cost})
+			}
+		}
+		batch[i] = req
+	}
+	m.solve(batch)
+
+	assigned := make([]int, len(eta))
+	for i, req := range batch {
+		assigned[i] = -1
+		if res := <-req.reply; res.ok {
+			fmt.Sscan(res.candidate.DriverID, &assigned[i])
+		}
+	}
+	return assigned
+}
+
+// TestBatchMatcherConcurrent pide driver desde varios viajes a la vez a través
+// de run: los que caen en la misma ventana reciben drivers distintos y el que
+// sobra se queda sin driver
+func TestBatchMatcherConcurrent(t *testing.T) {
+	const trips, drivers = 6, 5
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := newBatchMatcher(50 * time.Millisecond)
+	go m.run(ctx)
+
+	// Todos los drivers son candidatos de todos los viajes, así que cada uno
+	// tiene a la vista drivers que también quieren los demás
+	var candidates []Candidate
+	for j := 0; j < drivers; j++ {
+		candidates = append(candidates, Candidate{DriverID: fmt.Sprintf("d%d", j), ETAS: float64(60 * (j + 1))})
+	}
+
+	results := make([]batchResult, trips)
+	var wg sync.WaitGroup
+	for i := 0; i < trips; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cand, ok := m.assign(ctx, fmt.Sprintf("t%d", i), candidates)
+			results[i] = batchResult{candidate: cand, ok: ok}
+		}(i)
+	}
+	wg.Wait()
+
+	taken := make(map[string]string)
+	var unmatched int
+	for i, res := range results {
+		if !res.ok {
+			unmatched++
+			continue
+		}
+		if other, ok := taken[res.candidate.DriverID]; ok {
+			t.Errorf("driver %s assigned to %s and t%d", res.candidate.DriverID, other, i)
+		}
+		taken[res.candidate.DriverID] = fmt.Sprintf("t%d", i)
+	}
+	if len(taken) != drivers || unmatched != trips-drivers {
+		t.Errorf("%d trips matched and %d unmatched, want %d and %d", len(taken), unmatched, drivers, trips-drivers)
+	}
+
+	// Cerrada la ventana, el siguiente viaje abre otra
+	if cand, ok := m.assign(ctx, "t-next", candidates[:1]); !ok || cand.DriverID != "d0" {
+		t.Errorf("next window: assign = %+v, %v", cand, ok)
+	}
+
+	// Un viaje que se cancela mientras espera no bloquea al matcher
+	waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer waitCancel()
+	if _, ok := m.assign(waitCtx, "t-cancelled", candidates); ok {
+		t.Error("assign matched after its context expired")
+	}
+	if _, ok := m.assign(ctx, "t-after", candidates); !ok {
+		t.Error("assign after a cancelled request found no driver")
+	}
+}
+
+// assignGreedy da a cada viaje, en orden de llegada, el driver libre de menor ETA
+func assignGreedy(eta [][]float64) []int {
+	taken := make(map[int]bool)
+	assigned := make([]int, len(eta))
+	for i, row := range eta {
+		assigned[i] = -1
+		best := Infeasible
+		for j, cost := range row {
+			if !taken[j] && cost < best {
+				best, assigned[i] = cost, j
+			}
+		}
+		if assigned[i] >= 0 {
+			taken[assigned[i]] = true
+		}
+	}
+	return assigned
+}
+
+func simTotals(eta [][]float64, assigned []int) (int, float64) {
+	matched, total := 0, 0.0
+	for i, j := range assigned {
+		if j >= 0 {
+			matched++
+			total += eta[i][j]
+		}
+	}
+	return matched, total
+}
+
+func simPoints(rng *rand.Rand, n int) []simPoint {
+	points := make([]simPoint, n)
+	for i := range points {
+		points[i] = simPoint{
+			lat: simMinLat + rng.Float64()*(simMaxLat-simMinLat),
+			lng: simMinLng + rng.Float64()*(simMaxLng-simMinLng),
+		}
+	}
+	return points
+}
@@ -0,0 +1,396 @@
+// Package dispatch ofrece cada viaje nuevo a los drivers cercanos, de a uno
+// (sequential), a varios a la vez (parallel) o asignando por lotes los viajes
+// que llegan en una misma ventana (batch), con un tiempo límite por oferta.
+// Si la búsqueda de candidatos falla o todos tienen otra oferta abierta se
+// reintenta hasta el plazo del viaje. Si nadie acepta tras MaxOffers ofertas,
+// no quedan candidatos o vence el plazo, el viaje pasa a no_drivers.
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/realtime"
+	"github.com/sirupsen/logrus"
+)
+
+// Mode elige cómo se reparten las ofertas
+type Mode string
+
+const (
+	// ModeOff no ofrece nada: los drivers aceptan viajes por su cuenta
+	ModeOff Mode = "off"
+	// ModeSequential ofrece a un driver a la vez, del mejor puntaje al peor
+	ModeSequential Mode = "sequential"
+	// ModeParallel ofrece a ParallelOffers drivers a la vez; gana el primero
+	ModeParallel Mode = "parallel"
+	// ModeBatch junta los viajes de BatchWindow y reparte los drivers entre
+	// todos minimizando el ETA total; cada viaje recibe una oferta a la vez
+	ModeBatch Mode = "batch"
+)
+
+// Resultados con los que se cierra una oferta
+const (
+	OutcomeExpired   = "expired"
+	OutcomeWithdrawn = "withdrawn"
+)
+
+// ErrCandidateBusy indica que el driver ya tiene otra oferta abierta
+var ErrCandidateBusy = errors.New("dispatch: candidate has another open offer")
+
+// Config ajusta el reparto
+type Config struct {
+	Mode           Mode
+	OfferTimeout   time.Duration
+	ParallelOffers int
+	// MaxOffers es el total de ofertas por viaje antes de rendirse
+	MaxOffers int
+	// RadiusM es el radio de búsqueda de candidatos alrededor del origen
+	RadiusM float64
+	// BatchWindow es cuánto se esperan otros viajes en modo batch
+	BatchWindow time.Duration
+	// RetryDelay es la espera antes de volver a buscar candidatos si la
+	// búsqueda falló o todos estaban ocupados con otra oferta
+	RetryDelay time.Duration
+}
+
+// DefaultConfig: de a un driver, 15 s por oferta, hasta 10 ofertas en 3 km
+func DefaultConfig() Config {
+	return Config{
+		Mode:           ModeSequential,
+		OfferTimeout:   15 * time.Second,
+		ParallelOffers: 3,
+		MaxOffers:      10,
+		RadiusM:        3000,
+		BatchWindow:    2 * time.Second,
+		RetryDelay:     2 * time.Second,
+	}
+}
+
+// Trip es el viaje a repartir
+type Trip struct {
+	ID        string
+	RiderID   string
+	OriginLat float64
+	OriginLng float64
+	DestLat   float64
+	DestLng   float64
+}
+
+// Candidate es un driver disponible cerca del origen
+type Candidate struct {
+	DriverID  string
+	UserID    string
+	DistanceM float64
+	// ETAS es el tiempo estimado hasta el recojo; es el costo en modo batch
+	ETAS float64
+	// Score es el puntaje del matching.Scorer para este viaje
+	Score float64
+}
+
+// Offer es una oferta enviada a un driver
+type Offer struct {
+	TripID    string
+	DriverID  string
+	UserID    string
+	DistanceM float64
+	ExpiresAt time.Time
+}
+
+// Backend es lo que el dispatcher necesita del resto del sistema
+type Backend interface {
+	// Candidates devuelve drivers disponibles, el de mayor Score primero
+	Candidates(ctx context.Context, trip Trip, radiusM float64) ([]Candidate, error)
+	// SendOffer reserva al driver y le envía la oferta; ErrCandidateBusy si
+	// ya tiene otra abierta
+	SendOffer(ctx context.Context, trip Trip, offer Offer) error
+	// CloseOffer libera al driver y le avisa que la oferta ya no vale
+	CloseOffer(ctx context.Context, offer Offer, outcome string)
+	// WatchTrip escucha los cambios de estado del viaje (realtime.TripTopic)
+	// y los rechazos de sus ofertas (realtime.OfferTopic)
+	WatchTrip(tripID string) *realtime.Listener
+	TripStatus(ctx context.Context, tripID string) (string, error)
+	// MarkNoDrivers pasa el viaje a no_drivers si sigue requested
+	MarkNoDrivers(ctx context.Context, tripID string) (bool, error)
+	// ExpireStale pasa a no_drivers los viajes requested más viejos que maxAge
+	// (p. ej. si la instancia que los repartía se reinició)
+	ExpireStale(ctx context.Context, maxAge time.Duration) (int, error)
+}
+
+// Dispatcher reparte los viajes; cada viaje corre en su propia goroutine
+type Dispatcher struct {
+	ctx     context.Context
+	cfg     Config
+	backend Backend
+	log     *logrus.Logger
+	// batch sólo existe en ModeBatch
+	batch *batchMatcher
+}
+
+func New(ctx context.Context, cfg Config, backend Backend, log *logrus.Logger) *Dispatcher {
+	def := DefaultConfig()
+	if cfg.Mode == "" {
+		cfg.Mode = def.Mode
+	}
+	if cfg.OfferTimeout <= 0 {
+		cfg.OfferTimeout = def.OfferTimeout
+	}
+	if cfg.ParallelOffers <= 0 {
+		cfg.ParallelOffers = def.ParallelOffers
+	}
+	if cfg.MaxOffers <= 0 {
+		cfg.MaxOffers = def.MaxOffers
+	}
+	if cfg.RadiusM <= 0 {
+		cfg.RadiusM = def.RadiusM
+	}
+	if cfg.BatchWindow <= 0 {
+		cfg.BatchWindow = def.BatchWindow
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = def.RetryDelay
+	}
+
+	d := &Dispatcher{ctx: ctx, cfg: cfg, backend: backend, log: log}
+	if cfg.Mode == ModeBatch {
+		d.batch = newBatchMatcher(cfg.BatchWindow)
+	}
+	return d
+}
+
+// Enabled indica si los viajes se reparten automáticamente
+func (d *Dispatcher) Enabled() bool {
+	return d.cfg.Mode != ModeOff
+}
+
+// Config devuelve la configuración efectiva
+func (d *Dispatcher) Config() Config {
+	return d.cfg
+}
+
+// MaxDuration es lo más que puede tardar el reparto de un viaje
+func (d *Dispatcher) MaxDuration() time.Duration {
+	perOffer := d.cfg.OfferTimeout
+	if d.batch != nil {
+		perOffer += d.cfg.BatchWindow
+	}
+	return time.Duration(d.cfg.MaxOffers) * perOffer
+}
+
+// Dispatch empieza a ofrecer el viaje en segundo plano
+func (d *Dispatcher) Dispatch(trip Trip) {
+	if !d.Enabled() {
+		return
+	}
+	go d.run(trip)
+}
+
+// Run limpia periódicamente los viajes que quedaron sin repartir y, en modo
+// batch, resuelve las ventanas
+func (d *Dispatcher) Run(ctx context.Context) {
+	if !d.Enabled() {
+		return
+	}
+	if d.batch != nil {
+		go d.batch.run(ctx)
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := d.backend.ExpireStale(ctx, d.MaxDuration()+time.Minute)
+			if err != nil {
+				d.log.WithError(err).Warn("Failed to expire stale trip requests")
+			} else if n > 0 {
+				d.log.WithField("trips", n).Info("Stale trip requests marked no_drivers")
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) run(trip Trip) {
+	log := d.log.WithField("trip", trip.ID)
+
+	// Escuchar antes de ofrecer para no perder una aceptación
+	watch := d.backend.WatchTrip(trip.ID)
+	defer watch.Close()
+
+	wave := 1
+	if d.cfg.Mode == ModeParallel {
+		wave = d.cfg.ParallelOffers
+	}
+
+	offered := make(map[string]bool)
+	sent := 0
+	// Los reintentos (y en modo batch las ventanas perdidas) no cuentan como
+	// ofertas; el plazo evita que el viaje espere para siempre
+	deadline := time.Now().Add(d.MaxDuration())
+	for sent < d.cfg.MaxOffers && time.Now().Before(deadline) {
+		if d.ctx.Err() != nil {
+			return
+		}
+		if status, err := d.backend.TripStatus(d.ctx, trip.ID); err != nil || status != "requested" {
+			return
+		}
+
+		candidates, err := d.backend.Candidates(d.ctx, trip, d.cfg.RadiusM)
+		if err != nil {
+			log.WithError(err).Warn("Failed to find dispatch candidates")
+			if !d.pause(deadline) {
+				return
+			}
+			continue
+		}
+		pending := slices.DeleteFunc(candidates, func(c Candidate) bool { return offered[c.DriverID] })
+		if len(pending) == 0 {
+			break
+		}
+
+		var offers []Offer
+		var busy bool
+		if d.batch != nil {
+			assigned, ok := d.batch.assign(d.ctx, trip.ID, pending)
+			if !ok {
+				// Sus candidatos fueron para otros viajes de la ventana
+				continue
+			}
+			// La próxima ventana ya espera lo suficiente si estaba ocupado
+			offers, _ = d.offerWave(trip, []Candidate{assigned}, offered, 1, log)
+		} else {
+			offers, busy = d.offerWave(trip, pending, offered, min(wave, d.cfg.MaxOffers-sent), log)
+		}
+		if len(offers) == 0 {
+			// Ocupados con ofertas de otros viajes: pueden liberarse pronto
+			if busy && !d.pause(deadline) {
+				return
+			}
+			continue
+		}
+		sent += len(offers)
+
+		if d.waitForAnswer(watch, offers) {
+			return
+		}
+	}
+
+	if d.ctx.Err() != nil {
+		return
+	}
+	ok, err := d.backend.MarkNoDrivers(d.ctx, trip.ID)
+	if err != nil {
+		log.WithError(err).Error("Failed to mark trip without drivers")
+		return
+	}
+	if ok {
+		log.WithField("offers", sent).Info("No driver accepted the trip")
+	}
+}
+
+// offerWave envía hasta n ofertas a candidatos que aún no la recibieron;
+// busy indica si alguno se saltó por tener otra oferta abierta
+func (d *Dispatcher) offerWave(trip Trip, candidates []Candidate, offered map[string]bool, n int, log *logrus.Entry) (offers []Offer, busy bool) {
+	offers = make([]Offer, 0, n)
+	expiresAt := time.Now().Add(d.cfg.OfferTimeout)
+	for _, cand := range candidates {
+		if len(offers) == n {
+			break
+		}
+		// Los candidatos llegan ordenados por Score: se ofrece al mejor libre
+		if offered[cand.DriverID] {
+			continue
+		}
+
+		offer := Offer{
+			TripID:    trip.ID,
+			DriverID:  cand.DriverID,
+			UserID:    cand.UserID,
+			DistanceM: cand.DistanceM,
+			ExpiresAt: expiresAt,
+		}
+		err := d.backend.SendOffer(d.ctx, trip, offer)
+		if errors.Is(err, ErrCandidateBusy) {
+			busy = true
+			continue
+		}
+		offered[cand.DriverID] = true
+		if err != nil {
+			log.WithError(err).WithField("driver", cand.DriverID).Warn("Failed to send trip offer")
+			continue
+		}
+		offers = append(offers, offer)
+	}
+	return offers, busy
+}
+
+// pause espera RetryDelay, sin pasarse del plazo, antes de reintentar; false
+// si el dispatcher se apagó
+func (d *Dispatcher) pause(deadline time.Time) bool {
+	timer := time.NewTimer(min(d.cfg.RetryDelay, time.Until(deadline)))
+	defer timer.Stop()
+
+	select {
+	case <-d.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// waitForAnswer espera a que venzan las ofertas, a que todos las rechacen o a
+// que el viaje deje de estar requested. Devuelve true si el reparto terminó.
+func (d *Dispatcher) waitForAnswer(watch *realtime.Listener, offers []Offer) bool {
+	timer := time.NewTimer(time.Until(offers[0].ExpiresAt))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			d.closeOffers(offers, OutcomeWithdrawn)
+			return true
+
+		case <-timer.C:
+			d.closeOffers(offers, OutcomeExpired)
+			return false
+
+		case raw := <-watch.C():
+			var msg realtime.Message
+			var event struct {
+				Status   string `json:"status"`
+				DriverID string `json:"driver_id"`
+			}
+			if json.Unmarshal(raw, &msg) != nil || json.Unmarshal(msg.Data, &event) != nil {
+				continue
+			}
+
+			switch {
+			case msg.Type == realtime.TypeTripOfferDeclined:
+				// El rechazo ya quedó registrado; sin ofertas abiertas se
+				// pasa de inmediato a los siguientes candidatos
+				offers = slices.DeleteFunc(offers, func(o Offer) bool { return o.DriverID == event.DriverID })
+				if len(offers) == 0 {
+					return false
+				}
+			case msg.Type == realtime.TypeTripStatus && event.Status != "requested":
+				// Aceptado (por uno de ellos u otro), cancelado o sin drivers
+				d.closeOffers(offers, OutcomeWithdrawn)
+				return true
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) closeOffers(offers []Offer, outcome string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for _, offer := range offers {
+		d.backend.CloseOffer(ctx, offer, outcome)
+	}
+}
@@ -0,0 +1,407 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/realtime"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeBackend registra las ofertas y permite responderlas desde el test
+type fakeBackend struct {
+	mu sync.Mutex
+	// candidates devuelve los candidatos de la búsqueda número call (desde 0)
+	candidates func(call int) ([]Candidate, error)
+	// onOffer decide qué devuelve SendOffer; puede publicar respuestas
+	onOffer func(f *fakeBackend, offer Offer) error
+
+	hub      *realtime.Hub
+	listener *realtime.Listener
+	status   string
+	searches int
+	sent     []Offer
+	closed   map[string]string
+	marked   bool
+}
+
+func newFakeBackend(drivers ...string) *fakeBackend {
+	cands := make([]Candidate, len(drivers))
+	for i, id := range drivers {
+		cands[i] = Candidate{DriverID: id, UserID: "user-" + id}
+	}
+	return &fakeBackend{
+		candidates: func(int) ([]Candidate, error) { return slices.Clone(cands), nil },
+		hub:        realtime.NewHub(nil, quietLogger()),
+		status:     "requested",
+		closed:     make(map[string]string),
+	}
+}
+
+func (f *fakeBackend) Candidates(ctx context.Context, trip Trip, radiusM float64) ([]Candidate, error) {
+	f.mu.Lock()
+	call := f.searches
+	f.searches++
+	f.mu.Unlock()
+	return f.candidates(call)
+}
+
+func (f *fakeBackend) SendOffer(ctx context.Context, trip Trip, offer Offer) error {
+	if f.onOffer != nil {
+		if err := f.onOffer(f, offer); err != nil {
+			return err
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, offer)
+	return nil
+}
+
+func (f *fakeBackend) CloseOffer(ctx context.Context, offer Offer, outcome string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed[offer.DriverID] = outcome
+}
+
+func (f *fakeBackend) WatchTrip(tripID string) *realtime.Listener {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listener = f.hub.Listen(realtime.TripTopic(tripID), realtime.OfferTopic(tripID))
+	return f.listener
+}
+
+func (f *fakeBackend) TripStatus(ctx context.Context, tripID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status, nil
+}
+
+func (f *fakeBackend) MarkNoDrivers(ctx context.Context, tripID string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.status != "requested" {
+		return false, nil
+	}
+	f.status, f.marked = "no_drivers", true
+	return true, nil
+}
+
+func (f *fakeBackend) ExpireStale(ctx context.Context, maxAge time.Duration) (int, error) {
+	return 0, nil
+}
+
+// decline publica el rechazo del driver como lo hace DeclineTrip
+func (f *fakeBackend) decline(driverID string) {
+	f.publish(realtime.TypeTripOfferDeclined, map[string]string{"driver_id": driverID})
+}
+
+// setStatus cambia el estado del viaje y lo publica como trip_status
+func (f *fakeBackend) setStatus(status, driverID string) {
+	f.mu.Lock()
+	f.status = status
+	f.mu.Unlock()
+	f.publish(realtime.TypeTripStatus, map[string]string{"status": status, "driver_id": driverID})
+}
+
+func (f *fakeBackend) publish(msgType string, data any) {
+	msg, err := realtime.Encode(msgType, data)
+	if err != nil {
+		panic(err)
+	}
+	f.listener.Send(msg)
+}
+
+// waves agrupa las ofertas enviadas por vencimiento: cada ola comparte ExpiresAt
+func (f *fakeBackend) waves() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var waves [][]string
+	for i, offer := range f.sent {
+		if i == 0 || !offer.ExpiresAt.Equal(f.sent[i-1].ExpiresAt) {
+			waves = append(waves, nil)
+		}
+		waves[len(waves)-1] = append(waves[len(waves)-1], offer.DriverID)
+	}
+	return waves
+}
+
+func quietLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return log
+}
+
+// runTrip reparte un viaje con el dispatcher y espera a que termine
+func runTrip(t *testing.T, cfg Config, backend *fakeBackend) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := New(ctx, cfg, backend, quietLogger())
+	done := make(chan struct{})
+	go func() {
+		d.run(Trip{ID: "trip-1"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatch did not finish")
+	}
+}
+
+func TestDispatcherOfferLoop(t *testing.T) {
+	const short = 20 * time.Millisecond
+	sequential := Config{Mode: ModeSequential, OfferTimeout: short, MaxOffers: 10, RetryDelay: time.Millisecond}
+	parallel := Config{Mode: ModeParallel, OfferTimeout: short, ParallelOffers: 2, MaxOffers: 10, RetryDelay: time.Millisecond}
+
+	// Con ofertas de una hora, el test sólo termina si algo corta la espera
+	longSequential, longParallel := sequential, parallel
+	longSequential.OfferTimeout, longParallel.OfferTimeout = time.Hour, time.Hour
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		backend func() *fakeBackend
+		waves   [][]string
+		closed  map[string]string
+		marked  bool
+	}{
+		{
+			name:    "sequential timeouts move to the next candidate",
+			cfg:     sequential,
+			backend: func() *fakeBackend { return newFakeBackend("a", "b", "c") },
+			waves:   [][]string{{"a"}, {"b"}, {"c"}},
+			closed:  map[string]string{"a": OutcomeExpired, "b": OutcomeExpired, "c": OutcomeExpired},
+			marked:  true,
+		},
+		{
+			name:    "parallel waves",
+			cfg:     parallel,
+			backend: func() *fakeBackend { return newFakeBackend("a", "b", "c", "d", "e") },
+			waves:   [][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+			closed: map[string]string{
+				"a": OutcomeExpired, "b": OutcomeExpired, "c": OutcomeExpired,
+				"d": OutcomeExpired, "e": OutcomeExpired,
+			},
+			marked: true,
+		},
+		{
+			name:    "sequential max offers",
+			cfg:     Config{Mode: ModeSequential, OfferTimeout: short, MaxOffers: 2},
+			backend: func() *fakeBackend { return newFakeBackend("a", "b", "c", "d") },
+			waves:   [][]string{{"a"}, {"b"}},
+			closed:  map[string]string{"a": OutcomeExpired, "b": OutcomeExpired},
+			marked:  true,
+		},
+		{
+			name:    "parallel max offers trims the last wave",
+			cfg:     Config{Mode: ModeParallel, OfferTimeout: short, ParallelOffers: 3, MaxOffers: 4},
+			backend: func() *fakeBackend { return newFakeBackend("a", "b", "c", "d", "e", "f") },
+			waves:   [][]string{{"a", "b", "c"}, {"d"}},
+			closed: map[string]string{
+				"a": OutcomeExpired, "b": OutcomeExpired, "c": OutcomeExpired, "d": OutcomeExpired,
+			},
+			marked: true,
+		},
+		{
+			name: "decline ends the wait early",
+			cfg:  longSequential,
+			backend: func() *fakeBackend {
+				f := newFakeBackend("a", "b")
+				f.onOffer = func(f *fakeBackend, offer Offer) error {
+					f.decline(offer.DriverID)
+					return nil
+				}
+				return f
+			},
+			waves:  [][]string{{"a"}, {"b"}},
+			closed: map[string]string{},
+			marked: true,
+		},
+		{
+			name: "parallel wave waits for every decline",
+			cfg:  longParallel,
+			backend: func() *fakeBackend {
+				f := newFakeBackend("a", "b", "c")
+				f.onOffer = func(f *fakeBackend, offer Offer) error {
+					f.decline(offer.DriverID)
+					return nil
+				}
+				return f
+			},
+			waves:  [][]string{{"a", "b"}, {"c"}},
+			closed: map[string]string{},
+			marked: true,
+		},
+		{
+			name: "acceptance withdraws open offers",
+			cfg:  longParallel,
+			backend: func() *fakeBackend {
+				f := newFakeBackend("a", "b", "c")
+				f.onOffer = func(f *fakeBackend, offer Offer) error {
+					if offer.DriverID == "b" {
+						f.setStatus("accepted", "b")
+					}
+					return nil
+				}
+				return f
+			},
+			waves:  [][]string{{"a", "b"}},
+			closed: map[string]string{"a": OutcomeWithdrawn, "b": OutcomeWithdrawn},
+		},
+		{
+			name: "cancellation withdraws open offers",
+			cfg:  longSequential,
+			backend: func() *fakeBackend {
+				f := newFakeBackend("a", "b")
+				f.onOffer = func(f *fakeBackend, offer Offer) error {
+					f.setStatus("cancelled", "")
+					return nil
+				}
+				return f
+			},
+			waves:  [][]string{{"a"}},
+			closed: map[string]string{"a": OutcomeWithdrawn},
+		},
+		{
+			name:    "no candidates",
+			cfg:     sequential,
+			backend: func() *fakeBackend { return newFakeBackend() },
+			closed:  map[string]string{},
+			marked:  true,
+		},
+		{
+			name: "lookup errors are retried",
+			cfg:  sequential,
+			backend: func() *fakeBackend {
+				f := newFakeBackend()
+				f.candidates = func(call int) ([]Candidate, error) {
+					if call < 2 {
+						return nil, errors.New("redis down")
+					}
+					return []Candidate{{DriverID: "a"}}, nil
+				}
+				return f
+			},
+			waves:  [][]string{{"a"}},
+			closed: map[string]string{"a": OutcomeExpired},
+			marked: true,
+		},
+		{
+			name: "busy candidates are retried",
+			cfg:  sequential,
+			backend: func() *fakeBackend {
+				f := newFakeBackend("a", "b")
+				busy := 0
+				f.onOffer = func(f *fakeBackend, offer Offer) error {
+					if busy < 4 {
+						busy++
+						return ErrCandidateBusy
+					}
+					return nil
+				}
+				return f
+			},
+			waves:  [][]string{{"a"}, {"b"}},
+			closed: map[string]string{"a": OutcomeExpired, "b": OutcomeExpired},
+			marked: true,
+		},
+		{
+			name: "always busy gives up at the deadline",
+			cfg:  Config{Mode: ModeSequential, OfferTimeout: short, MaxOffers: 2, RetryDelay: time.Millisecond},
+			backend: func() *fakeBackend {
+				f := newFakeBackend("a")
+				f.onOffer = func(*fakeBackend, Offer) error { return ErrCandidateBusy }
+				return f
+			},
+			closed: map[string]string{},
+			marked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := tt.backend()
+			runTrip(t, tt.cfg, backend)
+
+			if got := backend.waves(); !equalWaves(got, tt.waves) {
+				t.Errorf("offer waves = %v, want %v", got, tt.waves)
+			}
+			backend.mu.Lock()
+			defer backend.mu.Unlock()
+			if !maps.Equal(backend.closed, tt.closed) {
+				t.Errorf("closed offers = %v, want %v", backend.closed, tt.closed)
+			}
+			if backend.marked != tt.marked {
+				t.Errorf("marked no_drivers = %v, want %v", backend.marked, tt.marked)
+			}
+		})
+	}
+}
+
+func TestDispatcherRetriesUntilDeadline(t *testing.T) {
+	backend := newFakeBackend()
+	backend.candidates = func(int) ([]Candidate, error) { return nil, errors.New("redis down") }
+
+	start := time.Now()
+	runTrip(t, Config{Mode: ModeSequential, OfferTimeout: 30 * time.Millisecond, MaxOffers: 2, RetryDelay: time.Millisecond}, backend)
+
+	// El plazo es MaxOffers × OfferTimeout
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("gave up after %v, before the deadline", elapsed)
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if backend.searches < 2 {
+		t.Errorf("searched %d times, want retries", backend.searches)
+	}
+	if !backend.marked {
+		t.Error("trip not marked no_drivers at the deadline")
+	}
+}
+
+func TestDispatcherShutdownWithdrawsOffers(t *testing.T) {
+	backend := newFakeBackend("a")
+	sent := make(chan struct{})
+	backend.onOffer = func(*fakeBackend, Offer) error {
+		close(sent)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := New(ctx, Config{Mode: ModeSequential, OfferTimeout: time.Hour}, backend, quietLogger())
+	done := make(chan struct{})
+	go func() {
+		d.run(Trip{ID: "trip-1"})
+		close(done)
+	}()
+
+	<-sent
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatch did not stop")
+	}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if backend.closed["a"] != OutcomeWithdrawn {
+		t.Errorf("offer closed as %q, want %q", backend.closed["a"], OutcomeWithdrawn)
+	}
+	if backend.marked {
+		t.Error("trip marked no_drivers on shutdown")
+	}
+}
+
+func equalWaves(a, b [][]string) bool {
+	return slices.EqualFunc(a, b, func(x, y []string) bool { return slices.Equal(x, y) })
+}
@@ -0,0 +1,28 @@
+package geo
+
+import "math"
+
+const earthRadiusM = 6371000.0
+
+// DistanceMeters es la distancia haversine entre dos puntos
+func DistanceMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusM * math.Asin(math.Sqrt(a))
+}
+
+// BearingDegrees es el rumbo inicial (0 = norte, en sentido horario) para ir
+// del primer punto al segundo
+func BearingDegrees(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	phi1, phi2 := toRad(lat1), toRad(lat2)
+	dLng := toRad(lng2 - lng1)
+	y := math.Sin(dLng) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLng)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
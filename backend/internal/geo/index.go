@@ -0,0 +1,161 @@
+// Package geo mantiene en Redis las posiciones recientes de los drivers para
+// responder búsquedas por cercanía sin escanear la tabla locations.
+package geo
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrNoPosition indica que el driver no tiene una posición vigente en el índice
+var ErrNoPosition = errors.New("geo: no recent position")
+
+// Position es la última posición conocida de un driver
+type Position struct {
+	DriverID string
+	Lat      float64
+	Lng      float64
+	Speed    float64
+	Heading  float64
+	TS       int64 // epoch en milisegundos
+}
+
+// Nearby es un driver encontrado con su distancia al punto buscado
+type Nearby struct {
+	Position
+	DistanceM float64
+}
+
+// Index guarda un GEO set con todos los drivers y un hash por driver con
+// velocidad, rumbo y ts. El hash vence a los ttl; un miembro del GEO set sin
+// hash se considera vencido y se limpia al consultarlo.
+type Index struct {
+	rdb    *redis.Client
+	setKey string
+	prefix string
+	ttl    time.Duration
+}
+
+// NewIndex crea un índice bajo el prefijo de claves indicado (p. ej. "geo")
+func NewIndex(rdb *redis.Client, prefix string, ttl time.Duration) *Index {
+	return &Index{
+		rdb:    rdb,
+		setKey: prefix + ":drivers",
+		prefix: prefix + ":driver:",
+		ttl:    ttl,
+	}
+}
+
+// Update registra la posición del driver y renueva su vencimiento
+func (x *Index) Update(ctx context.Context, p Position) error {
+	key := x.prefix + p.DriverID
+
+	pipe := x.rdb.Pipeline()
+	pipe.GeoAdd(ctx, x.setKey, &redis.GeoLocation{Name: p.DriverID, Longitude: p.Lng, Latitude: p.Lat})
+	pipe.HSet(ctx, key,
+		"lat", p.Lat,
+		"lng", p.Lng,
+		"speed", p.Speed,
+		"heading", p.Heading,
+		"ts", p.TS,
+	)
+	pipe.Expire(ctx, key, x.ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Get devuelve la posición vigente del driver o ErrNoPosition
+func (x *Index) Get(ctx context.Context, driverID string) (*Position, error) {
+	values, err := x.rdb.HMGet(ctx, x.prefix+driverID, "lat", "lng", "speed", "heading", "ts").Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 5 || values[0] == nil {
+		return nil, ErrNoPosition
+	}
+	return &Position{
+		DriverID: driverID,
+		Lat:      parseFloat(values[0]),
+		Lng:      parseFloat(values[1]),
+		Speed:    parseFloat(values[2]),
+		Heading:  parseFloat(values[3]),
+		TS:       int64(parseFloat(values[4])),
+	}, nil
+}
+
+// Remove saca al driver del índice (p. ej. al desconectarse)
+func (x *Index) Remove(ctx context.Context, driverID string) error {
+	pipe := x.rdb.Pipeline()
+	pipe.ZRem(ctx, x.setKey, driverID)
+	pipe.Del(ctx, x.prefix+driverID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Nearby devuelve hasta limit drivers con posición vigente dentro del radio,
+// ordenados por distancia. more indica que el GEO set llenó limit y puede
+// haber más drivers en el radio; los vencidos que se descartan cuentan para
+// limit, así que puede haber más aunque se devuelvan menos.
+func (x *Index) Nearby(ctx context.Context, lat, lng, radiusM float64, limit int) (result []Nearby, more bool, err error) {
+	// GEORADIUS_RO en lugar de GEOSEARCH para funcionar también con Redis < 6.2
+	locations, err := x.rdb.GeoRadius(ctx, x.setKey, lng, lat, &redis.GeoRadiusQuery{
+		Radius:   radiusM,
+		Unit:     "m",
+		WithDist: true,
+		Sort:     "ASC",
+		Count:    limit,
+	}).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	more = len(locations) == limit
+	if len(locations) == 0 {
+		return []Nearby{}, false, nil
+	}
+
+	pipe := x.rdb.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(locations))
+	for i, loc := range locations {
+		cmds[i] = pipe.HMGet(ctx, x.prefix+loc.Name, "lat", "lng", "speed", "heading", "ts")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, false, err
+	}
+
+	result = make([]Nearby, 0, len(locations))
+	var expired []interface{}
+	for i, loc := range locations {
+		values := cmds[i].Val()
+		if len(values) != 5 || values[0] == nil {
+			expired = append(expired, loc.Name)
+			continue
+		}
+		result = append(result, Nearby{
+			Position: Position{
+				DriverID: loc.Name,
+				Lat:      parseFloat(values[0]),
+				Lng:      parseFloat(values[1]),
+				Speed:    parseFloat(values[2]),
+				Heading:  parseFloat(values[3]),
+				TS:       int64(parseFloat(values[4])),
+			},
+			DistanceM: loc.Dist,
+		})
+	}
+
+	// Limpieza perezosa de los drivers que dejaron de reportar
+	if len(expired) > 0 {
+		x.rdb.ZRem(ctx, x.setKey, expired...)
+	}
+	return result, more, nil
+}
+
+func parseFloat(v interface{}) float64 {
+	s, _ := v.(string)
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
@@ -0,0 +1,161 @@
+package geo
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// Área de Lima Metropolitana donde se reparten los drivers simulados
+const (
+	benchMinLat, benchMaxLat = -12.20, -11.95
+	benchMinLng, benchMaxLng = -77.10, -76.90
+	benchDrivers             = 5000
+	benchRadiusM             = 1000
+	benchLimit               = 60
+)
+
+// BenchmarkNearby mide la búsqueda de cercanos en el índice GEO de Redis sin
+// pasar por la DB. La comparación con PostGIS sobre el esquema real está en
+// BenchmarkNearbyDrivers (internal/server). Se salta sin BENCH_REDIS_ADDR:
+//
+//	BENCH_REDIS_ADDR=localhost:6379 go test ./internal/geo -run '^$' -bench Nearby
+func BenchmarkNearby(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	positions := make([]Position, benchDrivers)
+	for i := range positions {
+		lat, lng := benchPoint(rng)
+		positions[i] = Position{
+			DriverID: fmt.Sprintf("driver-%d", i),
+			Lat:      lat,
+			Lng:      lng,
+			Speed:    rng.Float64() * 12,
+			Heading:  rng.Float64() * 360,
+			TS:       time.Now().UnixMilli(),
+		}
+	}
+
+	addr := os.Getenv("BENCH_REDIS_ADDR")
+	if addr == "" {
+		b.Skip("BENCH_REDIS_ADDR not set")
+	}
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	defer rdb.Close()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		b.Fatalf("redis: %v", err)
+	}
+
+	// Prefijo propio para no tocar el índice real
+	prefix := fmt.Sprintf("geobench:%d", time.Now().UnixNano())
+	index := NewIndex(rdb, prefix, 5*time.Minute)
+	defer cleanupRedis(ctx, rdb, prefix)
+	for _, p := range positions {
+		if err := index.Update(ctx, p); err != nil {
+			b.Fatalf("update: %v", err)
+		}
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		for pb.Next() {
+			lat, lng := benchPoint(rng)
+			if _, _, err := index.Nearby(ctx, lat, lng, benchRadiusM, benchLimit); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func TestIndexNearby(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	ctx := context.Background()
+	index := NewIndex(rdb, "geo", time.Minute)
+
+	// d0..d4 a ~110 m uno de otro hacia el norte; far queda fuera del radio
+	const lat, lng = -12.0464, -77.0428
+	for i := 0; i < 5; i++ {
+		p := Position{DriverID: fmt.Sprintf("d%d", i), Lat: lat + float64(i)*0.001, Lng: lng, Speed: 5, Heading: 90, TS: 1}
+		if err := index.Update(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := index.Update(ctx, Position{DriverID: "far", Lat: lat + 0.1, Lng: lng}); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(found []Nearby) []string {
+		out := make([]string, len(found))
+		for i, n := range found {
+			out[i] = n.DriverID
+		}
+		return out
+	}
+
+	found, more, err := index.Nearby(ctx, lat, lng, 1000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(found); fmt.Sprint(got) != "[d0 d1 d2]" || !more {
+		t.Fatalf("Nearby(limit 3) = %v, more = %v; want [d0 d1 d2], more", got, more)
+	}
+	if found[1].Speed != 5 || found[1].Heading != 90 || found[1].DistanceM < 100 || found[1].DistanceM > 120 {
+		t.Errorf("d1 = %+v", found[1])
+	}
+
+	found, more, err = index.Nearby(ctx, lat, lng, 1000, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(found); len(got) != 5 || more {
+		t.Fatalf("Nearby(limit 10) = %v, more = %v; want the 5 drivers in the radius, no more", got, more)
+	}
+
+	// Un driver sin hash vigente ocupa su lugar en el GEO set pero no se
+	// devuelve, y se limpia al consultarlo
+	mr.Del("geo:driver:d1")
+	found, more, err = index.Nearby(ctx, lat, lng, 1000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(found); fmt.Sprint(got) != "[d0 d2]" || !more {
+		t.Fatalf("Nearby with an expired driver = %v, more = %v; want [d0 d2], more", got, more)
+	}
+	if members, _ := mr.ZMembers("geo:drivers"); len(members) != 5 {
+		t.Errorf("GEO set has %d members after cleanup, want 5", len(members))
+	}
+
+	if _, err := index.Get(ctx, "d1"); err != ErrNoPosition {
+		t.Errorf("Get(expired) = %v, want ErrNoPosition", err)
+	}
+}
+
+func benchPoint(rng *rand.Rand) (float64, float64) {
+	return benchMinLat + rng.Float64()*(benchMaxLat-benchMinLat),
+		benchMinLng + rng.Float64()*(benchMaxLng-benchMinLng)
+}
+
+func cleanupRedis(ctx context.Context, rdb *redis.Client, prefix string) {
+	iter := rdb.Scan(ctx, 0, prefix+":*", 1000).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == 1000 {
+			rdb.Del(ctx, keys...)
+			keys = keys[:0]
+		}
+	}
+	if len(keys) > 0 {
+		rdb.Del(ctx, keys...)
+	}
+}
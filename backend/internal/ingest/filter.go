@@ -0,0 +1,290 @@
+package ingest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/geo"
+)
+
+// Motivos de rechazo de un punto
+const (
+	RejectInvalidCoordinates = "invalid_coordinates"
+	RejectMissingTimestamp   = "missing_timestamp"
+	RejectOutOfBounds        = "out_of_bounds"
+	RejectFutureTimestamp    = "future_timestamp"
+	RejectStaleTimestamp     = "stale_timestamp"
+	RejectTeleport           = "teleport"
+)
+
+// maxConsecutiveJumps es cuántos saltos seguidos se rechazan antes de asumir
+// que el punto de referencia era el erróneo
+const maxConsecutiveJumps = 3
+
+var rejectReasons = []string{
+	RejectInvalidCoordinates,
+	RejectMissingTimestamp,
+	RejectOutOfBounds,
+	RejectFutureTimestamp,
+	RejectStaleTimestamp,
+	RejectTeleport,
+}
+
+// BBox es el área de servicio
+type BBox struct {
+	MinLat, MinLng, MaxLat, MaxLng float64
+}
+
+// Contains indica si el punto cae dentro del área
+func (b *BBox) Contains(lat, lng float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
+}
+
+// ParseBBox lee "minLat,minLng,maxLat,maxLng"; vacío devuelve nil (sin límite)
+func ParseBBox(value string) (*BBox, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox must be minLat,minLng,maxLat,maxLng")
+	}
+	var nums [4]float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bbox: %w", err)
+		}
+		nums[i] = n
+	}
+
+	b := &BBox{MinLat: nums[0], MinLng: nums[1], MaxLat: nums[2], MaxLng: nums[3]}
+	if b.MinLat >= b.MaxLat || b.MinLng >= b.MaxLng {
+		return nil, fmt.Errorf("bbox min must be lower than max")
+	}
+	return b, nil
+}
+
+// FilterConfig son los límites de cordura de una ubicación
+type FilterConfig struct {
+	// MaxSpeedMps es la velocidad máxima creíble entre dos puntos seguidos
+	MaxSpeedMps float64
+	// MaxClockSkew es cuánto puede adelantarse el reloj del teléfono
+	MaxClockSkew time.Duration
+	// MaxAge es la antigüedad máxima de un punto en vivo
+	MaxAge time.Duration
+	// MaxBufferedAge es la antigüedad máxima de un punto subido en lote
+	// (lo que el teléfono guardó sin cobertura)
+	MaxBufferedAge time.Duration
+	// Bounds es el área de servicio; nil no limita
+	Bounds *BBox
+}
+
+// DefaultFilterConfig: 120 km/h, 30 s de desfase, puntos en vivo de hasta 10
+// minutos y en lote de hasta 6 horas
+func DefaultFilterConfig() FilterConfig {
+	return FilterConfig{
+		MaxSpeedMps:    120 / 3.6,
+		MaxClockSkew:   30 * time.Second,
+		MaxAge:         10 * time.Minute,
+		MaxBufferedAge: 6 * time.Hour,
+	}
+}
+
+// Filter descarta puntos de GPS imposibles antes de publicarlos o guardarlos.
+// Recuerda el último punto aceptado de cada driver para detectar saltos.
+type Filter struct {
+	cfg FilterConfig
+
+	mu   sync.Mutex
+	last map[string]Point
+	// jumps cuenta saltos seguidos por driver: si el que saltó fue el punto de
+	// referencia, tras maxConsecutiveJumps se adopta la nueva posición
+	jumps map[string]int
+
+	rejected map[string]*atomic.Int64
+}
+
+func NewFilter(cfg FilterConfig) *Filter {
+	def := DefaultFilterConfig()
+	if cfg.MaxSpeedMps <= 0 {
+		cfg.MaxSpeedMps = def.MaxSpeedMps
+	}
+	if cfg.MaxClockSkew <= 0 {
+		cfg.MaxClockSkew = def.MaxClockSkew
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = def.MaxAge
+	}
+	if cfg.MaxBufferedAge < cfg.MaxAge {
+		cfg.MaxBufferedAge = max(def.MaxBufferedAge, cfg.MaxAge)
+	}
+
+	f := &Filter{
+		cfg:      cfg,
+		last:     make(map[string]Point),
+		jumps:    make(map[string]int),
+		rejected: make(map[string]*atomic.Int64, len(rejectReasons)),
+	}
+	for _, reason := range rejectReasons {
+		f.rejected[reason] = new(atomic.Int64)
+	}
+	return f
+}
+
+// Check valida el punto y devuelve el motivo de rechazo ("" si se acepta).
+// Un punto aceptado pasa a ser la referencia del driver.
+func (f *Filter) Check(p Point, now time.Time) string {
+	reason := f.check(p, now)
+	if reason != "" {
+		f.rejected[reason].Add(1)
+	}
+	return reason
+}
+
+func (f *Filter) check(p Point, now time.Time) string {
+	if reason := f.static(p, now, f.cfg.MaxAge); reason != "" {
+		return reason
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if prev, ok := f.last[p.DriverID]; ok {
+		if p.TS <= prev.TS {
+			// Punto atrasado respecto al último: no sirve para medir velocidad
+			// ni reemplaza la referencia
+			return ""
+		}
+		if f.jumped(prev, p) {
+			f.jumps[p.DriverID]++
+			if f.jumps[p.DriverID] < maxConsecutiveJumps {
+				return RejectTeleport
+			}
+		}
+	}
+	f.last[p.DriverID] = p
+	delete(f.jumps, p.DriverID)
+	return ""
+}
+
+// CheckTrack valida un tramo de puntos de un mismo driver ordenados por TS
+// (p. ej. lo que el teléfono guardó sin cobertura). La velocidad se mide
+// entre puntos consecutivos del tramo y la antigüedad contra MaxBufferedAge.
+// Devuelve el motivo de rechazo de cada punto ("" si se acepta).
+func (f *Filter) CheckTrack(points []Point, now time.Time) []string {
+	reasons := make([]string, len(points))
+	if len(points) == 0 {
+		return reasons
+	}
+	driverID := points[0].DriverID
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// La referencia en vivo sólo sirve si es anterior al tramo
+	prev, hasPrev := f.last[driverID]
+	if hasPrev && prev.TS >= points[0].TS {
+		hasPrev = false
+	}
+
+	jumps := 0
+	for i, p := range points {
+		reason := f.static(p, now, f.cfg.MaxBufferedAge)
+		if reason == "" && hasPrev && p.TS > prev.TS && f.jumped(prev, p) {
+			jumps++
+			if jumps < maxConsecutiveJumps {
+				reason = RejectTeleport
+			}
+		}
+		if reason != "" {
+			reasons[i] = reason
+			f.rejected[reason].Add(1)
+			continue
+		}
+		if !hasPrev || p.TS > prev.TS {
+			prev, hasPrev = p, true
+		}
+		jumps = 0
+	}
+
+	// El último punto aceptado pasa a ser la referencia si es más nuevo
+	if last, ok := f.last[driverID]; hasPrev && (!ok || prev.TS > last.TS) {
+		f.last[driverID] = prev
+		delete(f.jumps, driverID)
+	}
+	return reasons
+}
+
+// Fresh indica si el punto es lo bastante reciente para la vista en vivo
+func (f *Filter) Fresh(p Point, now time.Time) bool {
+	return !time.UnixMilli(p.TS).Before(now.Add(-f.cfg.MaxAge))
+}
+
+// static revisa lo que no depende de puntos anteriores
+func (f *Filter) static(p Point, now time.Time, maxAge time.Duration) string {
+	if p.Lat < -90 || p.Lat > 90 || p.Lng < -180 || p.Lng > 180 || (p.Lat == 0 && p.Lng == 0) {
+		return RejectInvalidCoordinates
+	}
+	if f.cfg.Bounds != nil && !f.cfg.Bounds.Contains(p.Lat, p.Lng) {
+		return RejectOutOfBounds
+	}
+	if p.TS <= 0 {
+		return RejectMissingTimestamp
+	}
+
+	ts := time.UnixMilli(p.TS)
+	if ts.After(now.Add(f.cfg.MaxClockSkew)) {
+		return RejectFutureTimestamp
+	}
+	if ts.Before(now.Add(-maxAge)) {
+		return RejectStaleTimestamp
+	}
+	return ""
+}
+
+// jumped indica si ir de prev a p exige una velocidad imposible
+func (f *Filter) jumped(prev, p Point) bool {
+	dt := float64(p.TS-prev.TS) / 1000
+	return geo.DistanceMeters(prev.Lat, prev.Lng, p.Lat, p.Lng)/dt > f.cfg.MaxSpeedMps
+}
+
+// Prune olvida las referencias más viejas que MaxAge, de drivers que dejaron
+// de reportar sin pasar a offline, y devuelve cuántas quitó
+func (f *Filter) Prune(now time.Time) int {
+	cutoff := now.Add(-f.cfg.MaxAge).UnixMilli()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for driverID, p := range f.last {
+		if p.TS < cutoff {
+			delete(f.last, driverID)
+			delete(f.jumps, driverID)
+			n++
+		}
+	}
+	return n
+}
+
+// Forget olvida la referencia del driver (p. ej. al pasar a offline)
+func (f *Filter) Forget(driverID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.last, driverID)
+	delete(f.jumps, driverID)
+}
+
+// Rejected devuelve el total de rechazos por motivo
+func (f *Filter) Rejected() map[string]int64 {
+	counts := make(map[string]int64, len(f.rejected))
+	for reason, n := range f.rejected {
+		counts[reason] = n.Load()
+	}
+	return counts
+}
@@ -0,0 +1,266 @@
+package ingest
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// Los fixtures parten de la Plaza de Armas de Lima; 0.001° de latitud son
+// ~111 m y 0.1° ~11 km, imposible de recorrer en 10 s a 120 km/h
+const (
+	baseLat = -12.0464
+	baseLng = -77.0428
+	near    = 0.001
+	far     = 0.1
+)
+
+var testNow = time.UnixMilli(1_700_000_000_000)
+
+// at es un punto del driver d1 desplazado dLat de la base, sec segundos
+// respecto de testNow
+func at(dLat float64, sec int) Point {
+	return Point{DriverID: "d1", Lat: baseLat + dLat, Lng: baseLng, TS: testNow.UnixMilli() + int64(sec)*1000}
+}
+
+func newTestFilter() *Filter {
+	cfg := DefaultFilterConfig()
+	cfg.Bounds = &BBox{MinLat: -12.55, MinLng: -77.25, MaxLat: -11.70, MaxLng: -76.75}
+	return NewFilter(cfg)
+}
+
+func TestFilterStatic(t *testing.T) {
+	tests := []struct {
+		name     string
+		point    Point
+		live     string
+		buffered string
+	}{
+		{"fresh", at(0, -5), "", ""},
+		{"invalid latitude", Point{DriverID: "d1", Lat: 91, Lng: baseLng, TS: at(0, 0).TS}, RejectInvalidCoordinates, RejectInvalidCoordinates},
+		{"null island", Point{DriverID: "d1", TS: at(0, 0).TS}, RejectInvalidCoordinates, RejectInvalidCoordinates},
+		{"outside bbox", Point{DriverID: "d1", Lat: -16.4, Lng: -71.5, TS: at(0, 0).TS}, RejectOutOfBounds, RejectOutOfBounds},
+		{"missing timestamp", Point{DriverID: "d1", Lat: baseLat, Lng: baseLng}, RejectMissingTimestamp, RejectMissingTimestamp},
+		{"within clock skew", at(0, 20), "", ""},
+		{"future", at(0, 60), RejectFutureTimestamp, RejectFutureTimestamp},
+		{"older than live max age", at(0, -15*60), RejectStaleTimestamp, ""},
+		{"older than buffered max age", at(0, -7*3600), RejectStaleTimestamp, RejectStaleTimestamp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newTestFilter().Check(tt.point, testNow); got != tt.live {
+				t.Errorf("Check = %q, want %q", got, tt.live)
+			}
+			if got := newTestFilter().CheckTrack([]Point{tt.point}, testNow); got[0] != tt.buffered {
+				t.Errorf("CheckTrack = %q, want %q", got[0], tt.buffered)
+			}
+		})
+	}
+}
+
+func TestFilterCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []Point
+		want   []string
+	}{
+		{
+			name:   "plausible movement",
+			points: []Point{at(0, -30), at(near, -20), at(2*near, -10)},
+			want:   []string{"", "", ""},
+		},
+		{
+			name:   "teleport rejected",
+			points: []Point{at(0, -30), at(far, -20), at(near, -10)},
+			want:   []string{"", RejectTeleport, ""},
+		},
+		{
+			// Tras maxConsecutiveJumps saltos se adopta la nueva posición y
+			// volver a la base pasa a ser el salto
+			name:   "reference adopted after consecutive jumps",
+			points: []Point{at(0, -50), at(far, -40), at(far, -30), at(far, -20), at(0, -10)},
+			want:   []string{"", RejectTeleport, RejectTeleport, "", RejectTeleport},
+		},
+		{
+			name:   "accepted point resets the jump count",
+			points: []Point{at(0, -50), at(far, -40), at(near, -30), at(far, -20), at(far, -10)},
+			want:   []string{"", RejectTeleport, "", RejectTeleport, RejectTeleport},
+		},
+		{
+			// El punto atrasado no se compara ni reemplaza la referencia: el
+			// siguiente se mide contra at(near, -20)
+			name:   "out of order point keeps the reference",
+			points: []Point{at(0, -30), at(near, -20), at(far, -25), at(2*near, -10)},
+			want:   []string{"", "", "", ""},
+		},
+		{
+			name:   "repeated timestamp",
+			points: []Point{at(0, -20), at(far, -20), at(near, -10)},
+			want:   []string{"", "", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFilter()
+			got := make([]string, len(tt.points))
+			for i, p := range tt.points {
+				got[i] = f.Check(p, testNow)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("reasons = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterCheckTrack(t *testing.T) {
+	tests := []struct {
+		name string
+		// live se pasa por Check antes del tramo
+		live  []Point
+		track []Point
+		want  []string
+		// after se pasa por Check después del tramo
+		after     []Point
+		wantAfter []string
+	}{
+		{
+			name:      "speed measured between track points",
+			track:     []Point{at(0, -200), at(near, -190), at(far, -180), at(2*near, -170)},
+			want:      []string{"", "", RejectTeleport, ""},
+			after:     []Point{at(3*near, -160)},
+			wantAfter: []string{""},
+		},
+		{
+			name:  "older live reference is used",
+			live:  []Point{at(0, -300)},
+			track: []Point{at(far, -290), at(near, -280)},
+			want:  []string{RejectTeleport, ""},
+		},
+		{
+			// La referencia en vivo es posterior al tramo: no sirve para medir
+			name:  "newer live reference is ignored",
+			live:  []Point{at(0, -60)},
+			track: []Point{at(far, -200), at(far, -190)},
+			want:  []string{"", ""},
+			// Y el tramo, más viejo, no la reemplaza
+			after:     []Point{at(near, -50), at(far, -40)},
+			wantAfter: []string{"", RejectTeleport},
+		},
+		{
+			// Los saltos en vivo no cuentan para el tramo: empieza en cero
+			name:      "jumps counted per track",
+			live:      []Point{at(0, -300), at(far, -290), at(far, -280)},
+			track:     []Point{at(far, -270), at(far, -260), at(far, -250)},
+			want:      []string{RejectTeleport, RejectTeleport, ""},
+			after:     []Point{at(far, -240)},
+			wantAfter: []string{""},
+		},
+		{
+			name:      "last accepted track point becomes the reference",
+			live:      []Point{at(0, -300)},
+			track:     []Point{at(near, -290), at(2*near, -280), at(far, -270)},
+			want:      []string{"", "", RejectTeleport},
+			after:     []Point{at(3*near, -260)},
+			wantAfter: []string{""},
+		},
+		{
+			name:  "empty track",
+			live:  []Point{at(0, -60)},
+			track: nil,
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFilter()
+			for _, p := range tt.live {
+				f.Check(p, testNow)
+			}
+			if got := f.CheckTrack(tt.track, testNow); !slices.Equal(got, tt.want) {
+				t.Errorf("CheckTrack = %q, want %q", got, tt.want)
+			}
+			for i, p := range tt.after {
+				if got := f.Check(p, testNow); got != tt.wantAfter[i] {
+					t.Errorf("Check after track #%d = %q, want %q", i, got, tt.wantAfter[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFilterRejectedCounts(t *testing.T) {
+	f := newTestFilter()
+	f.Check(at(0, -30), testNow)
+	f.Check(at(far, -20), testNow)
+	f.CheckTrack([]Point{at(0, 120), at(0, -7*3600)}, testNow)
+
+	got := f.Rejected()
+	want := map[string]int64{RejectTeleport: 1, RejectFutureTimestamp: 1, RejectStaleTimestamp: 1}
+	for _, reason := range rejectReasons {
+		if got[reason] != want[reason] {
+			t.Errorf("rejected[%s] = %d, want %d", reason, got[reason], want[reason])
+		}
+	}
+}
+
+func TestFilterPrune(t *testing.T) {
+	f := newTestFilter()
+	f.Check(at(0, 0), testNow)
+	f.Check(Point{DriverID: "d2", Lat: baseLat, Lng: baseLng, TS: at(0, 5*60).TS}, testNow.Add(5*time.Minute))
+
+	// d1 reportó hace 11 minutos, d2 hace 6
+	later := testNow.Add(11 * time.Minute)
+	if n := f.Prune(later); n != 1 {
+		t.Fatalf("Prune removed %d references, want 1", n)
+	}
+	f.mu.Lock()
+	_, d1 := f.last["d1"]
+	_, d2 := f.last["d2"]
+	f.mu.Unlock()
+	if d1 || !d2 {
+		t.Fatalf("after prune: d1 kept = %v, d2 kept = %v", d1, d2)
+	}
+
+	// Sin referencia, el siguiente punto de d1 no se compara con el viejo
+	if got := f.Check(at(far, 11*60), later); got != "" {
+		t.Errorf("Check after prune = %q, want accepted", got)
+	}
+}
+
+func TestParseBBox(t *testing.T) {
+	tests := []struct {
+		value string
+		want  *BBox
+		ok    bool
+	}{
+		{"", nil, true},
+		{"   ", nil, true},
+		{"-12.55,-77.25,-11.70,-76.75", &BBox{MinLat: -12.55, MinLng: -77.25, MaxLat: -11.70, MaxLng: -76.75}, true},
+		{" -12.55 , -77.25 , -11.70 , -76.75 ", &BBox{MinLat: -12.55, MinLng: -77.25, MaxLat: -11.70, MaxLng: -76.75}, true},
+		{"-12.55,-77.25,-11.70", nil, false},
+		{"-12.55,-77.25,-11.70,-76.75,0", nil, false},
+		{"-12.55,west,-11.70,-76.75", nil, false},
+		{"-11.70,-77.25,-12.55,-76.75", nil, false},
+		{"-12.55,-77.25,-12.55,-76.75", nil, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBBox(tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseBBox(%q) error = %v, want ok=%v", tt.value, err, tt.ok)
+			continue
+		}
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("ParseBBox(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+
+	b := &BBox{MinLat: -12.55, MinLng: -77.25, MaxLat: -11.70, MaxLng: -76.75}
+	if !b.Contains(baseLat, baseLng) || !b.Contains(-12.55, -76.75) || b.Contains(-13, baseLng) {
+		t.Error("Contains does not include the edges and exclude outside points")
+	}
+}
@@ -0,0 +1,271 @@
+// Package ingest persiste las ubicaciones de los drivers en lotes. Los puntos
+// entran a una cola acotada; unos pocos workers los agrupan y los escriben de
+// una vez. Bajo sobrecarga se submuestrea por driver y, si la cola se llena,
+// se descarta, contando cada caso.
+package ingest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Point es una ubicación de driver lista para guardar
+type Point struct {
+	DriverID string
+	Lat      float64
+	Lng      float64
+	Speed    float64
+	Heading  float64
+	TS       int64 // epoch en milisegundos
+	// Seq es el número de secuencia del dispositivo (0 = el cliente no lo envía)
+	Seq int64
+}
+
+// Writer escribe un lote de puntos
+type Writer interface {
+	WriteBatch(ctx context.Context, points []Point) error
+}
+
+// Config ajusta el tamaño de la cola y de los lotes
+type Config struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	Workers       int
+	// HighWatermark es la fracción de la cola (0-1) desde la que se
+	// submuestrea: se acepta como mucho un punto por driver cada DownsampleEvery
+	HighWatermark   float64
+	DownsampleEvery time.Duration
+	// WriteTimeout limita cada escritura de lote
+	WriteTimeout time.Duration
+}
+
+// DefaultConfig sirve para unos miles de drivers reportando cada 3-5 s
+func DefaultConfig() Config {
+	return Config{
+		QueueSize:       10000,
+		BatchSize:       500,
+		FlushInterval:   time.Second,
+		Workers:         2,
+		HighWatermark:   0.8,
+		DownsampleEvery: 5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+	}
+}
+
+// Stats son los contadores del pipeline desde que arrancó
+type Stats struct {
+	Accepted      int64 `json:"accepted"`
+	Downsampled   int64 `json:"downsampled"`
+	DroppedFull   int64 `json:"dropped_full"`
+	DroppedClosed int64 `json:"dropped_closed"`
+	Written       int64 `json:"written"`
+	Batches       int64 `json:"batches"`
+	WriteErrors   int64 `json:"write_errors"`
+	LostOnError   int64 `json:"lost_on_error"`
+	QueueDepth    int   `json:"queue_depth"`
+	QueueCapacity int   `json:"queue_capacity"`
+}
+
+// Pipeline es la cola acotada con sus workers
+type Pipeline struct {
+	cfg    Config
+	writer Writer
+	log    *logrus.Logger
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan Point
+	wg     sync.WaitGroup
+
+	// lastAccepted guarda, por driver, cuándo se aceptó su último punto
+	lastAccepted sync.Map
+
+	accepted      atomic.Int64
+	downsampled   atomic.Int64
+	droppedFull   atomic.Int64
+	droppedClosed atomic.Int64
+	written       atomic.Int64
+	batches       atomic.Int64
+	writeErrors   atomic.Int64
+	lostOnError   atomic.Int64
+}
+
+// New crea el pipeline y arranca sus workers
+func New(cfg Config, writer Writer, log *logrus.Logger) *Pipeline {
+	def := DefaultConfig()
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = def.QueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = def.BatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = def.FlushInterval
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = def.Workers
+	}
+	if cfg.HighWatermark <= 0 || cfg.HighWatermark > 1 {
+		cfg.HighWatermark = def.HighWatermark
+	}
+	if cfg.DownsampleEvery <= 0 {
+		cfg.DownsampleEvery = def.DownsampleEvery
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = def.WriteTimeout
+	}
+
+	p := &Pipeline{
+		cfg:    cfg,
+		writer: writer,
+		log:    log,
+		queue:  make(chan Point, cfg.QueueSize),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+	return p
+}
+
+// Submit encola un punto sin bloquear. Devuelve false si se descartó.
+func (p *Pipeline) Submit(pt Point) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.droppedClosed.Add(1)
+		return false
+	}
+
+	now := time.Now().UnixNano()
+	if float64(len(p.queue)) >= p.cfg.HighWatermark*float64(cap(p.queue)) {
+		if last, ok := p.lastAccepted.Load(pt.DriverID); ok && now-last.(int64) < int64(p.cfg.DownsampleEvery) {
+			p.downsampled.Add(1)
+			return false
+		}
+	}
+
+	select {
+	case p.queue <- pt:
+		p.lastAccepted.Store(pt.DriverID, now)
+		p.accepted.Add(1)
+		return true
+	default:
+		p.droppedFull.Add(1)
+		return false
+	}
+}
+
+// Prune olvida cuándo se aceptó el último punto de los drivers que no
+// reportan hace más de DownsampleEvery (ya no se submuestrearían) y devuelve
+// cuántos quitó
+func (p *Pipeline) Prune(now time.Time) int {
+	cutoff := now.UnixNano() - int64(p.cfg.DownsampleEvery)
+	n := 0
+	p.lastAccepted.Range(func(driverID, last any) bool {
+		if last.(int64) <= cutoff {
+			p.lastAccepted.CompareAndDelete(driverID, last)
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// Stats devuelve una foto de los contadores
+func (p *Pipeline) Stats() Stats {
+	return Stats{
+		Accepted:      p.accepted.Load(),
+		Downsampled:   p.downsampled.Load(),
+		DroppedFull:   p.droppedFull.Load(),
+		DroppedClosed: p.droppedClosed.Load(),
+		Written:       p.written.Load(),
+		Batches:       p.batches.Load(),
+		WriteErrors:   p.writeErrors.Load(),
+		LostOnError:   p.lostOnError.Load(),
+		QueueDepth:    len(p.queue),
+		QueueCapacity: cap(p.queue),
+	}
+}
+
+// Close deja de aceptar puntos y espera a que los workers escriban lo que
+// queda en la cola, o a que ctx venza
+func (p *Pipeline) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pipeline) worker() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Point, 0, p.cfg.BatchSize)
+	for {
+		select {
+		case pt, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, pt)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+func (p *Pipeline) flush(batch []Point) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.WriteTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := p.writer.WriteBatch(ctx, batch); err != nil {
+		p.writeErrors.Add(1)
+		p.lostOnError.Add(int64(len(batch)))
+		p.log.WithError(err).WithField("points", len(batch)).Error("Failed to write location batch")
+		return
+	}
+
+	p.batches.Add(1)
+	p.written.Add(int64(len(batch)))
+	p.log.WithFields(logrus.Fields{
+		"points":   len(batch),
+		"duration": time.Since(start).String(),
+	}).Debug("Location batch written")
+}
@@ -0,0 +1,267 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeSink guarda los lotes escritos. Con gate, cada escritura avisa en
+// entered y espera a que se cierre gate; failures hace fallar las primeras.
+type fakeSink struct {
+	mu       sync.Mutex
+	batches  [][]Point
+	failures int
+	gate     chan struct{}
+	entered  chan struct{}
+}
+
+func (f *fakeSink) WriteBatch(ctx context.Context, points []Point) error {
+	if f.gate != nil {
+		f.entered <- struct{}{}
+		<-f.gate
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("database unavailable")
+	}
+	f.batches = append(f.batches, append([]Point(nil), points...))
+	return nil
+}
+
+func (f *fakeSink) sizes() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sizes := make([]int, len(f.batches))
+	for i, b := range f.batches {
+		sizes[i] = len(b)
+	}
+	return sizes
+}
+
+func (f *fakeSink) written() int {
+	n := 0
+	for _, size := range f.sizes() {
+		n += size
+	}
+	return n
+}
+
+// blockedSink deja la única escritura en curso trabada hasta que se llame a
+// release, para llenar la cola sin que el worker la vacíe
+func blockedSink() (*fakeSink, func()) {
+	sink := &fakeSink{gate: make(chan struct{}), entered: make(chan struct{}, 100)}
+	var once sync.Once
+	return sink, func() { once.Do(func() { close(sink.gate) }) }
+}
+
+func newTestPipeline(t *testing.T, cfg Config, sink Writer) *Pipeline {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	p := New(cfg, sink, log)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		p.Close(ctx)
+	})
+	return p
+}
+
+func point(driver int) Point {
+	return Point{DriverID: fmt.Sprintf("d%d", driver), Lat: -12.0464, Lng: -77.0428, TS: time.Now().UnixMilli()}
+}
+
+func TestPipelineBatches(t *testing.T) {
+	sink := &fakeSink{}
+	p := newTestPipeline(t, Config{BatchSize: 3, FlushInterval: time.Hour, Workers: 1}, sink)
+
+	for i := 0; i < 7; i++ {
+		if !p.Submit(point(i)) {
+			t.Fatalf("point %d dropped", i)
+		}
+	}
+	// Los lotes llenos salen sin esperar el intervalo; el resto al cerrar
+	waitFor(t, func() bool { return sink.written() == 6 })
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(sink.sizes()); got != "[3 3 1]" {
+		t.Errorf("batch sizes = %s, want [3 3 1]", got)
+	}
+	stats := p.Stats()
+	if stats.Accepted != 7 || stats.Written != 7 || stats.Batches != 3 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPipelineFlushInterval(t *testing.T) {
+	sink := &fakeSink{}
+	p := newTestPipeline(t, Config{BatchSize: 100, FlushInterval: 10 * time.Millisecond, Workers: 1}, sink)
+
+	p.Submit(point(1))
+	p.Submit(point(2))
+	waitFor(t, func() bool { return sink.written() == 2 })
+}
+
+func TestPipelineFlushOnClose(t *testing.T) {
+	sink := &fakeSink{}
+	p := newTestPipeline(t, Config{BatchSize: 1000, FlushInterval: time.Hour, Workers: 2}, sink)
+
+	for i := 0; i < 250; i++ {
+		p.Submit(point(i))
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if sink.written() != 250 {
+		t.Fatalf("written %d points on close, want 250", sink.written())
+	}
+
+	if p.Submit(point(1)) {
+		t.Error("Submit accepted a point after Close")
+	}
+	if stats := p.Stats(); stats.DroppedClosed != 1 || stats.Written != 250 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPipelineCloseTimeout(t *testing.T) {
+	sink, release := blockedSink()
+	defer release()
+	p := newTestPipeline(t, Config{BatchSize: 1, FlushInterval: time.Hour, Workers: 1}, sink)
+
+	p.Submit(point(1))
+	<-sink.entered
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close with a stuck write = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestPipelineDropOnFull(t *testing.T) {
+	sink, release := blockedSink()
+	defer release()
+	// Sin submuestreo: la marca alta es la cola llena
+	p := newTestPipeline(t, Config{QueueSize: 2, BatchSize: 1, FlushInterval: time.Hour, Workers: 1, HighWatermark: 1}, sink)
+
+	p.Submit(point(0))
+	<-sink.entered // el worker quedó escribiendo ese punto
+	for i := 1; i <= 2; i++ {
+		if !p.Submit(point(i)) {
+			t.Fatalf("point %d dropped with room in the queue", i)
+		}
+	}
+	for i := 3; i <= 5; i++ {
+		if p.Submit(point(i)) {
+			t.Fatalf("point %d accepted with the queue full", i)
+		}
+	}
+	if stats := p.Stats(); stats.DroppedFull != 3 || stats.Accepted != 3 || stats.QueueDepth != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	release()
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if sink.written() != 3 {
+		t.Errorf("written %d points, want the 3 accepted", sink.written())
+	}
+}
+
+func TestPipelineDownsample(t *testing.T) {
+	sink, release := blockedSink()
+	defer release()
+	p := newTestPipeline(t, Config{
+		QueueSize:       10,
+		BatchSize:       1,
+		FlushInterval:   time.Hour,
+		Workers:         1,
+		HighWatermark:   0.5,
+		DownsampleEvery: time.Hour,
+	}, sink)
+
+	p.Submit(point(0))
+	<-sink.entered
+	// Bajo la marca alta se acepta todo, aunque repita driver
+	for i := 0; i < 5; i++ {
+		if !p.Submit(point(1)) {
+			t.Fatalf("point %d dropped below the watermark", i)
+		}
+	}
+	// Sobre la marca, un driver que acaba de reportar se submuestrea y uno
+	// nuevo entra
+	if p.Submit(point(1)) {
+		t.Error("repeated driver accepted above the watermark")
+	}
+	if !p.Submit(point(2)) {
+		t.Error("new driver dropped above the watermark")
+	}
+	if p.Submit(point(2)) {
+		t.Error("second point of the new driver accepted above the watermark")
+	}
+
+	// Olvidado el último punto, el driver vuelve a entrar
+	if n := p.Prune(time.Now().Add(time.Hour)); n != 3 {
+		t.Errorf("Prune removed %d drivers, want 3", n)
+	}
+	if !p.Submit(point(1)) {
+		t.Error("pruned driver still downsampled")
+	}
+
+	if stats := p.Stats(); stats.Downsampled != 2 || stats.Accepted != 8 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPipelinePrune(t *testing.T) {
+	p := newTestPipeline(t, Config{FlushInterval: time.Hour, DownsampleEvery: time.Minute}, &fakeSink{})
+
+	p.Submit(point(1))
+	p.Submit(point(2))
+	if n := p.Prune(time.Now()); n != 0 {
+		t.Errorf("Prune removed %d recent drivers", n)
+	}
+	if n := p.Prune(time.Now().Add(time.Minute)); n != 2 {
+		t.Errorf("Prune removed %d drivers, want 2", n)
+	}
+	if n := p.Prune(time.Now().Add(time.Minute)); n != 0 {
+		t.Errorf("second Prune removed %d drivers", n)
+	}
+}
+
+func TestPipelineWriteError(t *testing.T) {
+	sink := &fakeSink{failures: 1}
+	p := newTestPipeline(t, Config{BatchSize: 2, FlushInterval: time.Hour, Workers: 1}, sink)
+
+	for i := 0; i < 4; i++ {
+		p.Submit(point(i))
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	stats := p.Stats()
+	if stats.WriteErrors != 1 || stats.LostOnError != 2 || stats.Written != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,84 @@
+package ingest
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// stageColumns son las columnas de la tabla temporal que recibe el COPY;
+// locations usa geography, que COPY binario no sabe codificar, así que los
+// puntos se copian como lat/lng y se convierten en un solo INSERT ... SELECT
+var stageColumns = []string{"driver_id", "lat", "lng", "speed", "heading", "ts_ms", "seq"}
+
+// PostgresWriter escribe lotes en locations usando COPY
+type PostgresWriter struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresWriter(db *pgxpool.Pool) *PostgresWriter {
+	return &PostgresWriter{db: db}
+}
+
+func (w *PostgresWriter) WriteBatch(ctx context.Context, points []Point) error {
+	return pgx.BeginFunc(ctx, w.db, func(tx pgx.Tx) error {
+		_, err := InsertPoints(ctx, tx, points)
+		return err
+	})
+}
+
+// InsertPoints copia los puntos a locations dentro de la transacción y
+// devuelve cuántos se insertaron (los reenvíos ya guardados no cuentan)
+func InsertPoints(ctx context.Context, tx pgx.Tx, points []Point) (int64, error) {
+	_, err := tx.Exec(ctx, `
+		CREATE TEMP TABLE IF NOT EXISTS locations_stage (
+			driver_id UUID,
+			lat DOUBLE PRECISION,
+			lng DOUBLE PRECISION,
+			speed DOUBLE PRECISION,
+			heading DOUBLE PRECISION,
+			ts_ms BIGINT,
+			seq BIGINT
+		) ON COMMIT DELETE ROWS
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"locations_stage"}, stageColumns,
+		pgx.CopyFromSlice(len(points), func(i int) ([]any, error) {
+			p := points[i]
+			var driverID pgtype.UUID
+			if err := driverID.Scan(p.DriverID); err != nil {
+				return nil, err
+			}
+			var seq pgtype.Int8
+			if p.Seq > 0 {
+				seq = pgtype.Int8{Int64: p.Seq, Valid: true}
+			}
+			return []any{driverID, p.Lat, p.Lng, p.Speed, p.Heading, p.TS, seq}, nil
+		}))
+	if err != nil {
+		return 0, err
+	}
+
+	// Los reenvíos ya guardados chocan con idx_locations_driver_seq y se ignoran
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO locations (driver_id, geom, speed, heading, ts, seq)
+		SELECT
+			driver_id,
+			ST_SetSRID(ST_MakePoint(lng, lat)::geometry, 4326)::geography,
+			speed,
+			heading,
+			to_timestamp(ts_ms / 1000.0),
+			seq
+		FROM locations_stage
+		ON CONFLICT DO NOTHING
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,81 @@
+package ingest
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// SeqResult clasifica un punto según su número de secuencia
+type SeqResult int
+
+const (
+	// SeqLatest es el punto más nuevo del driver: va a la vista en vivo y se guarda
+	SeqLatest SeqResult = iota
+	// SeqLate llegó después de uno más nuevo (reenvío tras reconectar): sólo se guarda
+	SeqLate
+	// SeqDuplicate repite el seq y ts de un punto reciente: se descarta
+	SeqDuplicate
+)
+
+// seqWindow es cuántos puntos recientes (seq, ts) se recuerdan por driver para
+// reconocer reenvíos: unos 4 minutos a un punto por segundo. Un reenvío más
+// viejo cuenta como atrasado y lo descarta el índice único de locations.
+const seqWindow = 256
+
+// seqScript registra el punto en la ventana de puntos recientes del driver
+// (sorted set por ts) y lo compara con el último aceptado. Un punto es más
+// nuevo si su ts es mayor, o si con el mismo ts trae un seq mayor; así un seq
+// menor con ts más nuevo (el teléfono reinició su contador) cuenta como más
+// nuevo, y un reenvío de antes del reinicio, aunque tenga un seq mayor, como
+// atrasado. Devuelve {resultado, último seq}.
+var seqScript = redis.NewScript(`
+local last = redis.call('HMGET', KEYS[1], 'seq', 'ts')
+local seq = tonumber(ARGV[1])
+local ts = tonumber(ARGV[2])
+local lastSeq = tonumber(last[1])
+local lastTS = tonumber(last[2])
+
+local id = ARGV[1] .. ':' .. ARGV[2]
+if redis.call('ZSCORE', KEYS[2], id) then
+	return {2, lastSeq or seq}
+end
+redis.call('ZADD', KEYS[2], ts, id)
+local extra = redis.call('ZCARD', KEYS[2]) - tonumber(ARGV[4])
+if extra > 0 then
+	redis.call('ZREMRANGEBYRANK', KEYS[2], 0, extra - 1)
+end
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+
+if lastSeq == nil or ts > lastTS or (ts == lastTS and seq > lastSeq) then
+	redis.call('HSET', KEYS[1], 'seq', ARGV[1], 'ts', ARGV[2])
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	return {0, seq}
+end
+return {1, lastSeq}
+`)
+
+// SeqTracker guarda en Redis el último seq aceptado de cada driver y sus
+// puntos recientes para que todas las instancias coincidan aunque el driver
+// reconecte a otra
+type SeqTracker struct {
+	rdb    *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewSeqTracker crea el tracker; ttl es cuánto se recuerda a un driver inactivo
+func NewSeqTracker(rdb *redis.Client, prefix string, ttl time.Duration) *SeqTracker {
+	return &SeqTracker{rdb: rdb, prefix: prefix + ":", ttl: ttl}
+}
+
+// Track clasifica el punto y devuelve el último seq aceptado del driver
+func (t *SeqTracker) Track(ctx context.Context, p Point) (SeqResult, int64, error) {
+	keys := []string{t.prefix + p.DriverID, t.prefix + p.DriverID + ":recent"}
+	res, err := seqScript.Run(ctx, t.rdb, keys, p.Seq, p.TS, t.ttl.Milliseconds(), seqWindow).Int64Slice()
+	if err != nil {
+		return SeqLatest, 0, err
+	}
+	return SeqResult(res[0]), res[1], nil
+}
@@ -0,0 +1,138 @@
+package ingest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestSeqTracker(t *testing.T) (*SeqTracker, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewSeqTracker(rdb, "locseq", time.Hour), mr
+}
+
+// seqPoint es el punto seq del driver d1 tomado sec segundos después de testNow
+func seqPoint(seq int64, sec int) Point {
+	p := at(0, sec)
+	p.Seq = seq
+	return p
+}
+
+func TestSeqTrackerTrack(t *testing.T) {
+	type step struct {
+		point   Point
+		want    SeqResult
+		lastSeq int64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "in order",
+			steps: []step{
+				{seqPoint(1, 0), SeqLatest, 1},
+				{seqPoint(2, 1), SeqLatest, 2},
+				{seqPoint(3, 2), SeqLatest, 3},
+			},
+		},
+		{
+			name: "late replay is archived once",
+			steps: []step{
+				{seqPoint(1, 0), SeqLatest, 1},
+				{seqPoint(3, 2), SeqLatest, 3},
+				{seqPoint(2, 1), SeqLate, 3},
+				{seqPoint(2, 1), SeqDuplicate, 3},
+			},
+		},
+		{
+			name: "duplicate of the latest",
+			steps: []step{
+				{seqPoint(1, 0), SeqLatest, 1},
+				{seqPoint(1, 0), SeqDuplicate, 1},
+			},
+		},
+		{
+			// Antes se reportaba como atrasado y se volvía a archivar
+			name: "older replay is a duplicate",
+			steps: []step{
+				{seqPoint(1, 0), SeqLatest, 1},
+				{seqPoint(2, 1), SeqLatest, 2},
+				{seqPoint(3, 2), SeqLatest, 3},
+				{seqPoint(1, 0), SeqDuplicate, 3},
+				{seqPoint(2, 1), SeqDuplicate, 3},
+			},
+		},
+		{
+			name: "same seq with another ts",
+			steps: []step{
+				{seqPoint(5, 0), SeqLatest, 5},
+				{seqPoint(5, 1), SeqLatest, 5},
+			},
+		},
+		{
+			name: "counter reset",
+			steps: []step{
+				{seqPoint(100, 0), SeqLatest, 100},
+				{seqPoint(101, 1), SeqLatest, 101},
+				// Reinstalación: el contador vuelve a 1 con ts más nuevo
+				{seqPoint(1, 10), SeqLatest, 1},
+				{seqPoint(2, 11), SeqLatest, 2},
+				// Un reenvío de antes del reinicio tiene seq mayor pero es viejo
+				{seqPoint(102, 2), SeqLate, 2},
+				{seqPoint(101, 1), SeqDuplicate, 2},
+				{seqPoint(1, 10), SeqDuplicate, 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, _ := newTestSeqTracker(t)
+			for i, st := range tt.steps {
+				got, lastSeq, err := tracker.Track(context.Background(), st.point)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != st.want || lastSeq != st.lastSeq {
+					t.Errorf("step %d (seq %d): Track = %d, last %d; want %d, last %d",
+						i, st.point.Seq, got, lastSeq, st.want, st.lastSeq)
+				}
+			}
+		})
+	}
+}
+
+func TestSeqTrackerWindow(t *testing.T) {
+	tracker, mr := newTestSeqTracker(t)
+	ctx := context.Background()
+
+	for seq := int64(1); seq <= seqWindow+10; seq++ {
+		if res, _, err := tracker.Track(ctx, seqPoint(seq, int(seq))); err != nil || res != SeqLatest {
+			t.Fatalf("seq %d: Track = %d, %v", seq, res, err)
+		}
+	}
+	if members, _ := mr.ZMembers("locseq:d1:recent"); len(members) != seqWindow {
+		t.Fatalf("window holds %d points, want %d", len(members), seqWindow)
+	}
+
+	// Lo que salió de la ventana ya no se reconoce: queda como atrasado y lo
+	// descarta el índice único al guardarlo
+	if res, _, _ := tracker.Track(ctx, seqPoint(5, 5)); res != SeqLate {
+		t.Errorf("replay older than the window: Track = %d, want SeqLate", res)
+	}
+	if res, _, _ := tracker.Track(ctx, seqPoint(seqWindow, seqWindow)); res != SeqDuplicate {
+		t.Errorf("replay inside the window: Track = %d, want SeqDuplicate", res)
+	}
+
+	// Un driver inactivo se olvida a los ttl
+	mr.FastForward(time.Hour)
+	if res, lastSeq, _ := tracker.Track(ctx, seqPoint(1, 0)); res != SeqLatest || lastSeq != 1 {
+		t.Errorf("after the ttl: Track = %d, last %d; want SeqLatest, last 1", res, lastSeq)
+	}
+}
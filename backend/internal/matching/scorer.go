@@ -0,0 +1,188 @@
+// Package matching puntúa a los drivers candidatos para un viaje. La búsqueda
+// de drivers cercanos y el dispatcher ordenan con el mismo Scorer, así lo que
+// ve el pasajero coincide con a quién se ofrece el viaje.
+package matching
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/criston04/TaxyTac/backend/internal/geo"
+)
+
+// Escalas con las que cada factor se lleva a [0, 1]
+const (
+	// distanceScaleM: a esta distancia el factor de distancia vale 0.5
+	distanceScaleM = 1000.0
+	// etaScaleS: a este ETA el factor de ETA vale 0.5
+	etaScaleS = 300.0
+	// idleCapS: tras media hora esperando el factor de espera ya es máximo
+	idleCapS = 1800.0
+	// unratedScore es el factor de rating de un driver aún sin calificar (≈ 4★)
+	unratedScore = 0.8
+	// minMovingSpeedMps: por debajo el rumbo no es confiable
+	minMovingSpeedMps = 1.0
+)
+
+// Request es el viaje para el que se buscan drivers
+type Request struct {
+	OriginLat float64
+	OriginLng float64
+}
+
+// Candidate es un driver disponible con lo que se sabe de él
+type Candidate struct {
+	DriverID  string
+	Lat       float64
+	Lng       float64
+	DistanceM float64
+	ETAS      float64
+	Speed     float64 // m/s
+	Heading   float64 // grados
+	// Rating va de 0 a 5; 0 es sin calificar
+	Rating float64
+	// AcceptanceRate va de 0 a 1
+	AcceptanceRate float64
+	// IdleS son los segundos desde que el driver quedó libre
+	IdleS float64
+}
+
+// Scorer da un puntaje a un candidato para el viaje; mayor es mejor
+type Scorer interface {
+	Score(req Request, c Candidate) float64
+}
+
+// Tunable es un Scorer con pesos que se pueden cambiar en caliente
+type Tunable interface {
+	Scorer
+	Weights() Weights
+	SetWeights(w Weights) error
+}
+
+// Weights es el peso de cada factor en WeightedScorer. Sólo importa la
+// proporción entre ellos; con todo en cero salvo Distance se ordena por cercanía.
+type Weights struct {
+	Distance   float64 `json:"distance"`
+	ETA        float64 `json:"eta"`
+	Rating     float64 `json:"rating"`
+	Acceptance float64 `json:"acceptance"`
+	Idle       float64 `json:"idle"`
+	Heading    float64 `json:"heading"`
+}
+
+// DefaultWeights prioriza llegar rápido sin ignorar la calidad del driver
+func DefaultWeights() Weights {
+	return Weights{
+		Distance:   0.30,
+		ETA:        0.30,
+		Rating:     0.10,
+		Acceptance: 0.15,
+		Idle:       0.10,
+		Heading:    0.05,
+	}
+}
+
+var errInvalidWeights = errors.New("weights must be non-negative and at least one must be positive")
+
+// Validate exige pesos no negativos con al menos uno positivo
+func (w Weights) Validate() error {
+	values := []float64{w.Distance, w.ETA, w.Rating, w.Acceptance, w.Idle, w.Heading}
+	total := 0.0
+	for _, v := range values {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return errInvalidWeights
+		}
+		total += v
+	}
+	if total == 0 {
+		return errInvalidWeights
+	}
+	return nil
+}
+
+func (w Weights) total() float64 {
+	return w.Distance + w.ETA + w.Rating + w.Acceptance + w.Idle + w.Heading
+}
+
+// WeightedScorer es el promedio ponderado de los factores, entre 0 y 1. Los
+// pesos se pueden cambiar en caliente.
+type WeightedScorer struct {
+	mu      sync.RWMutex
+	weights Weights
+}
+
+// NewWeightedScorer usa DefaultWeights si los pesos no son válidos
+func NewWeightedScorer(w Weights) *WeightedScorer {
+	if w.Validate() != nil {
+		w = DefaultWeights()
+	}
+	return &WeightedScorer{weights: w}
+}
+
+// Weights devuelve los pesos en uso
+func (s *WeightedScorer) Weights() Weights {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.weights
+}
+
+// SetWeights reemplaza los pesos
+func (s *WeightedScorer) SetWeights(w Weights) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.weights = w
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *WeightedScorer) Score(req Request, c Candidate) float64 {
+	w := s.Weights()
+	score := w.Distance*DistanceFactor(c.DistanceM) +
+		w.ETA*ETAFactor(c.ETAS) +
+		w.Rating*RatingFactor(c.Rating) +
+		w.Acceptance*clamp01(c.AcceptanceRate) +
+		w.Idle*IdleFactor(c.IdleS) +
+		w.Heading*HeadingFactor(req, c)
+	return score / w.total()
+}
+
+// DistanceFactor decae con la distancia al punto de recojo
+func DistanceFactor(distanceM float64) float64 {
+	return 1 / (1 + math.Max(distanceM, 0)/distanceScaleM)
+}
+
+// ETAFactor decae con el tiempo estimado de llegada
+func ETAFactor(etaS float64) float64 {
+	return 1 / (1 + math.Max(etaS, 0)/etaScaleS)
+}
+
+// RatingFactor lleva la calificación a [0, 1]
+func RatingFactor(rating float64) float64 {
+	if rating <= 0 {
+		return unratedScore
+	}
+	return clamp01(rating / 5)
+}
+
+// IdleFactor favorece al que lleva más tiempo esperando, hasta idleCapS
+func IdleFactor(idleS float64) float64 {
+	return clamp01(idleS / idleCapS)
+}
+
+// HeadingFactor vale 1 si el driver avanza hacia el recojo, 0 si se aleja y
+// 0.5 si está detenido
+func HeadingFactor(req Request, c Candidate) float64 {
+	if c.Speed < minMovingSpeedMps {
+		return 0.5
+	}
+	bearing := geo.BearingDegrees(c.Lat, c.Lng, req.OriginLat, req.OriginLng)
+	delta := (c.Heading - bearing) * math.Pi / 180
+	return (1 + math.Cos(delta)) / 2
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,231 @@
+package matching
+
+import (
+	"math"
+	"testing"
+)
+
+// origin es el punto de recojo de los fixtures (Plaza de Armas de Lima)
+var origin = Request{OriginLat: -12.0464, OriginLng: -77.0428}
+
+// baseCandidate es un driver neutro a ~1 km al sur del recojo; cada caso
+// cambia un solo dato
+func baseCandidate() Candidate {
+	return Candidate{
+		DriverID:       "base",
+		Lat:            -12.0554,
+		Lng:            -77.0428,
+		DistanceM:      1000,
+		ETAS:           200,
+		Speed:          0,
+		Heading:        0,
+		Rating:         4,
+		AcceptanceRate: 0.5,
+		IdleS:          600,
+	}
+}
+
+func TestWeightedScorerFactors(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights Weights
+		better  func(*Candidate)
+		worse   func(*Candidate)
+	}{
+		{
+			name:    "distance",
+			weights: Weights{Distance: 1},
+			better:  func(c *Candidate) { c.DistanceM = 200 },
+			worse:   func(c *Candidate) { c.DistanceM = 2500 },
+		},
+		{
+			name:    "eta",
+			weights: Weights{ETA: 1},
+			better:  func(c *Candidate) { c.ETAS = 60 },
+			worse:   func(c *Candidate) { c.ETAS = 900 },
+		},
+		{
+			name:    "rating",
+			weights: Weights{Rating: 1},
+			better:  func(c *Candidate) { c.Rating = 4.9 },
+			worse:   func(c *Candidate) { c.Rating = 3.2 },
+		},
+		{
+			name:    "acceptance",
+			weights: Weights{Acceptance: 1},
+			better:  func(c *Candidate) { c.AcceptanceRate = 0.95 },
+			worse:   func(c *Candidate) { c.AcceptanceRate = 0.2 },
+		},
+		{
+			name:    "idle",
+			weights: Weights{Idle: 1},
+			better:  func(c *Candidate) { c.IdleS = 1500 },
+			worse:   func(c *Candidate) { c.IdleS = 30 },
+		},
+		{
+			// El driver está al sur del recojo: rumbo 0° es ir hacia él
+			name:    "heading",
+			weights: Weights{Heading: 1},
+			better:  func(c *Candidate) { c.Speed, c.Heading = 8, 0 },
+			worse:   func(c *Candidate) { c.Speed, c.Heading = 8, 180 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			better, worse := baseCandidate(), baseCandidate()
+			tt.better(&better)
+			tt.worse(&worse)
+
+			// Sólo con su peso el factor decide el orden
+			s := NewWeightedScorer(tt.weights)
+			if b, w := s.Score(origin, better), s.Score(origin, worse); b <= w {
+				t.Errorf("only %s: better scored %.4f, worse %.4f", tt.name, b, w)
+			}
+
+			// Con los pesos por defecto también, porque el resto es igual
+			s = NewWeightedScorer(DefaultWeights())
+			if b, w := s.Score(origin, better), s.Score(origin, worse); b <= w {
+				t.Errorf("default weights: better scored %.4f, worse %.4f", b, w)
+			}
+
+			// Sin su peso el factor no cuenta
+			others := DefaultWeights()
+			switch tt.name {
+			case "distance":
+				others.Distance = 0
+			case "eta":
+				others.ETA = 0
+			case "rating":
+				others.Rating = 0
+			case "acceptance":
+				others.Acceptance = 0
+			case "idle":
+				others.Idle = 0
+			case "heading":
+				others.Heading = 0
+			}
+			s = NewWeightedScorer(others)
+			if b, w := s.Score(origin, better), s.Score(origin, worse); !almostEqual(b, w) {
+				t.Errorf("without %s weight: better scored %.4f, worse %.4f", tt.name, b, w)
+			}
+		})
+	}
+}
+
+func TestFactorFixtures(t *testing.T) {
+	north := Candidate{Lat: -12.0554, Lng: -77.0428, Speed: 8}
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"distance at pickup", DistanceFactor(0), 1},
+		{"distance at scale", DistanceFactor(distanceScaleM), 0.5},
+		{"distance 3 km", DistanceFactor(3000), 0.25},
+		{"negative distance", DistanceFactor(-10), 1},
+		{"eta zero", ETAFactor(0), 1},
+		{"eta at scale", ETAFactor(etaScaleS), 0.5},
+		{"eta 15 min", ETAFactor(900), 0.25},
+		{"unrated", RatingFactor(0), unratedScore},
+		{"rating 5", RatingFactor(5), 1},
+		{"rating 4", RatingFactor(4), 0.8},
+		{"rating above 5", RatingFactor(7), 1},
+		{"just freed", IdleFactor(0), 0},
+		{"idle 15 min", IdleFactor(900), 0.5},
+		{"idle over cap", IdleFactor(7200), 1},
+		{"heading towards", HeadingFactor(origin, withHeading(north, 0)), 1},
+		{"heading away", HeadingFactor(origin, withHeading(north, 180)), 0},
+		{"heading sideways", HeadingFactor(origin, withHeading(north, 90)), 0.5},
+		{"stopped", HeadingFactor(origin, Candidate{Lat: -12.0554, Lng: -77.0428, Speed: 0.5, Heading: 180}), 0.5},
+	}
+
+	for _, tt := range tests {
+		if !almostEqual(tt.got, tt.want) {
+			t.Errorf("%s = %.4f, want %.4f", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestWeightedScorerRange(t *testing.T) {
+	s := NewWeightedScorer(DefaultWeights())
+
+	best := Candidate{Lat: -12.0554, Lng: -77.0428, Speed: 8, Rating: 5, AcceptanceRate: 1, IdleS: idleCapS}
+	if got := s.Score(origin, best); !almostEqual(got, 1) {
+		t.Errorf("best possible candidate scored %.4f, want 1", got)
+	}
+
+	worst := Candidate{
+		Lat: -12.0554, Lng: -77.0428, Speed: 8, Heading: 180,
+		DistanceM: 1e9, ETAS: 1e9, Rating: 0.01, AcceptanceRate: -1,
+	}
+	if got := s.Score(origin, worst); got < 0 || got > 0.01 {
+		t.Errorf("worst candidate scored %.4f, want ~0", got)
+	}
+
+	// Sólo importa la proporción entre pesos
+	doubled := DefaultWeights()
+	doubled.Distance *= 2
+	doubled.ETA *= 2
+	doubled.Rating *= 2
+	doubled.Acceptance *= 2
+	doubled.Idle *= 2
+	doubled.Heading *= 2
+	c := baseCandidate()
+	if a, b := s.Score(origin, c), NewWeightedScorer(doubled).Score(origin, c); !almostEqual(a, b) {
+		t.Errorf("scaled weights changed the score: %.4f vs %.4f", a, b)
+	}
+}
+
+func TestWeightsValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		w     Weights
+		valid bool
+	}{
+		{"default", DefaultWeights(), true},
+		{"single factor", Weights{Distance: 1}, true},
+		{"all zero", Weights{}, false},
+		{"negative", Weights{Distance: 1, ETA: -0.1}, false},
+		{"NaN", Weights{Distance: math.NaN()}, false},
+		{"infinite", Weights{Idle: math.Inf(1)}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.w.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid=%v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestWeightedScorerSetWeights(t *testing.T) {
+	if got := NewWeightedScorer(Weights{}).Weights(); got != DefaultWeights() {
+		t.Errorf("invalid weights not replaced by defaults: %+v", got)
+	}
+
+	s := NewWeightedScorer(DefaultWeights())
+	if err := s.SetWeights(Weights{Distance: -1}); err == nil {
+		t.Error("SetWeights accepted negative weights")
+	}
+	if got := s.Weights(); got != DefaultWeights() {
+		t.Errorf("rejected weights were applied: %+v", got)
+	}
+
+	if err := s.SetWeights(Weights{Distance: 1}); err != nil {
+		t.Fatalf("SetWeights: %v", err)
+	}
+	near, far := baseCandidate(), baseCandidate()
+	near.DistanceM, near.Rating = 100, 1
+	far.DistanceM, far.Rating = 3000, 5
+	if s.Score(origin, near) <= s.Score(origin, far) {
+		t.Error("distance-only weights did not rank by distance")
+	}
+}
+
+func withHeading(c Candidate, heading float64) Candidate {
+	c.Heading = heading
+	return c
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-3
+}
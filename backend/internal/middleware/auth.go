@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/criston04/TaxyTac/backend/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+const claimsKey = "auth.claims"
+
+// TokenVerifier valida un access token y devuelve sus claims
+type TokenVerifier interface {
+	Verify(token string) (*auth.Claims, error)
+}
+
+// BearerToken extrae el token del header Authorization: Bearer <token>
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// Auth exige un access token válido y guarda sus claims en el contexto
+func Auth(verifier TokenVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := BearerToken(c.Request)
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing bearer token"})
+			return
+		}
+
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+
+		c.Set(claimsKey, claims)
+		c.Next()
+	}
+}
+
+// RequireRole deja pasar sólo a los roles indicados (admin siempre pasa).
+// Debe ir después de Auth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := ClaimsFromContext(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing bearer token"})
+			return
+		}
+
+		if claims.IsAdmin() {
+			c.Next()
+			return
+		}
+		for _, role := range roles {
+			if claims.Role == role {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+	}
+}
+
+// ClaimsFromContext devuelve los claims puestos por Auth
+func ClaimsFromContext(c *gin.Context) (*auth.Claims, bool) {
+	v, ok := c.Get(claimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := v.(*auth.Claims)
+	return claims, ok
+}
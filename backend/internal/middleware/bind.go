@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Los errores de binding usan el nombre JSON del campo, no el del struct
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return f.Name
+			}
+			return name
+		})
+	}
+}
+
+// BindJSON decodifica y valida el body. Si falla responde 400 con los errores
+// por campo y devuelve false.
+func BindJSON(c *gin.Context, obj any) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		RespondWithValidationErrors(c, BindingErrors(err))
+		return false
+	}
+	return true
+}
+
+// BindingErrors convierte un error de ShouldBind en errores por campo. Los
+// campos anidados llevan su ruta ("points[3].lat").
+func BindingErrors(err error) []*ValidationError {
+	var fieldErrs validator.ValidationErrors
+	if errors.As(err, &fieldErrs) {
+		errs := make([]*ValidationError, 0, len(fieldErrs))
+		for _, fe := range fieldErrs {
+			var params []string
+			if fe.Param() != "" {
+				params = strings.Fields(fe.Param())
+			}
+			verr := NewValidationError(fieldPath(fe), fe.Tag(), params...)
+			verr.Kind = valueKind(fe.Kind())
+			verr.Message = translate(defaultLanguage, verr.Field, verr.Code, verr.Kind, params...)
+			errs = append(errs, verr)
+		}
+		return errs
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return []*ValidationError{NewValidationError(typeErr.Field, "type")}
+	}
+
+	return []*ValidationError{NewValidationError("body", "json")}
+}
+
+// fieldPath es la ruta del campo sin el struct raíz: "Body.points[3].lat" ->
+// "points[3].lat"
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok && path != "" {
+		return path
+	}
+	return fe.Field()
+}
+
+// valueKind agrupa los tipos cuyo min/max/len no se mide en caracteres
+func valueKind(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return kindNumber
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return kindItems
+	}
+	return ""
+}
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Idiomas soportados para los mensajes de validación
+const (
+	LangES = "es"
+	LangEN = "en"
+
+	defaultLanguage = LangES
+)
+
+// validationMessages traduce los códigos de ValidationError. Se busca primero
+// "<campo>.<código>", luego "<código>.<tipo>" (min/max/len de números y
+// listas) y por último el código genérico, que para min/max/len es el de texto.
+var validationMessages = map[string]map[string]string{
+	LangES: {
+		"required": "El campo es requerido",
+		"oneof":    "Debe ser uno de: %s",
+		"min":      "Debe tener al menos %s caracteres",
+		"max":      "Debe tener como máximo %s caracteres",
+		"len":      "Debe tener %s caracteres",
+		"email":    "El formato del email es inválido",
+		"url":      "Debe ser una URL http(s)",
+		"date":     "La fecha debe tener el formato AAAA-MM-DD",
+		"type":     "El tipo de dato es inválido",
+		"json":     "El cuerpo de la petición no es JSON válido",
+		"invalid":  "El valor es inválido",
+
+		"min.number": "Debe ser mayor o igual a %s",
+		"max.number": "Debe ser menor o igual a %s",
+		"len.number": "Debe ser igual a %s",
+		"min.items":  "Debe tener al menos %s elementos",
+		"max.items":  "Debe tener como máximo %s elementos",
+		"len.items":  "Debe tener %s elementos",
+
+		"email.required":    "El email es requerido",
+		"email.invalid":     "El formato del email es inválido",
+		"password.required": "La contraseña es requerida",
+		"password.min":      "La contraseña debe tener al menos %s caracteres",
+		"password.max":      "La contraseña es demasiado larga",
+		"name.required":     "El nombre es requerido",
+		"name.min":          "El nombre debe tener al menos %s caracteres",
+		"name.max":          "El nombre es demasiado largo",
+		"phone.required":    "El teléfono es requerido",
+		"phone.invalid":     "El teléfono debe tener 9 dígitos",
+		"plate.required":    "La placa es requerida",
+		"plate.invalid":     "La placa debe tener el formato ABC-123",
+		"role.oneof":        "El rol debe ser uno de: %s",
+		"make.required":     "La marca es requerida",
+		"model.required":    "El modelo es requerido",
+		"year.invalid":      "El año del vehículo es inválido",
+		"photos.max":        "Máximo %s fotos por vehículo",
+		"photos.url":        "Las fotos deben ser URLs http(s)",
+		"file_url.url":      "El archivo debe ser una URL http(s)",
+		"expires_at.past":   "El documento ya está vencido",
+		"reason.required":   "El motivo es requerido",
+		"points.required":   "Envía al menos una ubicación",
+		"points.min":        "Envía al menos %s ubicación",
+		"points.max":        "Máximo %s ubicaciones por lote",
+	},
+	LangEN: {
+		"required": "This field is required",
+		"oneof":    "Must be one of: %s",
+		"min":      "Must be at least %s characters long",
+		"max":      "Must be at most %s characters long",
+		"len":      "Must be %s characters long",
+		"email":    "Invalid email format",
+		"url":      "Must be an http(s) URL",
+		"date":     "Date must use the YYYY-MM-DD format",
+		"type":     "Invalid data type",
+		"json":     "Request body is not valid JSON",
+		"invalid":  "Invalid value",
+
+		"min.number": "Must be greater than or equal to %s",
+		"max.number": "Must be less than or equal to %s",
+		"len.number": "Must be equal to %s",
+		"min.items":  "Must have at least %s items",
+		"max.items":  "Must have at most %s items",
+		"len.items":  "Must have %s items",
+
+		"email.required":    "Email is required",
+		"email.invalid":     "Invalid email format",
+		"password.required": "Password is required",
+		"password.min":      "Password must be at least %s characters long",
+		"password.max":      "Password is too long",
+		"name.required":     "Name is required",
+		"name.min":          "Name must be at least %s characters long",
+		"name.max":          "Name is too long",
+		"phone.required":    "Phone is required",
+		"phone.invalid":     "Phone must have 9 digits",
+		"plate.required":    "Plate is required",
+		"plate.invalid":     "Plate must use the ABC-123 format",
+		"role.oneof":        "Role must be one of: %s",
+		"make.required":     "Make is required",
+		"model.required":    "Model is required",
+		"year.invalid":      "Invalid vehicle year",
+		"photos.max":        "At most %s photos per vehicle",
+		"photos.url":        "Photos must be http(s) URLs",
+		"file_url.url":      "File must be an http(s) URL",
+		"expires_at.past":   "The document has already expired",
+		"reason.required":   "A reason is required",
+		"points.required":   "Send at least one location",
+		"points.min":        "Send at least %s location",
+		"points.max":        "At most %s locations per batch",
+	},
+}
+
+// Tipos de valor con mensajes propios para min/max/len
+const (
+	kindNumber = "number"
+	kindItems  = "items"
+)
+
+// translate arma el mensaje de un código en el idioma pedido. field puede ser
+// una ruta ("points[3].lat"): los mensajes por campo usan el último nombre.
+func translate(lang, field, code, kind string, params ...string) string {
+	catalog, ok := validationMessages[lang]
+	if !ok {
+		catalog = validationMessages[defaultLanguage]
+	}
+
+	format, ok := catalog[fieldName(field)+"."+code]
+	if !ok && kind != "" {
+		format, ok = catalog[code+"."+kind]
+	}
+	if !ok {
+		format, ok = catalog[code]
+	}
+	if !ok {
+		format = catalog["invalid"]
+	}
+
+	if strings.Contains(format, "%s") && len(params) > 0 {
+		return fmt.Sprintf(format, strings.Join(params, ", "))
+	}
+	return format
+}
+
+// fieldName es el nombre del campo al final de una ruta: "points[3].lat" -> "lat",
+// "photos[0]" -> "photos"
+func fieldName(path string) string {
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		path = path[i+1:]
+	}
+	name, _, _ := strings.Cut(path, "[")
+	return name
+}
+
+// Language elige el idioma de la respuesta a partir de Accept-Language
+// (por defecto español)
+func Language(c *gin.Context) string {
+	header := c.GetHeader("Accept-Language")
+	if header == "" {
+		return defaultLanguage
+	}
+
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, q := strings.TrimSpace(part), 1.0
+		if i := strings.Index(tag, ";"); i >= 0 {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(tag[i+1:]), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+			tag = tag[:i]
+		}
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, ok := validationMessages[base]; ok && q > 0 {
+			candidates = append(candidates, candidate{lang: base, q: q})
+		}
+	}
+	if len(candidates) == 0 {
+		return defaultLanguage
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].lang
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", LangES},
+		{"en", LangEN},
+		{"en-US", LangEN},
+		{"EN-gb", LangEN},
+		{"es-PE,es;q=0.9", LangES},
+		{"fr-FR,en;q=0.8,es;q=0.5", LangEN},
+		{"es;q=0.3,en;q=0.7", LangEN},
+		{"en;q=0,es;q=0.1", LangES},
+		{"fr, de", LangES},
+		{"en;q=bad", LangEN},
+		{" en-US ; q=0.9 , es ; q=0.8", LangEN},
+		{"*", LangES},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			c.Request.Header.Set("Accept-Language", tt.header)
+		}
+		if got := Language(c); got != tt.want {
+			t.Errorf("Language(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		lang   string
+		field  string
+		code   string
+		kind   string
+		params []string
+		want   string
+	}{
+		{LangES, "name", "min", "", []string{"2"}, "El nombre debe tener al menos 2 caracteres"},
+		{LangEN, "name", "min", "", []string{"2"}, "Name must be at least 2 characters long"},
+		{LangES, "comment", "max", "", []string{"200"}, "Debe tener como máximo 200 caracteres"},
+		{LangES, "rating", "min", kindNumber, []string{"1"}, "Debe ser mayor o igual a 1"},
+		{LangEN, "rating", "max", kindNumber, []string{"5"}, "Must be less than or equal to 5"},
+		{LangES, "stops", "max", kindItems, []string{"3"}, "Debe tener como máximo 3 elementos"},
+		{LangEN, "stops", "len", kindItems, []string{"2"}, "Must have 2 items"},
+		// El mensaje por campo gana al del tipo
+		{LangES, "points", "max", kindItems, []string{"1000"}, "Máximo 1000 ubicaciones por lote"},
+		{LangEN, "photos[2]", "url", "", nil, "Photos must be http(s) URLs"},
+		{LangES, "points[3].lat", "required", "", nil, "El campo es requerido"},
+		{LangEN, "role", "oneof", "", []string{"rider", "driver"}, "Role must be one of: rider, driver"},
+		{LangEN, "body", "json", "", nil, "Request body is not valid JSON"},
+		{LangEN, "vin", "unknown_tag", "", nil, "Invalid value"},
+		{"fr", "email", "required", "", nil, "El email es requerido"},
+	}
+
+	for _, tt := range tests {
+		if got := translate(tt.lang, tt.field, tt.code, tt.kind, tt.params...); got != tt.want {
+			t.Errorf("translate(%s, %s, %s, %q) = %q, want %q", tt.lang, tt.field, tt.code, tt.kind, got, tt.want)
+		}
+	}
+}
+
+// Cada idioma traduce los mismos códigos
+func TestValidationMessagesComplete(t *testing.T) {
+	for lang, catalog := range validationMessages {
+		for other, otherCatalog := range validationMessages {
+			for key := range otherCatalog {
+				if _, ok := catalog[key]; !ok {
+					t.Errorf("%s has %q but %s does not", other, key, lang)
+				}
+			}
+		}
+	}
+}
+
+type testStop struct {
+	Lat  float64 `json:"lat" binding:"min=-90,max=90"`
+	Name string  `json:"name" binding:"required,max=5"`
+}
+
+type testBody struct {
+	Name   string     `json:"name" binding:"required,min=2"`
+	Rating int        `json:"rating" binding:"min=1,max=5"`
+	Stops  []testStop `json:"stops" binding:"max=2,dive"`
+}
+
+func TestBindJSONErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name string
+		lang string
+		body string
+		want map[string]string
+	}{
+		{
+			name: "kinds in spanish",
+			body: `{"name": "J", "rating": 9, "stops": [{}, {}, {}]}`,
+			want: map[string]string{
+				"name":   "El nombre debe tener al menos 2 caracteres",
+				"rating": "Debe ser menor o igual a 5",
+				"stops":  "Debe tener como máximo 2 elementos",
+			},
+		},
+		{
+			name: "nested paths in english",
+			lang: "en-US,en;q=0.9",
+			body: `{"name": "Juan", "rating": 0, "stops": [{"lat": -12, "name": "Plaza"}, {"lat": -95, "name": "Miraflores"}]}`,
+			want: map[string]string{
+				"rating":       "Must be greater than or equal to 1",
+				"stops[1].lat": "Must be greater than or equal to -90",
+				// El mensaje por campo usa el último nombre de la ruta
+				"stops[1].name": "Name is too long",
+			},
+		},
+		{
+			name: "type error",
+			body: `{"name": "Juan", "rating": "five"}`,
+			want: map[string]string{"rating": "El tipo de dato es inválido"},
+		},
+		{
+			name: "invalid json",
+			lang: "en",
+			body: `{"name": `,
+			want: map[string]string{"body": "Request body is not valid JSON"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			if tt.lang != "" {
+				c.Request.Header.Set("Accept-Language", tt.lang)
+			}
+
+			var body testBody
+			if BindJSON(c, &body) {
+				t.Fatal("BindJSON accepted an invalid body")
+			}
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400", w.Code)
+			}
+			var resp struct {
+				Errors map[string]string `json:"errors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Errors) != len(tt.want) {
+				t.Errorf("errors = %v, want %v", resp.Errors, tt.want)
+			}
+			for field, msg := range tt.want {
+				if resp.Errors[field] != msg {
+					t.Errorf("errors[%s] = %q, want %q", field, resp.Errors[field], msg)
+				}
+			}
+		})
+	}
+}
@@ -14,23 +14,32 @@ var (
 )
 
 type ValidationError struct {
-	Field   string `json:"field"`
-	Message string `json:"message"`
+	Field   string   `json:"field"`
+	Message string   `json:"message"`
+	Code    string   `json:"code,omitempty"`
+	Params  []string `json:"-"`
+	// Kind distingue los mensajes de min/max/len de números y listas
+	Kind string `json:"-"`
+}
+
+// NewValidationError crea un error de campo con su código de mensaje; Message
+// queda en el idioma por defecto y RespondWithValidationErrors lo traduce
+func NewValidationError(field, code string, params ...string) *ValidationError {
+	return &ValidationError{
+		Field:   field,
+		Message: translate(defaultLanguage, field, code, "", params...),
+		Code:    code,
+		Params:  params,
+	}
 }
 
 func ValidateEmail(email string) *ValidationError {
 	if email == "" {
-		return &ValidationError{
-			Field:   "email",
-			Message: "El email es requerido",
-		}
+		return NewValidationError("email", "required")
 	}
 
 	if !emailRegex.MatchString(email) {
-		return &ValidationError{
-			Field:   "email",
-			Message: "El formato del email es inválido",
-		}
+		return NewValidationError("email", "invalid")
 	}
 
 	return nil
@@ -38,24 +47,15 @@ func ValidateEmail(email string) *ValidationError {
 
 func ValidatePassword(password string) *ValidationError {
 	if password == "" {
-		return &ValidationError{
-			Field:   "password",
-			Message: "La contraseña es requerida",
-		}
+		return NewValidationError("password", "required")
 	}
 
 	if len(password) < 6 {
-		return &ValidationError{
-			Field:   "password",
-			Message: "La contraseña debe tener al menos 6 caracteres",
-		}
+		return NewValidationError("password", "min", "6")
 	}
 
 	if len(password) > 100 {
-		return &ValidationError{
-			Field:   "password",
-			Message: "La contraseña es demasiado larga",
-		}
+		return NewValidationError("password", "max", "100")
 	}
 
 	return nil
@@ -63,24 +63,15 @@ func ValidatePassword(password string) *ValidationError {
 
 func ValidateName(name string) *ValidationError {
 	if name == "" {
-		return &ValidationError{
-			Field:   "name",
-			Message: "El nombre es requerido",
-		}
+		return NewValidationError("name", "required")
 	}
 
 	if len(name) < 2 {
-		return &ValidationError{
-			Field:   "name",
-			Message: "El nombre debe tener al menos 2 caracteres",
-		}
+		return NewValidationError("name", "min", "2")
 	}
 
 	if len(name) > 100 {
-		return &ValidationError{
-			Field:   "name",
-			Message: "El nombre es demasiado largo",
-		}
+		return NewValidationError("name", "max", "100")
 	}
 
 	return nil
@@ -88,17 +79,11 @@ func ValidateName(name string) *ValidationError {
 
 func ValidatePhone(phone string) *ValidationError {
 	if phone == "" {
-		return &ValidationError{
-			Field:   "phone",
-			Message: "El teléfono es requerido",
-		}
+		return NewValidationError("phone", "required")
 	}
 
 	if !phoneRegex.MatchString(phone) {
-		return &ValidationError{
-			Field:   "phone",
-			Message: "El teléfono debe tener 9 dígitos",
-		}
+		return NewValidationError("phone", "invalid")
 	}
 
 	return nil
@@ -106,28 +91,33 @@ func ValidatePhone(phone string) *ValidationError {
 
 func ValidatePlate(plate string) *ValidationError {
 	if plate == "" {
-		return &ValidationError{
-			Field:   "plate",
-			Message: "La placa es requerida",
-		}
+		return NewValidationError("plate", "required")
 	}
 
 	if !plateRegex.MatchString(plate) {
-		return &ValidationError{
-			Field:   "plate",
-			Message: "La placa debe tener el formato ABC-123",
-		}
+		return NewValidationError("plate", "invalid")
 	}
 
 	return nil
 }
 
+// RespondWithValidationErrors responde 400 con el mapa campo -> mensaje en el
+// idioma de Accept-Language
 func RespondWithValidationErrors(c *gin.Context, errors []*ValidationError) {
+	lang := Language(c)
 	errorMap := make(map[string]string)
 	for _, err := range errors {
-		errorMap[err.Field] = err.Message
+		if _, seen := errorMap[err.Field]; seen {
+			continue
+		}
+		if err.Code != "" {
+			errorMap[err.Field] = translate(lang, err.Field, err.Code, err.Kind, err.Params...)
+		} else {
+			errorMap[err.Field] = err.Message
+		}
 	}
 
+	c.Header("Content-Language", lang)
 	c.JSON(http.StatusBadRequest, gin.H{
 		"error":  "Validation failed",
 		"errors": errorMap,
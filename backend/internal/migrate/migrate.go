@@ -0,0 +1,366 @@
+// Package migrate aplica las migraciones SQL versionadas del backend y lleva el
+// registro en la tabla schema_migrations.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sirupsen/logrus"
+)
+
+// lockID es la llave del advisory lock que evita dos runners en paralelo
+const lockID = 7_424_011
+
+var fileRegex = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration es un par up/down identificado por su versión
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// State es el estado de una migración en la base de datos
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateApplied  State = "applied"
+	StateModified State = "modified" // aplicada, pero el archivo cambió después
+	StateMissing  State = "missing"  // aplicada en la DB, sin archivo en el binario
+)
+
+// Status describe una migración conocida por el binario o por la DB
+type Status struct {
+	Version   int
+	Name      string
+	State     State
+	AppliedAt *time.Time
+}
+
+type appliedRow struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Runner aplica migraciones sobre una conexión dedicada
+type Runner struct {
+	conn       *pgx.Conn
+	migrations []Migration
+	log        *logrus.Logger
+}
+
+// Load lee los archivos NNN_nombre.up.sql / .down.sql de fsys
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		m := fileRegex.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(m[1])
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(data)
+			sum := sha256.Sum256(data)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %03d_%s has no up file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// NewRunner conecta a la DB y carga las migraciones de fsys
+func NewRunner(ctx context.Context, databaseURL string, fsys fs.FS, log *logrus.Logger) (*Runner, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pgx.Connect(ctx, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Runner{conn: conn, migrations: migrations, log: log}
+	if err := r.ensureTable(ctx); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Runner) Close(ctx context.Context) error {
+	return r.conn.Close(ctx)
+}
+
+// Up aplica todas las migraciones pendientes. Falla sin tocar nada si alguna
+// migración ya aplicada cambió de contenido.
+func (r *Runner) Up(ctx context.Context) (int, error) {
+	var count int
+	err := r.withLock(ctx, func() error {
+		applied, err := r.applied(ctx)
+		if err != nil {
+			return err
+		}
+		if err := verify(r.migrations, applied); err != nil {
+			return err
+		}
+
+		for _, m := range r.migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if err := r.apply(ctx, m); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down revierte las últimas `steps` migraciones aplicadas. Igual que Up, falla
+// sin tocar nada si alguna migración aplicada cambió de contenido: su down
+// podría no deshacer lo que realmente se ejecutó.
+func (r *Runner) Down(ctx context.Context, steps int) (int, error) {
+	var count int
+	err := r.withLock(ctx, func() error {
+		applied, err := r.applied(ctx)
+		if err != nil {
+			return err
+		}
+		if err := verify(r.migrations, applied); err != nil {
+			return err
+		}
+
+		for i := len(r.migrations) - 1; i >= 0 && count < steps; i-- {
+			m := r.migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %03d_%s has no down file", m.Version, m.Name)
+			}
+			if err := r.revert(ctx, m); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Force marca como aplicadas todas las migraciones hasta `version` sin
+// ejecutarlas. Sirve para adoptar bases creadas a mano con psql.
+func (r *Runner) Force(ctx context.Context, version int) error {
+	return r.withLock(ctx, func() error {
+		applied, err := r.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range r.migrations {
+			if m.Version > version {
+				break
+			}
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if err := r.record(ctx, r.conn, m); err != nil {
+				return err
+			}
+			r.log.WithField("version", m.Version).Info("Migration marked as applied")
+		}
+		return nil
+	})
+}
+
+// Status compara las migraciones del binario con las registradas en la DB
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Status
+	known := make(map[int]bool)
+	for _, m := range r.migrations {
+		known[m.Version] = true
+		st := Status{Version: m.Version, Name: m.Name, State: StatePending}
+		if row, ok := applied[m.Version]; ok {
+			at := row.appliedAt
+			st.AppliedAt = &at
+			st.State = StateApplied
+			if row.checksum != m.Checksum {
+				st.State = StateModified
+			}
+		}
+		out = append(out, st)
+	}
+
+	for version, row := range applied {
+		if known[version] {
+			continue
+		}
+		at := row.appliedAt
+		out = append(out, Status{Version: version, Name: row.name, State: StateMissing, AppliedAt: &at})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+
+	return out, nil
+}
+
+func (r *Runner) ensureTable(ctx context.Context) error {
+	_, err := r.conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+	return err
+}
+
+func (r *Runner) applied(ctx context.Context) (map[int]appliedRow, error) {
+	rows, err := r.conn.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedRow)
+	for rows.Next() {
+		var version int
+		var row appliedRow
+		if err := rows.Scan(&version, &row.name, &row.checksum, &row.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = row
+	}
+	return applied, rows.Err()
+}
+
+// verify falla si el checksum de alguna migración aplicada no coincide con el
+// del archivo embebido
+func verify(migrations []Migration, applied map[int]appliedRow) error {
+	for _, m := range migrations {
+		row, ok := applied[m.Version]
+		if ok && row.checksum != m.Checksum {
+			return fmt.Errorf("migration %03d_%s was modified after being applied (checksum mismatch)", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) apply(ctx context.Context, m Migration) error {
+	start := time.Now()
+	err := pgx.BeginFunc(ctx, r.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, m.Up); err != nil {
+			return err
+		}
+		return r.record(ctx, tx, m)
+	})
+	if err != nil {
+		return fmt.Errorf("apply migration %03d_%s: %w", m.Version, m.Name, err)
+	}
+
+	r.log.WithFields(logrus.Fields{
+		"version":  m.Version,
+		"name":     m.Name,
+		"duration": time.Since(start).String(),
+	}).Info("Migration applied")
+	return nil
+}
+
+func (r *Runner) revert(ctx context.Context, m Migration) error {
+	err := pgx.BeginFunc(ctx, r.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, m.Down); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("revert migration %03d_%s: %w", m.Version, m.Name, err)
+	}
+
+	r.log.WithFields(logrus.Fields{
+		"version": m.Version,
+		"name":    m.Name,
+	}).Info("Migration reverted")
+	return nil
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func (r *Runner) record(ctx context.Context, db execer, m Migration) error {
+	_, err := db.Exec(ctx,
+		`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+		m.Version, m.Name, m.Checksum)
+	return err
+}
+
+func (r *Runner) withLock(ctx context.Context, fn func() error) error {
+	if _, err := r.conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return err
+	}
+	defer func() {
+		// Usar un contexto propio: el de la llamada puede estar cancelado
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := r.conn.Exec(unlockCtx, `SELECT pg_advisory_unlock($1)`, lockID); err != nil {
+			r.log.WithError(err).Warn("Failed to release migration lock")
+		}
+	}()
+
+	return fn()
+}
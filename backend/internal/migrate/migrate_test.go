@@ -0,0 +1,157 @@
+package migrate
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/criston04/TaxyTac/backend/migrations"
+)
+
+func file(data string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(data)}
+}
+
+func TestLoadOrder(t *testing.T) {
+	fsys := fstest.MapFS{
+		"10_trips.up.sql":     file("CREATE TABLE trips ();"),
+		"10_trips.down.sql":   file("DROP TABLE trips;"),
+		"9_users.up.sql":      file("CREATE TABLE users ();"),
+		"002_auth.up.sql":     file("ALTER TABLE users ADD COLUMN password TEXT;"),
+		"002_auth.down.sql":   file("ALTER TABLE users DROP COLUMN password;"),
+		"README.md":           file("no es una migración"),
+		"003_Bad-Name.up.sql": file("SELECT 1;"),
+		"seed/test_data.sql":  file("INSERT INTO users DEFAULT VALUES;"),
+	}
+
+	got, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Orden numérico, no alfabético: 9 va antes que 10
+	var order []string
+	for _, m := range got {
+		order = append(order, m.Name)
+	}
+	if strings.Join(order, ",") != "auth,users,trips" {
+		t.Fatalf("order = %v, want [auth users trips]", order)
+	}
+	if got[1].Down != "" || got[2].Down != "DROP TABLE trips;" {
+		t.Errorf("down files = %q, %q", got[1].Down, got[2].Down)
+	}
+	if got[0].Checksum == "" || got[0].Checksum == got[2].Checksum {
+		t.Errorf("checksums = %q, %q", got[0].Checksum, got[2].Checksum)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{
+			name: "conflicting names",
+			fsys: fstest.MapFS{
+				"001_init.up.sql":  file("SELECT 1;"),
+				"1_other.down.sql": file("SELECT 1;"),
+			},
+			want: "conflicting names",
+		},
+		{
+			name: "missing up file",
+			fsys: fstest.MapFS{
+				"001_init.up.sql":   file("SELECT 1;"),
+				"002_auth.down.sql": file("SELECT 1;"),
+			},
+			want: "002_auth has no up file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// Las migraciones embebidas cargan en orden, sin huecos y con down
+func TestEmbeddedMigrations(t *testing.T) {
+	got, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+	for i, m := range got {
+		if m.Version != i+1 {
+			t.Fatalf("migration %03d_%s at position %d, want version %d", m.Version, m.Name, i, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %03d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
+
+// 001 viene del antiguo 001_init.sql que se aplicaba a mano con psql: tiene
+// que poder correr sobre una base que ya lo tiene para que `up` la adopte
+func TestInitIsIdempotent(t *testing.T) {
+	got, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	create := regexp.MustCompile(`(?im)^\s*CREATE\s+(?:UNIQUE\s+)?(TABLE|INDEX|EXTENSION|FUNCTION|TRIGGER)\b(.*)$`)
+	for _, m := range create.FindAllStringSubmatch(got[0].Up, -1) {
+		rest := strings.ToUpper(m[2])
+		if m[1] == "FUNCTION" || m[1] == "TRIGGER" {
+			t.Errorf("CREATE %s without OR REPLACE:%s", m[1], m[2])
+		} else if !strings.HasPrefix(strings.TrimSpace(rest), "IF NOT EXISTS") {
+			t.Errorf("CREATE %s without IF NOT EXISTS:%s", m[1], m[2])
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	fsys := fstest.MapFS{
+		"001_init.up.sql":   file("CREATE TABLE users ();"),
+		"001_init.down.sql": file("DROP TABLE users;"),
+		"002_auth.up.sql":   file("ALTER TABLE users ADD COLUMN password TEXT;"),
+		"002_auth.down.sql": file("ALTER TABLE users DROP COLUMN password;"),
+	}
+	loaded, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied := map[int]appliedRow{1: {name: "init", checksum: loaded[0].Checksum}}
+	if err := verify(loaded, applied); err != nil {
+		t.Fatalf("unchanged migrations: %v", err)
+	}
+
+	// Editar un archivo ya aplicado cambia su checksum
+	fsys["001_init.up.sql"] = file("CREATE TABLE users (id UUID);")
+	edited, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = verify(edited, applied)
+	if err == nil || !strings.Contains(err.Error(), "001_init was modified") {
+		t.Errorf("edited migration: err = %v", err)
+	}
+
+	// Editar una pendiente no importa
+	fsys["001_init.up.sql"] = file("CREATE TABLE users ();")
+	fsys["002_auth.up.sql"] = file("ALTER TABLE users ADD COLUMN password_hash TEXT;")
+	pending, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(pending, applied); err != nil {
+		t.Errorf("edited pending migration: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Email es un mensaje de correo en texto plano
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// EmailSender envía correos a los usuarios
+type EmailSender interface {
+	SendEmail(ctx context.Context, email Email) error
+}
+
+// LogEmailSender escribe los correos en el log (desarrollo local)
+type LogEmailSender struct {
+	log *logrus.Logger
+}
+
+func NewLogEmailSender(log *logrus.Logger) *LogEmailSender {
+	return &LogEmailSender{log: log}
+}
+
+func (s *LogEmailSender) SendEmail(_ context.Context, email Email) error {
+	s.log.WithFields(logrus.Fields{
+		"to":      email.To,
+		"subject": email.Subject,
+		"body":    email.Body,
+	}).Info("Email sent (log sender)")
+	return nil
+}
+
+// OutboxEmailSender guarda los correos en memoria; útil en tests para leer
+// los links enviados
+type OutboxEmailSender struct {
+	mu       sync.Mutex
+	messages []Email
+}
+
+func NewOutboxEmailSender() *OutboxEmailSender {
+	return &OutboxEmailSender{}
+}
+
+func (s *OutboxEmailSender) SendEmail(_ context.Context, email Email) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, email)
+	return nil
+}
+
+// Messages devuelve una copia de los correos enviados
+func (s *OutboxEmailSender) Messages() []Email {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Email(nil), s.messages...)
+}
+
+// Last devuelve el último correo enviado a `to`
+func (s *OutboxEmailSender) Last(to string) (Email, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].To == to {
+			return s.messages[i], true
+		}
+	}
+	return Email{}, false
+}
@@ -0,0 +1,68 @@
+// Package notify envía notificaciones a usuarios (SMS, email) a través de
+// implementaciones intercambiables.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SMSSender envía un mensaje de texto a un número de teléfono
+type SMSSender interface {
+	SendSMS(ctx context.Context, to, message string) error
+}
+
+// LogSMSSender escribe los SMS en el log (desarrollo local)
+type LogSMSSender struct {
+	log *logrus.Logger
+}
+
+func NewLogSMSSender(log *logrus.Logger) *LogSMSSender {
+	return &LogSMSSender{log: log}
+}
+
+func (s *LogSMSSender) SendSMS(_ context.Context, to, message string) error {
+	s.log.WithFields(logrus.Fields{
+		"to":      to,
+		"message": message,
+	}).Info("SMS sent (log sender)")
+	return nil
+}
+
+// FileSMSSender agrega cada SMS como una línea JSON a un archivo
+type FileSMSSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSMSSender(path string) *FileSMSSender {
+	return &FileSMSSender{path: path}
+}
+
+func (s *FileSMSSender) SendSMS(_ context.Context, to, message string) error {
+	line, err := json.Marshal(map[string]interface{}{
+		"to":      to,
+		"message": message,
+		"ts":      time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,188 @@
+package realtime
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = (pongWait * 9) / 10
+	maxMessageSize = 256 * 1024 // un lote completo de ubicaciones en JSON
+	sendBuffer     = 64
+)
+
+// Client es una conexión WebSocket de un usuario. Todas las escrituras pasan
+// por WritePump, así que el resto del código sólo usa Send.
+type Client struct {
+	UserID string
+	Role   string
+
+	conn      *websocket.Conn
+	send      chan outgoing
+	done      chan struct{}
+	closeOnce sync.Once
+	closeMsg  []byte
+	expiresAt time.Time
+
+	// topics los administra el Hub bajo su lock
+	topics map[string]struct{}
+}
+
+// outgoing es un mensaje encolado; los ACK del protocolo binario van como
+// frames binarios y todo lo demás como texto
+type outgoing struct {
+	binary bool
+	data   []byte
+}
+
+// NewClient envuelve la conexión; expiresAt (opcional) es el vencimiento del
+// access token, tras el cual la conexión se cierra
+func NewClient(conn *websocket.Conn, userID, role string, expiresAt time.Time) *Client {
+	return &Client{
+		UserID:    userID,
+		Role:      role,
+		conn:      conn,
+		send:      make(chan outgoing, sendBuffer),
+		done:      make(chan struct{}),
+		expiresAt: expiresAt,
+		topics:    make(map[string]struct{}),
+	}
+}
+
+// Send encola un mensaje de texto. Si el cliente no consume a tiempo se
+// cierra la conexión en lugar de bloquear al resto.
+func (c *Client) Send(msg []byte) bool {
+	return c.enqueue(outgoing{data: msg})
+}
+
+// SendBinary encola un frame binario
+func (c *Client) SendBinary(msg []byte) bool {
+	return c.enqueue(outgoing{binary: true, data: msg})
+}
+
+// Subprotocol es el subprotocolo negociado en el upgrade ("" si ninguno)
+func (c *Client) Subprotocol() string {
+	return c.conn.Subprotocol()
+}
+
+func (c *Client) enqueue(msg outgoing) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		c.CloseWith(websocket.CloseTryAgainLater, "client too slow")
+		return false
+	}
+}
+
+// SendMessage codifica y encola un mensaje tipado
+func (c *Client) SendMessage(msgType string, data any) bool {
+	msg, err := Encode(msgType, data)
+	if err != nil {
+		return false
+	}
+	return c.Send(msg)
+}
+
+// SendJSON encola cualquier valor como JSON (ACKs y respuestas directas)
+func (c *Client) SendJSON(v any) bool {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	return c.Send(msg)
+}
+
+// Close cierra la conexión normalmente
+func (c *Client) Close() {
+	c.CloseWith(websocket.CloseNormalClosure, "")
+}
+
+// CloseWith cierra la conexión enviando el código y motivo indicados
+func (c *Client) CloseWith(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeMsg = websocket.FormatCloseMessage(code, reason)
+		close(c.done)
+	})
+}
+
+// Done se cierra cuando el cliente se cierra
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Expired indica si venció el token con el que se abrió la conexión
+func (c *Client) Expired() bool {
+	return !c.expiresAt.IsZero() && !time.Now().Before(c.expiresAt)
+}
+
+// WritePump envía los mensajes encolados y los pings; termina al cerrarse el cliente
+func (c *Client) WritePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg := <-c.send:
+			kind := websocket.TextMessage
+			if msg.binary {
+				kind = websocket.BinaryMessage
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(kind, msg.data); err != nil {
+				c.Close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.Close()
+				return
+			}
+		case <-c.done:
+			c.conn.WriteControl(websocket.CloseMessage, c.closeMsg, time.Now().Add(writeWait))
+			return
+		}
+	}
+}
+
+// ReadPump lee mensajes hasta que la conexión se cierra, falla o vence el
+// token; handle recibe el tipo de frame (websocket.TextMessage o BinaryMessage)
+func (c *Client) ReadPump(handle func(kind int, data []byte)) error {
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(c.readDeadline())
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(c.readDeadline())
+	})
+
+	for {
+		kind, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		c.conn.SetReadDeadline(c.readDeadline())
+		handle(kind, data)
+	}
+}
+
+func (c *Client) readDeadline() time.Time {
+	deadline := time.Now().Add(pongWait)
+	if !c.expiresAt.IsZero() && c.expiresAt.Before(deadline) {
+		return c.expiresAt
+	}
+	return deadline
+}
@@ -0,0 +1,293 @@
+// Package realtime mantiene las conexiones WebSocket abiertas y entrega
+// mensajes empujados por el servidor a usuarios y tópicos. La entrega pasa
+// siempre por Redis pub/sub, así cada instancia del backend reparte a sus
+// propios clientes.
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+// Canales de Redis
+const (
+	// LocationsChannel recibe cada ubicación de driver (lo publica /ws)
+	LocationsChannel = "locations"
+	usersChannel     = "realtime:users"
+	topicsChannel    = "realtime:topics"
+)
+
+// Tipos de mensaje empujados por el servidor
+const (
+	TypeTripOffer       = "trip_offer"
+	TypeTripOfferClosed = "trip_offer_closed"
+	TypeTripStatus      = "trip_status"
+	TypeDriverLocation  = "driver_location"
+	// TypeTripOfferDeclined sólo circula por OfferTopic, entre instancias
+	TypeTripOfferDeclined = "trip_offer_declined"
+)
+
+// Message es el sobre de todo mensaje empujado por el servidor
+type Message struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Encode arma un Message listo para enviar
+func Encode(msgType string, data any) ([]byte, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Message{Type: msgType, Data: raw})
+}
+
+// DriverTopic es el tópico con las ubicaciones de un driver
+func DriverTopic(driverID string) string {
+	return "driver:" + driverID
+}
+
+// TripTopic es el tópico con los cambios de estado de un viaje
+func TripTopic(tripID string) string {
+	return "trip:" + tripID
+}
+
+// OfferTopic es el tópico interno con las respuestas a las ofertas de un
+// viaje; lo escucha el dispatcher, no los clientes
+func OfferTopic(tripID string) string {
+	return "offers:" + tripID
+}
+
+// subscriber es quien recibe mensajes de un tópico: un Client o un Listener
+type subscriber interface {
+	Send(msg []byte) bool
+}
+
+// envelope es lo que viaja por Redis entre instancias
+type envelope struct {
+	Target  string          `json:"target"`
+	Message json.RawMessage `json:"message"`
+}
+
+// Hub registra los clientes conectados por usuario y por tópico
+type Hub struct {
+	rdb *redis.Client
+	log *logrus.Logger
+
+	mu     sync.RWMutex
+	users  map[string]map[*Client]struct{}
+	topics map[string]map[subscriber]struct{}
+}
+
+func NewHub(rdb *redis.Client, log *logrus.Logger) *Hub {
+	return &Hub{
+		rdb:    rdb,
+		log:    log,
+		users:  make(map[string]map[*Client]struct{}),
+		topics: make(map[string]map[subscriber]struct{}),
+	}
+}
+
+// Register agrega el cliente; un usuario puede tener varias conexiones
+func (h *Hub) Register(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.users[c.UserID] == nil {
+		h.users[c.UserID] = make(map[*Client]struct{})
+	}
+	h.users[c.UserID][c] = struct{}{}
+}
+
+// Unregister quita el cliente de su usuario y de todos sus tópicos
+func (h *Hub) Unregister(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if clients := h.users[c.UserID]; clients != nil {
+		delete(clients, c)
+		if len(clients) == 0 {
+			delete(h.users, c.UserID)
+		}
+	}
+	for topic := range c.topics {
+		h.removeFromTopic(c, topic)
+	}
+}
+
+// Subscribe suscribe el cliente a un tópico
+func (h *Hub) Subscribe(c *Client, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.addToTopic(c, topic)
+	c.topics[topic] = struct{}{}
+}
+
+// Subscribed indica si el cliente está suscrito al tópico
+func (h *Hub) Subscribed(c *Client, topic string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	_, ok := c.topics[topic]
+	return ok
+}
+
+// Listen suscribe un Listener a los tópicos indicados (p. ej. para SSE).
+// Hay que cerrarlo con Close.
+func (h *Hub) Listen(topics ...string) *Listener {
+	l := &Listener{
+		hub:    h,
+		topics: topics,
+		ch:     make(chan []byte, sendBuffer),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, topic := range topics {
+		h.addToTopic(l, topic)
+	}
+	return l
+}
+
+func (h *Hub) addToTopic(sub subscriber, topic string) {
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[subscriber]struct{})
+	}
+	h.topics[topic][sub] = struct{}{}
+}
+
+// Unsubscribe quita el cliente del tópico
+func (h *Hub) Unsubscribe(c *Client, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeFromTopic(c, topic)
+}
+
+func (h *Hub) removeFromTopic(c *Client, topic string) {
+	delete(c.topics, topic)
+	h.dropSubscriber(c, topic)
+}
+
+func (h *Hub) dropSubscriber(sub subscriber, topic string) {
+	if subs := h.topics[topic]; subs != nil {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// Connections devuelve cuántas conexiones locales hay (métricas)
+func (h *Hub) Connections() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	n := 0
+	for _, clients := range h.users {
+		n += len(clients)
+	}
+	return n
+}
+
+// SendToUser entrega un mensaje a todas las conexiones del usuario, en
+// cualquier instancia
+func (h *Hub) SendToUser(ctx context.Context, userID, msgType string, data any) error {
+	return h.publish(ctx, usersChannel, userID, msgType, data)
+}
+
+// PublishTopic entrega un mensaje a los suscriptores del tópico, en cualquier
+// instancia
+func (h *Hub) PublishTopic(ctx context.Context, topic, msgType string, data any) error {
+	return h.publish(ctx, topicsChannel, topic, msgType, data)
+}
+
+func (h *Hub) publish(ctx context.Context, channel, target, msgType string, data any) error {
+	msg, err := Encode(msgType, data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(envelope{Target: target, Message: msg})
+	if err != nil {
+		return err
+	}
+	return h.rdb.Publish(ctx, channel, payload).Err()
+}
+
+// Run escucha Redis y reparte a los clientes locales hasta que ctx termine
+func (h *Hub) Run(ctx context.Context) {
+	pubsub := h.rdb.Subscribe(ctx, LocationsChannel, usersChannel, topicsChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			h.dispatch(msg)
+		}
+	}
+}
+
+func (h *Hub) dispatch(msg *redis.Message) {
+	switch msg.Channel {
+	case LocationsChannel:
+		var loc struct {
+			DriverID string `json:"driver_id"`
+		}
+		if err := json.Unmarshal([]byte(msg.Payload), &loc); err != nil || loc.DriverID == "" {
+			return
+		}
+		out, err := json.Marshal(Message{Type: TypeDriverLocation, Data: json.RawMessage(msg.Payload)})
+		if err != nil {
+			return
+		}
+		h.deliverTopic(DriverTopic(loc.DriverID), out)
+
+	case usersChannel, topicsChannel:
+		var env envelope
+		if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+			h.log.WithError(err).Warn("Invalid realtime envelope")
+			return
+		}
+		if msg.Channel == usersChannel {
+			h.deliverUser(env.Target, env.Message)
+		} else {
+			h.deliverTopic(env.Target, env.Message)
+		}
+	}
+}
+
+func (h *Hub) deliverUser(userID string, msg []byte) {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.users[userID]))
+	for c := range h.users[userID] {
+		clients = append(clients, c)
+	}
+	h.mu.RUnlock()
+
+	for _, c := range clients {
+		c.Send(msg)
+	}
+}
+
+func (h *Hub) deliverTopic(topic string, msg []byte) {
+	h.mu.RLock()
+	subs := make([]subscriber, 0, len(h.topics[topic]))
+	for sub := range h.topics[topic] {
+		subs = append(subs, sub)
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range subs {
+		sub.Send(msg)
+	}
+}
@@ -0,0 +1,40 @@
+package realtime
+
+import "sync"
+
+// Listener recibe los mensajes de uno o más tópicos por un canal. Sirve para
+// consumidores que no son una conexión WebSocket, como un stream SSE.
+type Listener struct {
+	hub    *Hub
+	topics []string
+	ch     chan []byte
+
+	closeOnce sync.Once
+}
+
+// C entrega los mensajes (Message codificado) de los tópicos suscritos
+func (l *Listener) C() <-chan []byte {
+	return l.ch
+}
+
+// Send encola el mensaje; si el consumidor va atrasado se descarta, ya que un
+// Listener sólo necesita el estado más reciente
+func (l *Listener) Send(msg []byte) bool {
+	select {
+	case l.ch <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close quita el Listener de sus tópicos
+func (l *Listener) Close() {
+	l.closeOnce.Do(func() {
+		l.hub.mu.Lock()
+		defer l.hub.mu.Unlock()
+		for _, topic := range l.topics {
+			l.hub.dropSubscriber(l, topic)
+		}
+	})
+}
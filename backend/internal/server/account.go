@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/auth"
+	"github.com/criston04/TaxyTac/backend/internal/middleware"
+	"github.com/criston04/TaxyTac/backend/internal/notify"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// accountLink describe el correo que acompaña a cada tipo de token de un solo
+// uso. El link apunta a la app en AppBaseURL (path + "?token=..."), que pide
+// la contraseña nueva o confirma el correo llamando a ResetPassword o
+// VerifyEmail con el token.
+type accountLink struct {
+	ttl     time.Duration
+	path    string
+	subject string
+	text    string
+}
+
+var accountLinks = map[string]accountLink{
+	auth.PurposePasswordReset: {
+		ttl:     time.Hour,
+		path:    "/reset-password",
+		subject: "Restablece tu contraseña de TaxyTac",
+		text:    "Para elegir una nueva contraseña abre este enlace (vence en %d minutos):\n\n%s",
+	},
+	auth.PurposeVerifyEmail: {
+		ttl:     24 * time.Hour,
+		path:    "/verify-email",
+		subject: "Confirma tu correo en TaxyTac",
+		text:    "Para confirmar tu correo abre este enlace (vence en %d minutos):\n\n%s",
+	},
+}
+
+// appBaseURL valida la base de los links de correo: la URL absoluta de la app
+// que los abre, no la de esta API
+func appBaseURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("APP_BASE_URL must be the http(s) URL of the app that opens emailed links, got %q", raw)
+	}
+	return strings.TrimRight(raw, "/"), nil
+}
+
+// sendAccountLink emite un token de un solo uso y envía el link por correo
+func (s *Server) sendAccountLink(ctx context.Context, purpose, userID, email string) error {
+	spec := accountLinks[purpose]
+
+	token, err := s.oneTime.Issue(ctx, purpose, userID, spec.ttl)
+	if err != nil {
+		return err
+	}
+
+	link := s.cfg.AppBaseURL + spec.path + "?token=" + url.QueryEscape(token)
+	return s.email.SendEmail(ctx, notify.Email{
+		To:      email,
+		Subject: spec.subject,
+		Body:    fmt.Sprintf(spec.text, int(spec.ttl.Minutes()), link),
+	})
+}
+
+// ForgotPassword envía un link de restablecimiento. Siempre responde 202 para
+// no revelar qué correos están registrados.
+func (s *Server) ForgotPassword(c *gin.Context) {
+	var body struct {
+		Email string `json:"email" binding:"required"`
+	}
+
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+
+	var userID string
+	err := s.db.QueryRow(context.Background(),
+		`SELECT id FROM users WHERE email = $1 LIMIT 1`, body.Email).Scan(&userID)
+	if err == nil {
+		if err := s.sendAccountLink(c.Request.Context(), auth.PurposePasswordReset, userID, body.Email); err != nil {
+			s.log.WithError(err).Error("Failed to send password reset email")
+		}
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		s.log.WithError(err).Error("Failed to look up user for password reset")
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "sent"})
+}
+
+// ResetPassword cambia la contraseña con un token de restablecimiento y cierra
+// todas las sesiones abiertas del usuario
+func (s *Server) ResetPassword(c *gin.Context) {
+	var body struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+
+	if verr := middleware.ValidatePassword(body.Password); verr != nil {
+		middleware.RespondWithValidationErrors(c, []*middleware.ValidationError{verr})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID, err := s.oneTime.Consume(ctx, auth.PurposePasswordReset, body.Token)
+	if errors.Is(err, auth.ErrOneTimeInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		s.log.WithError(err).Error("Failed to consume password reset token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	hashedPassword, err := hashPassword(body.Password)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to hash password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process password"})
+		return
+	}
+
+	// Quien recibe el link demuestra que controla el correo
+	query := `
+		UPDATE users
+		SET password_hash = $1, email_verified_at = COALESCE(email_verified_at, now())
+		WHERE id = $2
+	`
+	if _, err := s.db.Exec(context.Background(), query, hashedPassword, userID); err != nil {
+		s.log.WithError(err).Error("Failed to update password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := s.refresh.RevokeUser(ctx, userID); err != nil {
+		s.log.WithError(err).Warn("Failed to revoke sessions after password reset")
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RequestEmailVerification reenvía el link de verificación al usuario autenticado
+func (s *Server) RequestEmailVerification(c *gin.Context) {
+	claims, _ := middleware.ClaimsFromContext(c)
+
+	var email string
+	var verified bool
+	query := `SELECT COALESCE(email, ''), email_verified_at IS NOT NULL FROM users WHERE id = $1`
+	err := s.db.QueryRow(context.Background(), query, claims.UserID()).Scan(&email, &verified)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User has no email"})
+		return
+	}
+	if verified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already verified"})
+		return
+	}
+
+	if err := s.sendAccountLink(c.Request.Context(), auth.PurposeVerifyEmail, claims.UserID(), email); err != nil {
+		s.log.WithError(err).Error("Failed to send verification email")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "sent"})
+}
+
+// VerifyEmail marca el correo como verificado usando el token del link
+func (s *Server) VerifyEmail(c *gin.Context) {
+	var body struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+
+	userID, err := s.oneTime.Consume(c.Request.Context(), auth.PurposeVerifyEmail, body.Token)
+	if errors.Is(err, auth.ErrOneTimeInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		s.log.WithError(err).Error("Failed to consume verification token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	query := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, now()) WHERE id = $1`
+	if _, err := s.db.Exec(context.Background(), query, userID); err != nil {
+		s.log.WithError(err).Error("Failed to mark email as verified")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/criston04/TaxyTac/backend/internal/auth"
+	"github.com/criston04/TaxyTac/backend/internal/notify"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+// linkToken saca el token del link del último correo enviado a `to` y valida
+// que apunte a la ruta de la app
+func linkToken(t *testing.T, outbox *notify.OutboxEmailSender, to, wantPrefix string) string {
+	t.Helper()
+	email, ok := outbox.Last(to)
+	if !ok {
+		t.Fatalf("no email sent to %s", to)
+	}
+	i := strings.Index(email.Body, wantPrefix)
+	if i < 0 {
+		t.Fatalf("email body has no %s link:\n%s", wantPrefix, email.Body)
+	}
+	link, err := url.Parse(strings.TrimSpace(email.Body[i:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := link.Query().Get("token")
+	if token == "" {
+		t.Fatalf("link %s has no token", link)
+	}
+	return token
+}
+
+func TestSendAccountLink(t *testing.T) {
+	outbox := notify.NewOutboxEmailSender()
+	s := &Server{
+		cfg:     Config{AppBaseURL: "https://app.taxytac.test"},
+		email:   outbox,
+		oneTime: auth.NewOneTimeTokens(newTestRedis(t)),
+	}
+	ctx := context.Background()
+
+	const to = "juan@example.com"
+	if err := s.sendAccountLink(ctx, auth.PurposeVerifyEmail, "user-1", to); err != nil {
+		t.Fatal(err)
+	}
+	verify := linkToken(t, outbox, to, "https://app.taxytac.test/verify-email?token=")
+	if email, _ := outbox.Last(to); email.Subject != accountLinks[auth.PurposeVerifyEmail].subject {
+		t.Errorf("subject = %q", email.Subject)
+	}
+
+	// Pedir el reset dos veces: sólo vale el último link
+	if err := s.sendAccountLink(ctx, auth.PurposePasswordReset, "user-1", to); err != nil {
+		t.Fatal(err)
+	}
+	first := linkToken(t, outbox, to, "https://app.taxytac.test/reset-password?token=")
+	if err := s.sendAccountLink(ctx, auth.PurposePasswordReset, "user-1", to); err != nil {
+		t.Fatal(err)
+	}
+	second := linkToken(t, outbox, to, "https://app.taxytac.test/reset-password?token=")
+	if len(outbox.Messages()) != 3 {
+		t.Fatalf("sent %d emails, want 3", len(outbox.Messages()))
+	}
+
+	if _, err := s.oneTime.Consume(ctx, auth.PurposePasswordReset, first); !errors.Is(err, auth.ErrOneTimeInvalid) {
+		t.Errorf("earlier reset link still valid: err = %v", err)
+	}
+	if userID, err := s.oneTime.Consume(ctx, auth.PurposePasswordReset, second); err != nil || userID != "user-1" {
+		t.Errorf("latest reset link: Consume = %q, %v", userID, err)
+	}
+	if userID, err := s.oneTime.Consume(ctx, auth.PurposeVerifyEmail, verify); err != nil || userID != "user-1" {
+		t.Errorf("verification link: Consume = %q, %v", userID, err)
+	}
+}
+
+func TestAppBaseURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+		ok   bool
+	}{
+		{"https://app.taxytac.pe", "https://app.taxytac.pe", true},
+		{"http://localhost:3000/", "http://localhost:3000", true},
+		{"https://taxytac.pe/app/", "https://taxytac.pe/app", true},
+		{"", "", false},
+		{"localhost:3000", "", false},
+		{"/reset", "", false},
+		{"ftp://taxytac.pe", "", false},
+	}
+	for _, tt := range tests {
+		got, err := appBaseURL(tt.raw)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("appBaseURL(%q) = %q, %v; want %q, ok=%v", tt.raw, got, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/auth"
+	"github.com/criston04/TaxyTac/backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// sessionUser son los datos del usuario que se devuelven al abrir sesión
+type sessionUser struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// respondWithSession emite access + refresh token y responde con la sesión
+func (s *Server) respondWithSession(c *gin.Context, status int, user sessionUser) {
+	token, expiresAt, err := s.tokens.Issue(user.ID, user.Email, user.Role)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to issue token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+
+	refreshToken, err := s.refresh.Create(c.Request.Context(), user.ID)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to create refresh token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+
+	c.JSON(status, gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(time.Until(expiresAt).Seconds()),
+		"user":          user,
+	})
+}
+
+// emailUnverified indica si la cuenta tiene un correo sin verificar y la
+// configuración exige verificarlo para abrir sesión. Las cuentas sólo con
+// teléfono no tienen correo que verificar.
+func (s *Server) emailUnverified(email string, verified bool) bool {
+	return s.cfg.RequireVerifiedEmail && email != "" && !verified
+}
+
+// RefreshToken rota el refresh token y emite un nuevo access token
+func (s *Server) RefreshToken(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	next, session, err := s.refresh.Rotate(ctx, body.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrRefreshReused) {
+			s.log.WithFields(logrus.Fields{
+				"user":   session.UserID,
+				"family": session.Family,
+			}).Warn("Refresh token reuse detected, session revoked")
+		}
+		if errors.Is(err, auth.ErrRefreshNotFound) || errors.Is(err, auth.ErrRefreshReused) || errors.Is(err, auth.ErrRefreshRevoked) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		s.log.WithError(err).Error("Failed to rotate refresh token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	// Releer el usuario para que el token refleje su rol actual
+	var user sessionUser
+	var emailVerified bool
+	query := `
+		SELECT id, name, COALESCE(email, ''), role, email_verified_at IS NOT NULL
+		FROM users WHERE id = $1
+	`
+	err = s.db.QueryRow(context.Background(), query, session.UserID).Scan(
+		&user.ID, &user.Name, &user.Email, &user.Role, &emailVerified,
+	)
+	if err != nil {
+		_ = s.refresh.RevokeFamily(ctx, session.Family)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if s.emailUnverified(user.Email, emailVerified) {
+		_ = s.refresh.RevokeFamily(ctx, session.Family)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email not verified"})
+		return
+	}
+
+	token, expiresAt, err := s.tokens.Issue(user.ID, user.Email, user.Role)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to issue token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"refresh_token": next,
+		"expires_in":    int(time.Until(expiresAt).Seconds()),
+		"user":          user,
+	})
+}
+
+// Logout revoca la sesión a la que pertenece el refresh token
+func (s *Server) Logout(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+
+	err := s.refresh.Revoke(c.Request.Context(), body.RefreshToken)
+	if err != nil && !errors.Is(err, auth.ErrRefreshNotFound) {
+		s.log.WithError(err).Error("Failed to revoke refresh token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/dispatch"
+	"github.com/criston04/TaxyTac/backend/internal/realtime"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Claves de Redis del dispatcher. La oferta y la reserva del driver viven lo
+// mismo que la oferta; la marca del viaje, lo que puede durar el reparto.
+const (
+	dispatchOfferKey  = "dispatch:offer:%s:%s" // trip, driver
+	dispatchDriverKey = "dispatch:driver:%s"   // driver → trip ofrecido
+	dispatchTripKey   = "dispatch:trip:%s"
+)
+
+// errNoOffer: el viaje se está repartiendo y el driver no tiene una oferta vigente
+var errNoOffer = errors.New("no active offer for this driver")
+
+// releaseReservation borra la reserva del driver sólo si sigue siendo de este viaje
+var releaseReservation = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// dispatchBackend conecta el dispatcher con la DB, Redis y los canales de
+// notificación del servidor
+type dispatchBackend struct {
+	s *Server
+}
+
+// Candidates usa la misma búsqueda y el mismo scorer que GET /api/drivers/nearby
+func (b dispatchBackend) Candidates(ctx context.Context, trip dispatch.Trip, radiusM float64) ([]dispatch.Candidate, error) {
+	drivers, _, err := b.s.nearbyDrivers(ctx, trip.OriginLat, trip.OriginLng, radiusM, b.s.cfg.NearbySearch.DefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]dispatch.Candidate, len(drivers))
+	for i, d := range drivers {
+		candidates[i] = dispatch.Candidate{
+			DriverID:  d.ID,
+			UserID:    d.UserID,
+			DistanceM: d.DistanceM,
+			ETAS:      float64(d.ETAS),
+			Score:     d.Score,
+		}
+	}
+	return candidates, nil
+}
+
+func (b dispatchBackend) SendOffer(ctx context.Context, trip dispatch.Trip, offer dispatch.Offer) error {
+	ttl := time.Until(offer.ExpiresAt)
+	reserved, err := b.s.redis.SetNX(ctx, fmt.Sprintf(dispatchDriverKey, offer.DriverID), trip.ID, ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return dispatch.ErrCandidateBusy
+	}
+
+	_, err = b.s.db.Exec(ctx, `
+		INSERT INTO trip_offers (trip_id, driver_id, distance_m, offered_at, expires_at)
+		VALUES ($1, $2, $3, now(), $4)
+		ON CONFLICT (trip_id, driver_id) DO NOTHING
+	`, trip.ID, offer.DriverID, offer.DistanceM, offer.ExpiresAt)
+	if err == nil {
+		pipe := b.s.redis.TxPipeline()
+		pipe.Set(ctx, fmt.Sprintf(dispatchOfferKey, trip.ID, offer.DriverID), 1, ttl)
+		pipe.Set(ctx, fmt.Sprintf(dispatchTripKey, trip.ID), 1, b.s.dispatcher.MaxDuration()+time.Minute)
+		_, err = pipe.Exec(ctx)
+	}
+	if err != nil {
+		b.s.releaseOffer(ctx, trip.ID, offer.DriverID)
+		return err
+	}
+
+	event := gin.H{
+		"trip_id":    trip.ID,
+		"origin_lat": trip.OriginLat,
+		"origin_lng": trip.OriginLng,
+		"dest_lat":   trip.DestLat,
+		"dest_lng":   trip.DestLng,
+		"distance_m": offer.DistanceM,
+		"expires_at": offer.ExpiresAt.Unix(),
+	}
+	if b.s.mqtt != nil {
+		b.s.mqtt.PublishEvent(offer.DriverID, realtime.TypeTripOffer, event)
+	}
+	return b.s.hub.SendToUser(ctx, offer.UserID, realtime.TypeTripOffer, event)
+}
+
+func (b dispatchBackend) CloseOffer(ctx context.Context, offer dispatch.Offer, outcome string) {
+	log := b.s.log.WithField("trip", offer.TripID).WithField("driver", offer.DriverID)
+	b.s.releaseOffer(ctx, offer.TripID, offer.DriverID)
+
+	// Si el driver ya respondió (aceptó o rechazó) no hay nada que avisarle.
+	// Si el viaje ya es suyo la oferta no venció aunque siga pending: el
+	// dispatcher la cierra apenas ve el trip_status de la aceptación.
+	tag, err := b.s.db.Exec(ctx, `
+		UPDATE trip_offers o
+		SET outcome = $3
+		WHERE o.trip_id = $1 AND o.driver_id = $2 AND o.outcome = 'pending'
+			AND NOT EXISTS (SELECT 1 FROM trips t WHERE t.id = o.trip_id AND t.driver_id = o.driver_id)
+	`, offer.TripID, offer.DriverID, outcome)
+	if err != nil {
+		log.WithError(err).Warn("Failed to record trip offer outcome")
+	} else if tag.RowsAffected() == 0 {
+		return
+	}
+
+	event := gin.H{"trip_id": offer.TripID, "reason": outcome}
+	if b.s.mqtt != nil {
+		b.s.mqtt.PublishEvent(offer.DriverID, realtime.TypeTripOfferClosed, event)
+	}
+	if err := b.s.hub.SendToUser(ctx, offer.UserID, realtime.TypeTripOfferClosed, event); err != nil {
+		log.WithError(err).Warn("Failed to push trip offer close")
+	}
+}
+
+func (b dispatchBackend) WatchTrip(tripID string) *realtime.Listener {
+	return b.s.hub.Listen(realtime.TripTopic(tripID), realtime.OfferTopic(tripID))
+}
+
+func (b dispatchBackend) TripStatus(ctx context.Context, tripID string) (string, error) {
+	var status string
+	err := b.s.db.QueryRow(ctx, `SELECT status FROM trips WHERE id = $1`, tripID).Scan(&status)
+	return status, err
+}
+
+func (b dispatchBackend) MarkNoDrivers(ctx context.Context, tripID string) (bool, error) {
+	tag, err := b.s.db.Exec(ctx, `
+		UPDATE trips
+		SET status = 'no_drivers', ended_at = now()
+		WHERE id = $1 AND status = 'requested'
+	`, tripID)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	b.s.notifyTripStatus(tripID, "no_drivers")
+	return true, nil
+}
+
+func (b dispatchBackend) ExpireStale(ctx context.Context, maxAge time.Duration) (int, error) {
+	rows, err := b.s.db.Query(ctx, `
+		UPDATE trips
+		SET status = 'no_drivers', ended_at = now()
+		WHERE status = 'requested' AND created_at < now() - make_interval(secs => $1)
+		RETURNING id
+	`, maxAge.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		b.s.notifyTripStatus(id, "no_drivers")
+	}
+	return len(ids), nil
+}
+
+// releaseOffer borra la oferta de Redis y libera la reserva del driver
+func (s *Server) releaseOffer(ctx context.Context, tripID, driverID string) {
+	log := s.log.WithField("trip", tripID).WithField("driver", driverID)
+	if err := s.redis.Del(ctx, fmt.Sprintf(dispatchOfferKey, tripID, driverID)).Err(); err != nil {
+		log.WithError(err).Warn("Failed to delete trip offer")
+	}
+	key := fmt.Sprintf(dispatchDriverKey, driverID)
+	if err := releaseReservation.Run(ctx, s.redis, []string{key}, tripID).Err(); err != nil {
+		log.WithError(err).Warn("Failed to release driver reservation")
+	}
+}
+
+// checkOffer exige que, si el viaje lo está repartiendo el dispatcher, el
+// driver tenga una oferta vigente. Si Redis falla se deja pasar: la
+// transacción de AcceptTrip sigue garantizando un solo ganador.
+func (s *Server) checkOffer(ctx context.Context, tripID, driverID string) error {
+	if !s.dispatcher.Enabled() {
+		return nil
+	}
+	pipe := s.redis.Pipeline()
+	dispatched := pipe.Exists(ctx, fmt.Sprintf(dispatchTripKey, tripID))
+	offered := pipe.Exists(ctx, fmt.Sprintf(dispatchOfferKey, tripID, driverID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.log.WithError(err).Warn("Failed to check trip offer")
+		return nil
+	}
+	if dispatched.Val() == 1 && offered.Val() == 0 {
+		return errNoOffer
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// requiredDocumentTypes son los documentos que un driver necesita aprobados y
+// vigentes para ponerse en línea: brevete, SOAT y tarjeta de propiedad
+var requiredDocumentTypes = []string{"license", "soat", "vehicle_registration"}
+
+// documentTransitions es la máquina de estados de revisión de documentos
+var documentTransitions = map[string][]string{
+	"pending":  {"approved", "rejected"},
+	"approved": {"expired"},
+}
+
+var (
+	errInvalidTransition = errors.New("invalid document status transition")
+	errDocumentExpired   = errors.New("document expired")
+)
+
+// missingDocumentsError indica qué documentos impiden ponerse en línea
+type missingDocumentsError struct {
+	Types []string
+}
+
+func (e *missingDocumentsError) Error() string {
+	return "required documents not approved"
+}
+
+// querier es lo común entre *pgxpool.Pool y pgx.Tx para consultas
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// DriverDocument es la metadata de un documento subido por un driver
+type DriverDocument struct {
+	ID              string     `json:"id"`
+	DriverID        string     `json:"driver_id"`
+	Type            string     `json:"type"`
+	Number          *string    `json:"number,omitempty"`
+	FileURL         string     `json:"file_url"`
+	FileName        *string    `json:"file_name,omitempty"`
+	ContentType     *string    `json:"content_type,omitempty"`
+	SizeBytes       *int64     `json:"size_bytes,omitempty"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	Status          string     `json:"status"`
+	RejectionReason *string    `json:"rejection_reason,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+const documentColumns = `id, driver_id, type, number, file_url, file_name, content_type, size_bytes,
+	expires_at, status, rejection_reason, reviewed_at, created_at`
+
+func scanDocument(row pgx.Row) (*DriverDocument, error) {
+	var d DriverDocument
+	err := row.Scan(&d.ID, &d.DriverID, &d.Type, &d.Number, &d.FileURL, &d.FileName, &d.ContentType,
+		&d.SizeBytes, &d.ExpiresAt, &d.Status, &d.RejectionReason, &d.ReviewedAt, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func canTransition(from, to string) bool {
+	for _, next := range documentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// expireDocuments pasa a expired los documentos aprobados cuya fecha venció
+func (s *Server) expireDocuments(ctx context.Context) {
+	query := `UPDATE driver_documents SET status = 'expired' WHERE status = 'approved' AND expires_at < current_date`
+	if _, err := s.db.Exec(ctx, query); err != nil {
+		s.log.WithError(err).Warn("Failed to expire driver documents")
+	}
+}
+
+// missingDocuments devuelve los tipos requeridos sin un documento aprobado y vigente
+func missingDocuments(ctx context.Context, q querier, driverID string) ([]string, error) {
+	query := `
+		SELECT t.type
+		FROM unnest($2::text[]) AS t(type)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM driver_documents d
+			WHERE d.driver_id = $1 AND d.type = t.type
+				AND d.status = 'approved' AND d.expires_at >= current_date
+		)
+	`
+	rows, err := q.Query(ctx, query, driverID, requiredDocumentTypes)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// ListMyDocuments lista los documentos del driver y los que le faltan
+func (s *Server) ListMyDocuments(c *gin.Context) {
+	driverID, ok := currentDriverID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	s.expireDocuments(ctx)
+
+	query := `SELECT ` + documentColumns + ` FROM driver_documents WHERE driver_id = $1 ORDER BY created_at DESC`
+	rows, err := s.db.Query(ctx, query, driverID)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to query driver documents")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query documents"})
+		return
+	}
+	defer rows.Close()
+
+	documents := []*DriverDocument{}
+	for rows.Next() {
+		d, err := scanDocument(rows)
+		if err != nil {
+			s.log.WithError(err).Warn("Failed to scan document row")
+			continue
+		}
+		documents = append(documents, d)
+	}
+
+	missing, err := missingDocuments(ctx, s.db, driverID)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to check missing documents")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query documents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"documents": documents,
+		"missing":   missing,
+		"ready":     len(missing) == 0,
+	})
+}
+
+// UploadMyDocument registra la metadata de un documento ya subido al storage.
+// Cada envío crea una versión nueva en estado pending.
+func (s *Server) UploadMyDocument(c *gin.Context) {
+	driverID, ok := currentDriverID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Type        string `json:"type" binding:"required,oneof=license soat vehicle_registration"`
+		Number      string `json:"number"`
+		FileURL     string `json:"file_url" binding:"required"`
+		FileName    string `json:"file_name"`
+		ContentType string `json:"content_type"`
+		SizeBytes   int64  `json:"size_bytes"`
+		ExpiresAt   string `json:"expires_at" binding:"required"` // YYYY-MM-DD
+	}
+
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+
+	var errs []*middleware.ValidationError
+	if u, err := url.Parse(body.FileURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, middleware.NewValidationError("file_url", "url"))
+	}
+	expiresAt, err := time.Parse("2006-01-02", body.ExpiresAt)
+	if err != nil {
+		errs = append(errs, middleware.NewValidationError("expires_at", "date"))
+	} else if expiresAt.Before(time.Now().Truncate(24 * time.Hour)) {
+		errs = append(errs, middleware.NewValidationError("expires_at", "past"))
+	}
+	if len(errs) > 0 {
+		middleware.RespondWithValidationErrors(c, errs)
+		return
+	}
+
+	query := `
+		INSERT INTO driver_documents
+			(driver_id, type, number, file_url, file_name, content_type, size_bytes, expires_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, 0), $8)
+		RETURNING ` + documentColumns
+
+	doc, err := scanDocument(s.db.QueryRow(context.Background(), query,
+		driverID, body.Type, body.Number, body.FileURL, body.FileName, body.ContentType, body.SizeBytes, expiresAt))
+	if err != nil {
+		s.log.WithError(err).Error("Failed to create driver document")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save document"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, doc)
+}
+
+// ListDocumentsForReview lista documentos por estado (admin), por defecto los pendientes
+func (s *Server) ListDocumentsForReview(c *gin.Context) {
+	status := c.DefaultQuery("status", "pending")
+	switch status {
+	case "pending", "approved", "rejected", "expired":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	s.expireDocuments(ctx)
+
+	query := `SELECT ` + documentColumns + ` FROM driver_documents WHERE status = $1 ORDER BY created_at ASC LIMIT 100`
+	rows, err := s.db.Query(ctx, query, status)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to query documents for review")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query documents"})
+		return
+	}
+	defer rows.Close()
+
+	documents := []*DriverDocument{}
+	for rows.Next() {
+		d, err := scanDocument(rows)
+		if err != nil {
+			s.log.WithError(err).Warn("Failed to scan document row")
+			continue
+		}
+		documents = append(documents, d)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"documents": documents,
+		"count":     len(documents),
+	})
+}
+
+// ApproveDocument aprueba un documento pendiente (admin)
+func (s *Server) ApproveDocument(c *gin.Context) {
+	s.reviewDocument(c, "approved", "")
+}
+
+// RejectDocument rechaza un documento pendiente indicando el motivo (admin)
+func (s *Server) RejectDocument(c *gin.Context) {
+	var body struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+
+	s.reviewDocument(c, "rejected", body.Reason)
+}
+
+func (s *Server) reviewDocument(c *gin.Context, status, reason string) {
+	claims, _ := middleware.ClaimsFromContext(c)
+	ctx := c.Request.Context()
+
+	var doc *DriverDocument
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		var current string
+		var expiresAt time.Time
+		query := `SELECT status, expires_at FROM driver_documents WHERE id = $1 FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, c.Param("id")).Scan(&current, &expiresAt); err != nil {
+			return err
+		}
+		if !canTransition(current, status) {
+			return errInvalidTransition
+		}
+		if status == "approved" && expiresAt.Before(time.Now().Truncate(24*time.Hour)) {
+			return errDocumentExpired
+		}
+
+		update := `
+			UPDATE driver_documents
+			SET status = $2, rejection_reason = NULLIF($3, ''), reviewed_by = $4, reviewed_at = now()
+			WHERE id = $1
+			RETURNING ` + documentColumns
+		var err error
+		doc, err = scanDocument(tx.QueryRow(ctx, update, c.Param("id"), status, reason, claims.UserID()))
+		return err
+	})
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	case errors.Is(err, errInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": "Document is not pending review"})
+		return
+	case errors.Is(err, errDocumentExpired):
+		c.JSON(http.StatusConflict, gin.H{"error": "Document has expired"})
+		return
+	case err != nil:
+		s.log.WithError(err).Error("Failed to review document")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review document"})
+		return
+	}
+
+	c.JSON(http.StatusOK, doc)
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// recentLocationWindow es la antigüedad máxima de la última ubicación para
+// poder ponerse en línea
+const recentLocationWindow = 2 * time.Minute
+
+var (
+	errDriverNotAvailable = errors.New("driver not available")
+	errDriverBusy         = errors.New("driver busy")
+	errNoVehicle          = errors.New("driver has no vehicle")
+	errNoRecentLocation   = errors.New("driver has no recent location")
+)
+
+// currentDriverID devuelve el driver del token; los admin no tienen uno propio
+func currentDriverID(c *gin.Context) (string, bool) {
+	driverID := c.GetString(ctxDriverID)
+	if driverID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User has no driver profile"})
+		return "", false
+	}
+	return driverID, true
+}
+
+// UpdateMyStatus pone al driver en línea (available) o fuera de línea (offline)
+// y abre o cierra su turno
+func (s *Server) UpdateMyStatus(c *gin.Context) {
+	driverID, ok := currentDriverID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Status string `json:"status" binding:"required,oneof=available offline"`
+	}
+
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		var current string
+		err := tx.QueryRow(ctx, `SELECT status FROM drivers WHERE id = $1 FOR UPDATE`, driverID).Scan(&current)
+		if err != nil {
+			return err
+		}
+		if current == "busy" {
+			return errDriverBusy
+		}
+		if current == body.Status {
+			return nil
+		}
+
+		if body.Status == "available" {
+			if err := s.checkCanGoOnline(ctx, tx, driverID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `INSERT INTO driver_shifts (driver_id) VALUES ($1)`, driverID); err != nil {
+				return err
+			}
+		} else {
+			query := `UPDATE driver_shifts SET ended_at = now() WHERE driver_id = $1 AND ended_at IS NULL`
+			if _, err := tx.Exec(ctx, query, driverID); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE drivers SET status = $1 WHERE id = $2`, body.Status, driverID)
+		return err
+	})
+
+	var missingDocs *missingDocumentsError
+	switch {
+	case errors.As(err, &missingDocs):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Required documents are not approved",
+			"missing": missingDocs.Types,
+		})
+		return
+	case errors.Is(err, errDriverBusy):
+		c.JSON(http.StatusConflict, gin.H{"error": "Driver is on a trip"})
+		return
+	case errors.Is(err, errNoVehicle):
+		c.JSON(http.StatusConflict, gin.H{"error": "An active vehicle is required to go online"})
+		return
+	case errors.Is(err, errNoRecentLocation):
+		c.JSON(http.StatusConflict, gin.H{"error": "Send your location before going online"})
+		return
+	case err != nil:
+		s.log.WithError(err).Error("Failed to update driver status")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status"})
+		return
+	}
+
+	// Fuera de línea deja de aparecer en las búsquedas aunque siga reportando
+	if body.Status == "offline" {
+		if err := s.geo.Remove(ctx, driverID); err != nil {
+			s.log.WithError(err).Warn("Failed to remove driver from geo index")
+		}
+		// Al volver no se compara contra la última posición de la jornada anterior
+		s.filter.Forget(driverID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"driver_id": driverID,
+		"status":    body.Status,
+	})
+}
+
+// checkCanGoOnline aplica las reglas para pasar a available
+func (s *Server) checkCanGoOnline(ctx context.Context, tx pgx.Tx, driverID string) error {
+	var hasVehicle, hasLocation bool
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM vehicles WHERE driver_id = $1 AND is_active),
+			EXISTS (SELECT 1 FROM locations WHERE driver_id = $1 AND ts > now() - make_interval(secs => $2))
+	`
+	err := tx.QueryRow(ctx, query, driverID, recentLocationWindow.Seconds()).Scan(&hasVehicle, &hasLocation)
+	if err != nil {
+		return err
+	}
+	if !hasVehicle {
+		return errNoVehicle
+	}
+	if !hasLocation {
+		return errNoRecentLocation
+	}
+
+	missing, err := missingDocuments(ctx, tx, driverID)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return &missingDocumentsError{Types: missing}
+	}
+	return nil
+}
+
+// GetMyShifts lista los turnos del driver y el total de horas en línea
+func (s *Server) GetMyShifts(c *gin.Context) {
+	driverID, ok := currentDriverID(c)
+	if !ok {
+		return
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be RFC3339"})
+			return
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be RFC3339"})
+			return
+		}
+		to = t
+	}
+
+	// Los turnos abiertos cuentan hasta ahora
+	query := `
+		SELECT id, started_at, ended_at,
+			EXTRACT(EPOCH FROM (COALESCE(ended_at, now()) - started_at))::bigint AS duration_s
+		FROM driver_shifts
+		WHERE driver_id = $1 AND started_at >= $2 AND started_at < $3
+		ORDER BY started_at DESC
+	`
+
+	rows, err := s.db.Query(context.Background(), query, driverID, from, to)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to query driver shifts")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query shifts"})
+		return
+	}
+	defer rows.Close()
+
+	type Shift struct {
+		ID        string     `json:"id"`
+		StartedAt time.Time  `json:"started_at"`
+		EndedAt   *time.Time `json:"ended_at"`
+		DurationS int64      `json:"duration_s"`
+	}
+
+	shifts := []Shift{}
+	var totalS int64
+	for rows.Next() {
+		var sh Shift
+		if err := rows.Scan(&sh.ID, &sh.StartedAt, &sh.EndedAt, &sh.DurationS); err != nil {
+			s.log.WithError(err).Warn("Failed to scan shift row")
+			continue
+		}
+		totalS += sh.DurationS
+		shifts = append(shifts, sh)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"shifts":      shifts,
+		"count":       len(shifts),
+		"total_s":     totalS,
+		"total_hours": float64(totalS) / 3600,
+	})
+}
+
+// markDriverBusy pasa al driver de available a busy dentro de la transacción
+func markDriverBusy(ctx context.Context, tx pgx.Tx, driverID string) error {
+	tag, err := tx.Exec(ctx, `UPDATE drivers SET status = 'busy' WHERE id = $1 AND status = 'available'`, driverID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errDriverNotAvailable
+	}
+	return nil
+}
+
+// releaseDriver devuelve al driver a available al terminar o cancelarse su viaje
+func releaseDriver(ctx context.Context, tx pgx.Tx, driverID string) error {
+	_, err := tx.Exec(ctx, `UPDATE drivers SET status = 'available' WHERE id = $1 AND status = 'busy'`, driverID)
+	return err
+}
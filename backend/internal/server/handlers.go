@@ -3,23 +3,21 @@ package server
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/criston04/TaxyTac/backend/internal/auth"
+	"github.com/criston04/TaxyTac/backend/internal/dispatch"
+	"github.com/criston04/TaxyTac/backend/internal/middleware"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
-	"github.com/sirupsen/logrus"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var wsUpgrader = websocket.Upgrader{
-	CheckOrigin:     func(r *http.Request) bool { return true },
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-}
-
 // hashPassword genera un hash bcrypt de la contraseña
 func hashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -34,11 +32,19 @@ func verifyPassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
 
-// generateMockJWT genera un token simple (mock) - en producción usar JWT real
-func generateMockJWT(userID, email, role string) string {
-	return fmt.Sprintf("mock.jwt.%s.%s.%s.%d", userID, email, role, time.Now().Unix())
+// isUniqueViolation indica si el error de Postgres es una violación de UNIQUE
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
 }
 
+// activeVehicleJSON arma el vehículo activo (alias v, LEFT JOIN) como JSON
+const activeVehicleJSON = `
+	CASE WHEN v.id IS NULL THEN NULL ELSE json_build_object(
+		'id', v.id, 'make', v.make, 'model', v.model, 'plate', v.plate,
+		'color', v.color, 'photos', v.photos
+	) END`
+
 // LocationPayload representa la ubicación enviada por el driver
 type LocationPayload struct {
 	DriverID string  `json:"driver_id"`
@@ -47,39 +53,62 @@ type LocationPayload struct {
 	TS       int64   `json:"ts"`
 	Speed    float64 `json:"speed,omitempty"`
 	Heading  float64 `json:"heading,omitempty"`
+	// Seq es el contador del dispositivo; permite descartar reenvíos
+	Seq int64 `json:"seq,omitempty"`
 }
 
 // HealthCheck verifica el estado del servidor
 func (s *Server) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"status": "ok",
-		"time":   time.Now().Unix(),
+		"status":         "ok",
+		"time":           time.Now().Unix(),
+		"ws_connections": s.hub.Connections(),
 	})
 }
 
 // Register crea un nuevo usuario (rider o driver)
 func (s *Server) Register(c *gin.Context) {
+	// Sin tags binding: los validadores reportan todos los campos a la vez
 	var body struct {
-		Name     string `json:"name" binding:"required"`
+		Name     string `json:"name"`
 		Phone    string `json:"phone"`
-		Email    string `json:"email" binding:"required"`
-		Password string `json:"password" binding:"required,min=6"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
 		Role     string `json:"role"` // rider|driver (opcional, por defecto passenger)
 	}
 
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+	if !middleware.BindJSON(c, &body) {
 		return
 	}
 
+	body.Name = strings.TrimSpace(body.Name)
+	body.Email = strings.TrimSpace(body.Email)
+
 	// Si no se proporciona role, usar "passenger" por defecto
 	if body.Role == "" {
 		body.Role = "passenger"
 	}
 
-	// Validar role
+	var errs []*middleware.ValidationError
+	for _, verr := range []*middleware.ValidationError{
+		middleware.ValidateName(body.Name),
+		middleware.ValidateEmail(body.Email),
+		middleware.ValidatePassword(body.Password),
+	} {
+		if verr != nil {
+			errs = append(errs, verr)
+		}
+	}
+	if body.Phone != "" {
+		if verr := middleware.ValidatePhone(normalizePhone(body.Phone)); verr != nil {
+			errs = append(errs, verr)
+		}
+	}
 	if body.Role != "passenger" && body.Role != "rider" && body.Role != "driver" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be 'passenger', 'rider' or 'driver'"})
+		errs = append(errs, middleware.NewValidationError("role", "oneof", "passenger", "rider", "driver"))
+	}
+	if len(errs) > 0 {
+		middleware.RespondWithValidationErrors(c, errs)
 		return
 	}
 
@@ -103,10 +132,11 @@ func (s *Server) Register(c *gin.Context) {
 	// Crear usuario en DB
 	userID := uuid.New().String()
 
-	// Si no tiene phone, usar un valor dummy
-	phone := body.Phone
-	if phone == "" {
-		phone = "000000000"
+	// El teléfono es opcional (UNIQUE admite varios NULL)
+	var phone *string
+	if body.Phone != "" {
+		normalized := normalizePhone(body.Phone)
+		phone = &normalized
 	}
 
 	query := `
@@ -119,6 +149,10 @@ func (s *Server) Register(c *gin.Context) {
 	err = s.db.QueryRow(context.Background(), query,
 		userID, body.Name, phone, body.Email, hashedPassword, body.Role).Scan(&returnedID)
 
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone already registered"})
+		return
+	}
 	if err != nil {
 		s.log.WithError(err).Error("Failed to create user")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
@@ -137,18 +171,27 @@ func (s *Server) Register(c *gin.Context) {
 		}
 	}
 
-	// Generar token JWT simple (mock)
-	token := generateMockJWT(returnedID, body.Email, body.Role)
+	if err := s.sendAccountLink(c.Request.Context(), auth.PurposeVerifyEmail, returnedID, body.Email); err != nil {
+		s.log.WithError(err).Warn("Failed to send verification email")
+	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":    returnedID,
-			"name":  body.Name,
-			"email": body.Email,
-			"role":  body.Role,
-		},
-	})
+	user := sessionUser{
+		ID:    returnedID,
+		Name:  body.Name,
+		Email: body.Email,
+		Role:  body.Role,
+	}
+
+	// Sin correo verificado no hay sesión: se abre con Login tras el link
+	if s.cfg.RequireVerifiedEmail {
+		c.JSON(http.StatusCreated, gin.H{
+			"user":                        user,
+			"email_verification_required": true,
+		})
+		return
+	}
+
+	s.respondWithSession(c, http.StatusCreated, user)
 }
 
 // Login autentica un usuario con email/password
@@ -158,29 +201,29 @@ func (s *Server) Login(c *gin.Context) {
 		Password string `json:"password" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+	if !middleware.BindJSON(c, &body) {
 		return
 	}
 
 	// Buscar usuario por email
 	var user struct {
-		ID           string
-		Name         string
-		Email        string
-		Role         string
-		PasswordHash string
+		ID            string
+		Name          string
+		Email         string
+		Role          string
+		PasswordHash  string
+		EmailVerified bool
 	}
 
 	query := `
-		SELECT id, name, email, role, password_hash
+		SELECT id, name, email, role, password_hash, email_verified_at IS NOT NULL
 		FROM users
 		WHERE email = $1
 		LIMIT 1
 	`
 
 	err := s.db.QueryRow(context.Background(), query, body.Email).Scan(
-		&user.ID, &user.Name, &user.Email, &user.Role, &user.PasswordHash,
+		&user.ID, &user.Name, &user.Email, &user.Role, &user.PasswordHash, &user.EmailVerified,
 	)
 
 	if err != nil {
@@ -194,103 +237,55 @@ func (s *Server) Login(c *gin.Context) {
 		return
 	}
 
-	// Generar token JWT simple (mock)
-	token := generateMockJWT(user.ID, user.Email, user.Role)
-
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":    user.ID,
-			"name":  user.Name,
-			"email": user.Email,
-			"role":  user.Role,
-		},
-	})
-}
-
-// GetDriversNearby busca drivers cercanos usando PostGIS
-func (s *Server) GetDriversNearby(c *gin.Context) {
-	lat := c.Query("lat")
-	lng := c.Query("lng")
-	radius := c.DefaultQuery("radius", "1000") // metros
-
-	if lat == "" || lng == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lng are required"})
+	if s.emailUnverified(user.Email, user.EmailVerified) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email not verified"})
 		return
 	}
 
-	// Query PostGIS para drivers cercanos
-	query := `
-		SELECT 
-			d.id,
-			d.user_id,
-			ST_Distance(
-				l.geom, 
-				ST_GeogFromText('SRID=4326;POINT(' || $1 || ' ' || $2 || ')')
-			) AS distance_m,
-			ST_Y(l.geom::geometry) AS lat,
-			ST_X(l.geom::geometry) AS lng
-		FROM drivers d
-		JOIN locations l ON l.driver_id = d.id
-		WHERE 
-			d.status = 'available'
-			AND l.ts > now() - INTERVAL '15 seconds'
-			AND ST_DWithin(
-				l.geom,
-				ST_GeogFromText('SRID=4326;POINT(' || $1 || ' ' || $2 || ')'),
-				$3
-			)
-		ORDER BY distance_m ASC
-		LIMIT 20
-	`
-
-	rows, err := s.db.Query(context.Background(), query, lng, lat, radius)
-	if err != nil {
-		s.log.WithError(err).Error("Failed to query nearby drivers")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query drivers"})
-		return
-	}
-	defer rows.Close()
-
-	type Driver struct {
-		ID        string  `json:"driver_id"`
-		UserID    string  `json:"user_id"`
-		DistanceM float64 `json:"distance_m"`
-		Lat       float64 `json:"lat"`
-		Lng       float64 `json:"lng"`
-	}
+	s.respondWithSession(c, http.StatusOK, sessionUser{
+		ID:    user.ID,
+		Name:  user.Name,
+		Email: user.Email,
+		Role:  user.Role,
+	})
+}
 
-	var drivers []Driver
-	for rows.Next() {
-		var d Driver
-		if err := rows.Scan(&d.ID, &d.UserID, &d.DistanceM, &d.Lat, &d.Lng); err != nil {
-			s.log.WithError(err).Warn("Failed to scan driver row")
-			continue
-		}
-		drivers = append(drivers, d)
-	}
+// Me devuelve la identidad del access token actual
+func (s *Server) Me(c *gin.Context) {
+	claims, _ := middleware.ClaimsFromContext(c)
 
 	c.JSON(http.StatusOK, gin.H{
-		"drivers": drivers,
-		"count":   len(drivers),
+		"id":         claims.UserID(),
+		"email":      claims.Email,
+		"role":       claims.Role,
+		"expires_at": claims.ExpiresAt.Unix(),
 	})
 }
 
-// CreateTrip crea una nueva solicitud de viaje
+// CreateTrip crea una nueva solicitud de viaje para el pasajero autenticado
 func (s *Server) CreateTrip(c *gin.Context) {
 	var body struct {
-		RiderID   string  `json:"rider_id" binding:"required"`
+		RiderID   string  `json:"rider_id"` // sólo admin puede crear a nombre de otro
 		OriginLat float64 `json:"origin_lat" binding:"required"`
 		OriginLng float64 `json:"origin_lng" binding:"required"`
 		DestLat   float64 `json:"dest_lat" binding:"required"`
 		DestLng   float64 `json:"dest_lng" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+	if !middleware.BindJSON(c, &body) {
 		return
 	}
 
+	claims, _ := middleware.ClaimsFromContext(c)
+	riderID := claims.UserID()
+	if claims.IsAdmin() {
+		if body.RiderID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rider_id is required"})
+			return
+		}
+		riderID = body.RiderID
+	}
+
 	tripID := uuid.New().String()
 
 	query := `
@@ -307,7 +302,7 @@ func (s *Server) CreateTrip(c *gin.Context) {
 
 	var returnedID string
 	err := s.db.QueryRow(context.Background(), query,
-		tripID, body.RiderID, body.OriginLng, body.OriginLat, body.DestLng, body.DestLat).Scan(&returnedID)
+		tripID, riderID, body.OriginLng, body.OriginLat, body.DestLng, body.DestLat).Scan(&returnedID)
 
 	if err != nil {
 		s.log.WithError(err).Error("Failed to create trip")
@@ -315,26 +310,144 @@ func (s *Server) CreateTrip(c *gin.Context) {
 		return
 	}
 
+	s.dispatcher.Dispatch(dispatch.Trip{
+		ID:        returnedID,
+		RiderID:   riderID,
+		OriginLat: body.OriginLat,
+		OriginLng: body.OriginLng,
+		DestLat:   body.DestLat,
+		DestLng:   body.DestLng,
+	})
+
 	c.JSON(http.StatusCreated, gin.H{
 		"trip_id": returnedID,
 		"status":  "requested",
 	})
 }
 
-// AcceptTrip permite a un driver aceptar un viaje
-func (s *Server) AcceptTrip(c *gin.Context) {
+// GetTrip devuelve el viaje con el driver asignado y su vehículo activo
+func (s *Server) GetTrip(c *gin.Context) {
+	query := `
+		SELECT
+			t.id,
+			t.status,
+			t.rider_id,
+			t.driver_id,
+			ST_Y(t.origin::geometry), ST_X(t.origin::geometry),
+			ST_Y(t.destination::geometry), ST_X(t.destination::geometry),
+			t.price,
+			t.distance_m,
+			t.created_at,
+			t.started_at,
+			t.ended_at,
+			` + activeVehicleJSON + ` AS vehicle
+		FROM trips t
+		LEFT JOIN vehicles v ON v.driver_id = t.driver_id AND v.is_active
+		WHERE t.id = $1
+	`
+
+	var trip struct {
+		ID        string          `json:"trip_id"`
+		Status    string          `json:"status"`
+		RiderID   *string         `json:"rider_id"`
+		DriverID  *string         `json:"driver_id"`
+		OriginLat float64         `json:"origin_lat"`
+		OriginLng float64         `json:"origin_lng"`
+		DestLat   float64         `json:"dest_lat"`
+		DestLng   float64         `json:"dest_lng"`
+		Price     *float64        `json:"price"`
+		DistanceM *float64        `json:"distance_m"`
+		CreatedAt time.Time       `json:"created_at"`
+		StartedAt *time.Time      `json:"started_at"`
+		EndedAt   *time.Time      `json:"ended_at"`
+		Vehicle   json.RawMessage `json:"vehicle"`
+	}
+
+	err := s.db.QueryRow(context.Background(), query, c.Param("id")).Scan(
+		&trip.ID, &trip.Status, &trip.RiderID, &trip.DriverID,
+		&trip.OriginLat, &trip.OriginLng, &trip.DestLat, &trip.DestLng,
+		&trip.Price, &trip.DistanceM, &trip.CreatedAt, &trip.StartedAt, &trip.EndedAt,
+		&trip.Vehicle,
+	)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to load trip")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trip not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, trip)
+}
+
+// CancelTrip cancela un viaje que aún no ha iniciado; puede hacerlo el
+// pasajero, el driver asignado o un admin, y queda registrado quién fue
+func (s *Server) CancelTrip(c *gin.Context) {
 	tripID := c.Param("id")
 
-	var body struct {
-		DriverID string `json:"driver_id" binding:"required"`
+	claims, _ := middleware.ClaimsFromContext(c)
+	trip := c.MustGet(ctxTrip).(*tripParties)
+	cancelledBy := "rider"
+	switch {
+	case claims.IsAdmin():
+		cancelledBy = "admin"
+	case tripDriverPolicy(claims, c.GetString(ctxDriverID), trip):
+		cancelledBy = "driver"
 	}
 
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+	query := `
+		UPDATE trips
+		SET status = 'cancelled', ended_at = now(), cancelled_by = $2
+		WHERE id = $1 AND status IN ('requested', 'accepted')
+		RETURNING id, driver_id
+	`
+
+	ctx := c.Request.Context()
+	var returnedID string
+	var driverID *string
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, query, tripID, cancelledBy).Scan(&returnedID, &driverID); err != nil {
+			return err
+		}
+		if driverID == nil {
+			return nil
+		}
+		return releaseDriver(ctx, tx, *driverID)
+	})
+
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Trip can no longer be cancelled"})
 		return
 	}
 
-	// Actualizar trip con driver_id y cambiar status a 'accepted'
+	s.notifyTripStatus(returnedID, "cancelled")
+
+	c.JSON(http.StatusOK, gin.H{
+		"trip_id": returnedID,
+		"status":  "cancelled",
+	})
+}
+
+// AcceptTrip permite al driver autenticado aceptar un viaje
+func (s *Server) AcceptTrip(c *gin.Context) {
+	tripID := c.Param("id")
+
+	driverID := c.GetString(ctxDriverID)
+	if claims, _ := middleware.ClaimsFromContext(c); claims.IsAdmin() {
+		// Un admin puede asignar el viaje a un driver concreto
+		var body struct {
+			DriverID string `json:"driver_id" binding:"required"`
+		}
+		if !middleware.BindJSON(c, &body) {
+			return
+		}
+		driverID = body.DriverID
+	} else if err := s.checkOffer(c.Request.Context(), tripID, driverID); err != nil {
+		// Con el dispatcher activo sólo acepta quien recibió la oferta
+		c.JSON(http.StatusConflict, gin.H{"error": "No active offer for this trip"})
+		return
+	}
+
+	// Actualizar trip con driver_id y cambiar status a 'accepted'; el driver
+	// pasa a 'busy' en la misma transacción
 	query := `
 		UPDATE trips 
 		SET driver_id = $1, status = 'accepted'
@@ -342,18 +455,47 @@ func (s *Server) AcceptTrip(c *gin.Context) {
 		RETURNING id
 	`
 
+	ctx := c.Request.Context()
 	var returnedID string
-	err := s.db.QueryRow(context.Background(), query, body.DriverID, tripID).Scan(&returnedID)
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		if err := markDriverBusy(ctx, tx, driverID); err != nil {
+			return err
+		}
+		// Si el viaje llegó como oferta, queda registrada como aceptada. Va
+		// antes que el viaje para bloquear la fila: un CloseOffer simultáneo
+		// espera al commit y ya no la encuentra pending.
+		_, err := tx.Exec(ctx, `
+			UPDATE trip_offers SET outcome = 'accepted', responded_at = now()
+			WHERE trip_id = $1 AND driver_id = $2 AND outcome = 'pending'
+		`, tripID, driverID)
+		if err != nil {
+			return err
+		}
+		return tx.QueryRow(ctx, query, driverID, tripID).Scan(&returnedID)
+	})
 
+	if errors.Is(err, errDriverNotAvailable) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Driver is not available"})
+		return
+	}
 	if err != nil {
 		s.log.WithError(err).Error("Failed to accept trip")
 		c.JSON(http.StatusNotFound, gin.H{"error": "Trip not found or already accepted"})
 		return
 	}
 
+	s.notifyTripStatus(returnedID, "accepted")
+
+	vehicle, err := s.activeVehicle(ctx, driverID)
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to load active vehicle")
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"trip_id": returnedID,
-		"status":  "accepted",
+		"trip_id":   returnedID,
+		"status":    "accepted",
+		"driver_id": driverID,
+		"vehicle":   vehicle,
 	})
 }
 
@@ -372,18 +514,19 @@ func (s *Server) StartTrip(c *gin.Context) {
 	err := s.db.QueryRow(context.Background(), query, tripID).Scan(&returnedID)
 
 	if err != nil {
-		s.log.WithError(err).Error("Failed to start trip")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Trip not found"})
+		c.JSON(http.StatusConflict, gin.H{"error": "Trip is not accepted"})
 		return
 	}
 
+	s.notifyTripStatus(returnedID, "started")
+
 	c.JSON(http.StatusOK, gin.H{
 		"trip_id": returnedID,
 		"status":  "started",
 	})
 }
 
-// EndTrip finaliza el viaje
+// EndTrip finaliza el viaje y deja al driver disponible otra vez
 func (s *Server) EndTrip(c *gin.Context) {
 	tripID := c.Param("id")
 
@@ -391,99 +534,33 @@ func (s *Server) EndTrip(c *gin.Context) {
 		UPDATE trips 
 		SET status = 'completed', ended_at = now()
 		WHERE id = $1 AND status = 'started'
-		RETURNING id
+		RETURNING id, driver_id
 	`
 
-	var returnedID string
-	err := s.db.QueryRow(context.Background(), query, tripID).Scan(&returnedID)
+	ctx := c.Request.Context()
+	var returnedID, driverID string
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, query, tripID).Scan(&returnedID, &driverID); err != nil {
+			return err
+		}
+		// Distancia recorrida según las ubicaciones guardadas; los puntos que
+		// el driver suba después en lote la recalculan
+		_, err := tx.Exec(ctx, `UPDATE trips t SET distance_m = `+tripDistanceSQL+` WHERE t.id = $1`, returnedID)
+		if err != nil {
+			return err
+		}
+		return releaseDriver(ctx, tx, driverID)
+	})
 
 	if err != nil {
-		s.log.WithError(err).Error("Failed to end trip")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Trip not found"})
+		c.JSON(http.StatusConflict, gin.H{"error": "Trip is not started"})
 		return
 	}
 
+	s.notifyTripStatus(returnedID, "completed")
+
 	c.JSON(http.StatusOK, gin.H{
 		"trip_id": returnedID,
 		"status":  "completed",
 	})
 }
-
-// HandleWebsocket maneja conexiones WebSocket para location updates
-func (s *Server) HandleWebsocket(c *gin.Context) {
-	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		s.log.WithError(err).Warn("WS upgrade failed")
-		return
-	}
-	defer conn.Close()
-
-	s.log.Info("New WebSocket connection established")
-
-	for {
-		_, data, err := conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				s.log.WithError(err).Warn("WS unexpected close")
-			}
-			return
-		}
-
-		var loc LocationPayload
-		if err := json.Unmarshal(data, &loc); err != nil {
-			s.log.WithError(err).Warn("Invalid WS payload")
-			continue
-		}
-
-		// Publicar a Redis pub/sub (para otros servicios)
-		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
-		err = s.redis.Publish(ctx, "locations", string(data)).Err()
-		cancel()
-
-		if err != nil {
-			s.log.WithError(err).Warn("Failed to publish to Redis")
-		}
-
-		// Persistir snapshot asíncrono a PostgreSQL
-		go s.persistLocation(loc)
-
-		s.log.WithFields(logrus.Fields{
-			"driver": loc.DriverID,
-			"lat":    loc.Lat,
-			"lng":    loc.Lng,
-		}).Info("Location received")
-
-		// Enviar ACK al cliente
-		ack := map[string]interface{}{
-			"status": "ok",
-			"ts":     time.Now().Unix(),
-		}
-		if err := conn.WriteJSON(ack); err != nil {
-			s.log.WithError(err).Warn("Failed to send ACK")
-			return
-		}
-	}
-}
-
-func (s *Server) persistLocation(loc LocationPayload) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-
-	query := `
-		INSERT INTO locations (driver_id, geom, speed, heading, ts)
-		VALUES (
-			$1,
-			ST_SetSRID(ST_MakePoint($2, $3)::geometry, 4326)::geography,
-			$4,
-			$5,
-			to_timestamp($6 / 1000.0)
-		)
-	`
-
-	_, err := s.db.Exec(ctx, query,
-		loc.DriverID, loc.Lng, loc.Lat, loc.Speed, loc.Heading, loc.TS)
-
-	if err != nil {
-		s.log.WithError(err).Error("Failed to persist location")
-	}
-}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/ingest"
+	"github.com/criston04/TaxyTac/backend/internal/middleware"
+	"github.com/criston04/TaxyTac/backend/internal/realtime"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// maxBatchPoints limita un lote: ~80 minutos reportando cada 5 s
+const maxBatchPoints = 1000
+
+// locationPruneInterval es cada cuánto el filtro y el pipeline olvidan a los
+// drivers que dejaron de reportar
+const locationPruneInterval = time.Minute
+
+// errBatchDriverMismatch: algún punto del lote dice ser de otro driver
+var errBatchDriverMismatch = errors.New("driver_id does not match token")
+
+// tripDistanceSQL mide el recorrido del driver entre el inicio y el fin (o
+// ahora) del viaje t, uniendo sus ubicaciones en orden de ts
+const tripDistanceSQL = `
+	COALESCE((
+		SELECT ST_Length(ST_MakeLine(l.geom::geometry ORDER BY l.ts)::geography)
+		FROM locations l
+		WHERE l.driver_id = t.driver_id
+			AND l.ts BETWEEN t.started_at AND COALESCE(t.ended_at, now())
+	), 0)
+`
+
+// rejectedPoint es un punto del lote descartado por el filtro
+type rejectedPoint struct {
+	Index  int    `json:"index"`
+	Seq    int64  `json:"seq,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// batchAck resume qué se hizo con un lote de ubicaciones
+type batchAck struct {
+	Status   string `json:"status"`
+	Received int    `json:"received"`
+	// Stored son los puntos nuevos guardados; Duplicates los que ya estaban
+	Stored     int64           `json:"stored"`
+	Duplicates int64           `json:"duplicates"`
+	Rejected   []rejectedPoint `json:"rejected"`
+	LastSeq    int64           `json:"last_seq,omitempty"`
+	// TripsUpdated son los viajes cuya distancia se recalculó con el lote
+	TripsUpdated int64 `json:"trips_updated"`
+	TS           int64 `json:"ts"`
+}
+
+// UploadMyLocations guarda de una vez las ubicaciones que el driver acumuló
+// sin cobertura (POST /api/drivers/me/locations:batch)
+func (s *Server) UploadMyLocations(c *gin.Context) {
+	driverID, ok := currentDriverID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		// max igual a maxBatchPoints
+		Points []LocationPayload `json:"points" binding:"required,min=1,max=1000"`
+	}
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+
+	log := s.log.WithField("driver", driverID)
+	ack, err := s.processLocationBatch(c.Request.Context(), log, driverID, body.Points)
+	if errors.Is(err, errBatchDriverMismatch) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "driver_id does not match token"})
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to store location batch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store locations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ack)
+}
+
+// processLocationBatch filtra el lote, guarda los puntos aceptados y
+// recalcula la distancia de los viajes afectados en una sola transacción.
+// A la vista en vivo sólo va el punto más nuevo, y sólo si sigue vigente,
+// para no inundar el canal locations con historia.
+func (s *Server) processLocationBatch(ctx context.Context, log *logrus.Entry, driverID string, payloads []LocationPayload) (batchAck, error) {
+	now := time.Now()
+	ack := batchAck{Status: ackOK, Received: len(payloads), Rejected: []rejectedPoint{}, TS: now.Unix()}
+
+	// Ordenar por ts recordando la posición original para reportar rechazos
+	order := make([]int, len(payloads))
+	for i, loc := range payloads {
+		if loc.DriverID != "" && loc.DriverID != driverID {
+			return ack, errBatchDriverMismatch
+		}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return payloads[order[a]].TS < payloads[order[b]].TS
+	})
+
+	points := make([]ingest.Point, len(order))
+	for i, idx := range order {
+		loc := payloads[idx]
+		points[i] = ingest.Point{
+			DriverID: driverID,
+			Lat:      loc.Lat,
+			Lng:      loc.Lng,
+			Speed:    loc.Speed,
+			Heading:  loc.Heading,
+			TS:       loc.TS,
+			Seq:      loc.Seq,
+		}
+	}
+
+	reasons := s.filter.CheckTrack(points, now)
+	accepted := make([]ingest.Point, 0, len(points))
+	for i, reason := range reasons {
+		if reason != "" {
+			ack.Rejected = append(ack.Rejected, rejectedPoint{Index: order[i], Seq: points[i].Seq, Reason: reason})
+			continue
+		}
+		accepted = append(accepted, points[i])
+	}
+	sort.Slice(ack.Rejected, func(a, b int) bool { return ack.Rejected[a].Index < ack.Rejected[b].Index })
+
+	if len(accepted) == 0 {
+		ack.Status = ackRejected
+		return ack, nil
+	}
+	first, newest := accepted[0], accepted[len(accepted)-1]
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		stored, err := ingest.InsertPoints(ctx, tx, accepted)
+		if err != nil {
+			return err
+		}
+		ack.Stored = stored
+		ack.Duplicates = int64(len(accepted)) - stored
+
+		ack.TripsUpdated, err = updateTripDistances(ctx, tx, driverID, first.TS, newest.TS)
+		return err
+	})
+	if err != nil {
+		return ack, err
+	}
+
+	// El punto más nuevo del lote puede ser también el más nuevo del driver
+	liveCtx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	result := ingest.SeqLatest
+	ack.LastSeq = newest.Seq
+	if newest.Seq > 0 {
+		result, ack.LastSeq, err = s.seqs.Track(liveCtx, newest)
+		if err != nil {
+			log.WithError(err).Warn("Failed to track location sequence")
+			result, ack.LastSeq = ingest.SeqLatest, newest.Seq
+		}
+	}
+	if result == ingest.SeqLatest && s.filter.Fresh(newest, now) {
+		s.publishLocation(liveCtx, log, LocationPayload{
+			DriverID: newest.DriverID,
+			Lat:      newest.Lat,
+			Lng:      newest.Lng,
+			TS:       newest.TS,
+			Speed:    newest.Speed,
+			Heading:  newest.Heading,
+			Seq:      newest.Seq,
+		})
+	}
+
+	log.WithFields(logrus.Fields{
+		"received":   ack.Received,
+		"stored":     ack.Stored,
+		"duplicates": ack.Duplicates,
+		"rejected":   len(ack.Rejected),
+		"trips":      ack.TripsUpdated,
+	}).Info("Location batch received")
+
+	return ack, nil
+}
+
+// handleDriverBatch atiende un mensaje {"type": "batch", "points": [...]} de /ws
+func (s *Server) handleDriverBatch(client *realtime.Client, log *logrus.Entry, driverID string, points []LocationPayload) {
+	if ack, ok := s.processDriverBatch(client, log, driverID, points); ok {
+		client.SendJSON(ack)
+	}
+}
+
+// processDriverBatch procesa un lote llegado por /ws; si falla responde el
+// error en JSON y devuelve false
+func (s *Server) processDriverBatch(client *realtime.Client, log *logrus.Entry, driverID string, points []LocationPayload) (batchAck, bool) {
+	if len(points) == 0 || len(points) > maxBatchPoints {
+		client.SendJSON(map[string]interface{}{
+			"status": "error",
+			"error":  "batch must have between 1 and " + strconv.Itoa(maxBatchPoints) + " points",
+		})
+		return batchAck{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ack, err := s.processLocationBatch(ctx, log, driverID, points)
+	if err != nil {
+		if !errors.Is(err, errBatchDriverMismatch) {
+			log.WithError(err).Error("Failed to store location batch")
+			err = errors.New("failed to store locations")
+		}
+		client.SendJSON(map[string]interface{}{
+			"status": "error",
+			"error":  err.Error(),
+		})
+		return batchAck{}, false
+	}
+	return ack, true
+}
+
+// updateTripDistances recalcula distance_m de los viajes del driver que se
+// cruzan con el intervalo [from, to] (epoch ms) cubierto por el lote
+func updateTripDistances(ctx context.Context, tx pgx.Tx, driverID string, from, to int64) (int64, error) {
+	tag, err := tx.Exec(ctx, `
+		UPDATE trips t
+		SET distance_m = `+tripDistanceSQL+`
+		WHERE t.driver_id = $1
+			AND t.status IN ('started', 'completed')
+			AND t.started_at <= to_timestamp($3::bigint / 1000.0)
+			AND COALESCE(t.ended_at, now()) >= to_timestamp($2::bigint / 1000.0)
+	`, driverID, from, to)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// pruneLocationState olvida periódicamente lo que el filtro y el pipeline
+// guardan de los drivers que dejaron de reportar sin pasar a offline
+func (s *Server) pruneLocationState(ctx context.Context) {
+	ticker := time.NewTicker(locationPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			if n := s.filter.Prune(now); n > 0 {
+				s.log.WithField("drivers", n).Debug("Pruned stale location filter references")
+			}
+			if n := s.ingest.Prune(now); n > 0 {
+				s.log.WithField("drivers", n).Debug("Pruned stale location pipeline entries")
+			}
+		}
+	}
+}
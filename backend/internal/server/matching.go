@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/matching"
+	"github.com/criston04/TaxyTac/backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// matchingWeightsKey guarda en Redis los pesos que fijó un admin, para que
+	// todas las instancias usen los mismos
+	matchingWeightsKey = "matching:weights"
+	// weightsRefresh es cada cuánto cada instancia relee los pesos
+	weightsRefresh = 30 * time.Second
+	// acceptanceRefresh es cada cuánto se recalculan las tasas de aceptación
+	// que usa el scorer; agregar 30 días de ofertas por búsqueda sería caro
+	acceptanceRefresh = 5 * time.Minute
+)
+
+// acceptanceRates es la última foto de las tasas de aceptación por driver
+type acceptanceRates struct {
+	mu    sync.RWMutex
+	rates map[string]float64
+}
+
+func (a *acceptanceRates) get(driverID string) (float64, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	rate, ok := a.rates[driverID]
+	return rate, ok
+}
+
+func (a *acceptanceRates) set(rates map[string]float64) {
+	a.mu.Lock()
+	a.rates = rates
+	a.mu.Unlock()
+}
+
+// rankDrivers calcula ETA y puntaje de cada driver y los ordena de mejor a peor
+func (s *Server) rankDrivers(req matching.Request, drivers []NearbyDriver) {
+	if len(drivers) == 0 {
+		return
+	}
+
+	for i := range drivers {
+		d := &drivers[i]
+		d.ETAS = etaSeconds(d.DistanceM, d.Speed)
+		// Sin historia de ofertas no se castiga al driver
+		d.AcceptanceRate = 1
+		if rate, ok := s.acceptance.get(d.ID); ok {
+			d.AcceptanceRate = rate
+		}
+
+		d.Score = s.scorer.Score(req, matching.Candidate{
+			DriverID:       d.ID,
+			Lat:            d.Lat,
+			Lng:            d.Lng,
+			DistanceM:      d.DistanceM,
+			ETAS:           float64(d.ETAS),
+			Speed:          d.Speed,
+			Heading:        d.Heading,
+			Rating:         d.Rating,
+			AcceptanceRate: d.AcceptanceRate,
+			IdleS:          d.IdleS,
+		})
+	}
+
+	sort.SliceStable(drivers, func(a, b int) bool {
+		return drivers[a].Score > drivers[b].Score
+	})
+}
+
+// tunableScorer devuelve el scorer si sus pesos se pueden cambiar
+func (s *Server) tunableScorer() (matching.Tunable, bool) {
+	t, ok := s.scorer.(matching.Tunable)
+	return t, ok
+}
+
+// syncAcceptanceRates recalcula periódicamente las tasas de aceptación de
+// ratesWindow para que rankDrivers no consulte trip_offers en cada búsqueda
+func (s *Server) syncAcceptanceRates(ctx context.Context) {
+	ticker := time.NewTicker(acceptanceRefresh)
+	defer ticker.Stop()
+
+	for {
+		s.loadAcceptanceRates(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) loadAcceptanceRates(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	rates, err := s.driverRates(ctx, nil, ratesWindow)
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to load driver acceptance rates")
+		return
+	}
+
+	acceptance := make(map[string]float64, len(rates))
+	for id, r := range rates {
+		if r.AcceptanceRate != nil {
+			acceptance[id] = *r.AcceptanceRate
+		}
+	}
+	s.acceptance.set(acceptance)
+}
+
+// GetMatchingWeights devuelve los pesos del scorer (admin)
+func (s *Server) GetMatchingWeights(c *gin.Context) {
+	scorer, ok := s.tunableScorer()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scorer has no weights"})
+		return
+	}
+	c.JSON(http.StatusOK, scorer.Weights())
+}
+
+// UpdateMatchingWeights cambia los pesos del scorer en todas las instancias
+// (admin). Se aplican de inmediato aquí y en las demás al releerlos.
+func (s *Server) UpdateMatchingWeights(c *gin.Context) {
+	scorer, ok := s.tunableScorer()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scorer has no weights"})
+		return
+	}
+
+	var w matching.Weights
+	if !middleware.BindJSON(c, &w) {
+		return
+	}
+	if err := w.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Weights must be non-negative and at least one must be positive"})
+		return
+	}
+
+	raw, err := json.Marshal(w)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save weights"})
+		return
+	}
+	if err := s.redis.Set(c.Request.Context(), matchingWeightsKey, raw, 0).Err(); err != nil {
+		s.log.WithError(err).Error("Failed to save matching weights")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save weights"})
+		return
+	}
+	scorer.SetWeights(w)
+
+	s.log.WithField("weights", w).Info("Matching weights updated")
+	c.JSON(http.StatusOK, w)
+}
+
+// syncMatchingWeights relee periódicamente los pesos guardados en Redis
+func (s *Server) syncMatchingWeights(ctx context.Context) {
+	if _, ok := s.tunableScorer(); !ok {
+		return
+	}
+	ticker := time.NewTicker(weightsRefresh)
+	defer ticker.Stop()
+
+	for {
+		s.loadMatchingWeights(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) loadMatchingWeights(ctx context.Context) {
+	raw, err := s.redis.Get(ctx, matchingWeightsKey).Bytes()
+	if err == redis.Nil {
+		return
+	}
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to load matching weights")
+		return
+	}
+
+	var w matching.Weights
+	if err := json.Unmarshal(raw, &w); err != nil {
+		s.log.WithError(err).Warn("Invalid matching weights in Redis")
+		return
+	}
+	scorer, _ := s.tunableScorer()
+	if err := scorer.SetWeights(w); err != nil {
+		s.log.WithError(err).Warn("Invalid matching weights in Redis")
+	}
+}
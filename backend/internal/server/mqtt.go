@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/auth"
+	"github.com/criston04/TaxyTac/backend/internal/realtime"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// mqttLocationTopic usa una suscripción compartida para que, con varias
+	// instancias del backend, cada mensaje lo procese sólo una
+	mqttLocationTopic  = "$share/taxytac-backend/drivers/+/location"
+	mqttDriverLocation = "drivers/%s/location"
+	mqttEventsTopic    = "drivers/%s/events"
+	mqttQoS            = 1
+
+	// mqttBackendUser es el usuario MQTT del backend; el ACL del broker
+	// (emqx/acl.conf) le permite todos los topics
+	mqttBackendUser = "taxytac-backend"
+	// mqttBackendTokenTTL: el backend firma un token nuevo en cada conexión
+	mqttBackendTokenTTL = time.Hour
+	// mqttDriverTokenTTL es lo que dura la contraseña MQTT de un driver; la
+	// app pide otra antes de reconectar
+	mqttDriverTokenTTL = 12 * time.Hour
+)
+
+// mqttBridge recibe ubicaciones de los drivers que usan MQTT en lugar de
+// WebSocket y les publica los eventos de sus viajes. EMQX autentica a cada
+// cliente con un token firmado por el backend (usuario = driver_id) y su ACL
+// sólo le permite drivers/<su id>/#, así que el driver del topic es confiable.
+type mqttBridge struct {
+	s      *Server
+	client mqtt.Client
+	log    *logrus.Entry
+	tokens *auth.MQTTTokens
+
+	// known guarda los driver_id ya verificados contra la DB
+	known sync.Map
+}
+
+// newMQTTBridge conecta al broker en segundo plano; si no responde se sigue
+// reintentando sin impedir que arranque el servidor
+func newMQTTBridge(s *Server, cfg Config, tokens *auth.MQTTTokens) *mqttBridge {
+	b := &mqttBridge{s: s, log: s.log.WithField("component", "mqtt"), tokens: tokens}
+
+	broker := cfg.MQTTBroker
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	clientID := cfg.MQTTClientID
+	if clientID == "" {
+		host, _ := os.Hostname()
+		clientID = fmt.Sprintf("taxytac-backend-%s-%d", host, os.Getpid())
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetCredentialsProvider(b.credentials).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(30 * time.Second).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			b.log.WithError(err).Warn("MQTT connection lost")
+		})
+	b.client = mqtt.NewClient(opts)
+
+	token := b.client.Connect()
+	if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		b.log.WithError(token.Error()).Warn("MQTT broker not reachable yet, retrying in background")
+	}
+	return b
+}
+
+// credentials firma la contraseña del backend en cada (re)conexión
+func (b *mqttBridge) credentials() (string, string) {
+	token, _, err := b.tokens.Issue(mqttBackendUser, mqttBackendTokenTTL)
+	if err != nil {
+		b.log.WithError(err).Error("Failed to issue MQTT token")
+	}
+	return mqttBackendUser, token
+}
+
+// onConnect (re)suscribe al conectar; la sesión es limpia en cada conexión
+func (b *mqttBridge) onConnect(c mqtt.Client) {
+	token := c.Subscribe(mqttLocationTopic, mqttQoS, b.handleLocation)
+	if token.Wait() && token.Error() != nil {
+		b.log.WithError(token.Error()).Error("Failed to subscribe to MQTT locations")
+		return
+	}
+	b.log.Info("Connected to MQTT broker")
+}
+
+// handleLocation procesa un mensaje de drivers/{id}/location igual que /ws:
+// una ubicación suelta o {"type": "batch", "points": [...]}
+func (b *mqttBridge) handleLocation(_ mqtt.Client, m mqtt.Message) {
+	parts := strings.Split(m.Topic(), "/")
+	if len(parts) != 3 {
+		return
+	}
+	driverID := parts[1]
+	log := b.log.WithField("driver", driverID)
+
+	if !b.isDriver(driverID) {
+		log.Warn("MQTT location for unknown driver dropped")
+		return
+	}
+
+	var msg wsMessage
+	if err := json.Unmarshal(m.Payload(), &msg); err != nil {
+		log.WithError(err).Warn("Invalid MQTT payload")
+		return
+	}
+	if msg.Type == "heartbeat" {
+		return
+	}
+
+	if msg.Type == "batch" {
+		if len(msg.Points) == 0 || len(msg.Points) > maxBatchPoints {
+			log.WithField("points", len(msg.Points)).Warn("MQTT batch size out of range")
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := b.s.processLocationBatch(ctx, log, driverID, msg.Points); err != nil {
+			log.WithError(err).Warn("Failed to store MQTT location batch")
+		}
+		return
+	}
+
+	loc := msg.LocationPayload
+	if loc.DriverID != "" && loc.DriverID != driverID {
+		log.WithField("claimed", loc.DriverID).Warn("MQTT payload for another driver rejected")
+		return
+	}
+	loc.DriverID = driverID
+	b.s.processLocation(log, loc)
+}
+
+// isDriver verifica que el id del topic sea un driver registrado
+func (b *mqttBridge) isDriver(driverID string) bool {
+	if _, ok := b.known.Load(driverID); ok {
+		return true
+	}
+	if _, err := uuid.Parse(driverID); err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var exists bool
+	err := b.s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM drivers WHERE id = $1)`, driverID).Scan(&exists)
+	if err != nil {
+		b.log.WithError(err).Warn("Failed to verify MQTT driver")
+		return false
+	}
+	if exists {
+		b.known.Store(driverID, struct{}{})
+	}
+	return exists
+}
+
+// PublishEvent envía un mensaje {"type", "data"} a drivers/{id}/events sin
+// esperar la confirmación del broker
+func (b *mqttBridge) PublishEvent(driverID, msgType string, data any) {
+	msg, err := realtime.Encode(msgType, data)
+	if err != nil {
+		return
+	}
+	b.client.Publish(fmt.Sprintf(mqttEventsTopic, driverID), mqttQoS, false, msg)
+}
+
+// IssueMyMQTTToken entrega al driver autenticado sus credenciales del broker:
+// usuario = driver_id y contraseña = token firmado que vence en
+// mqttDriverTokenTTL
+func (s *Server) IssueMyMQTTToken(c *gin.Context) {
+	if s.mqtt == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MQTT is not enabled"})
+		return
+	}
+
+	driverID, ok := currentDriverID(c)
+	if !ok {
+		return
+	}
+	token, expiresAt, err := s.mqtt.tokens.Issue(driverID, mqttDriverTokenTTL)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to issue MQTT token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"username":       driverID,
+		"password":       token,
+		"expires_in":     int(time.Until(expiresAt).Seconds()),
+		"location_topic": fmt.Sprintf(mqttDriverLocation, driverID),
+		"events_topic":   fmt.Sprintf(mqttEventsTopic, driverID),
+	})
+}
+
+// Close se desconecta dando un momento para terminar lo que está en curso
+func (b *mqttBridge) Close() {
+	b.client.Disconnect(250)
+}
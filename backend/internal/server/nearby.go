@@ -0,0 +1,318 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/geo"
+	"github.com/criston04/TaxyTac/backend/internal/matching"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// driverFreshness es cuánto vale la última posición de un driver para
+	// aparecer en las búsquedas
+	driverFreshness = 15 * time.Second
+	// candidatesPerResult: se piden más drivers de los que se devuelven porque
+	// algunos estarán ocupados u offline, y el scorer elige los mejores
+	candidatesPerResult = 3
+)
+
+// NearbySearch es la política de GET /api/drivers/nearby. Si en el radio
+// pedido hay menos de MinDrivers, se duplica el radio hasta MaxRadiusM. Radio
+// y límite se recortan a los máximos para que un cliente no pueda pedir un
+// barrido de toda la ciudad.
+type NearbySearch struct {
+	DefaultRadiusM float64
+	MaxRadiusM     float64
+	MinDrivers     int
+	DefaultLimit   int
+	MaxLimit       int
+}
+
+// DefaultNearbySearch: 1 km ampliable hasta 5 km buscando al menos 3 drivers
+func DefaultNearbySearch() NearbySearch {
+	return NearbySearch{
+		DefaultRadiusM: 1000,
+		MaxRadiusM:     5000,
+		MinDrivers:     3,
+		DefaultLimit:   20,
+		MaxLimit:       50,
+	}
+}
+
+// withDefaults completa los campos sin configurar
+func (p NearbySearch) withDefaults() NearbySearch {
+	def := DefaultNearbySearch()
+	if p.DefaultRadiusM <= 0 {
+		p.DefaultRadiusM = def.DefaultRadiusM
+	}
+	if p.MaxRadiusM <= 0 {
+		p.MaxRadiusM = def.MaxRadiusM
+	}
+	if p.MinDrivers <= 0 {
+		p.MinDrivers = def.MinDrivers
+	}
+	if p.DefaultLimit <= 0 {
+		p.DefaultLimit = def.DefaultLimit
+	}
+	if p.MaxLimit <= 0 {
+		p.MaxLimit = def.MaxLimit
+	}
+	p.DefaultRadiusM = min(p.DefaultRadiusM, p.MaxRadiusM)
+	p.DefaultLimit = min(p.DefaultLimit, p.MaxLimit)
+	return p
+}
+
+// driverIdleSQL son los segundos desde que el driver d quedó libre: el fin de
+// su último viaje o el inicio de su turno, lo que sea más reciente
+const driverIdleSQL = `
+	COALESCE(EXTRACT(EPOCH FROM now() - GREATEST(
+		(SELECT max(t.ended_at) FROM trips t WHERE t.driver_id = d.id),
+		(SELECT sh.started_at FROM driver_shifts sh WHERE sh.driver_id = d.id AND sh.ended_at IS NULL)
+	)), 0)::float8
+`
+
+// NearbyDriver es un driver disponible cerca del pasajero
+type NearbyDriver struct {
+	ID        string          `json:"driver_id"`
+	UserID    string          `json:"user_id"`
+	DistanceM float64         `json:"distance_m"`
+	ETAS      int             `json:"eta_s"`
+	Lat       float64         `json:"lat"`
+	Lng       float64         `json:"lng"`
+	Rating    float64         `json:"rating"`
+	Score     float64         `json:"score"`
+	Vehicle   json.RawMessage `json:"vehicle"`
+
+	// Datos que sólo usa el scorer
+	Speed          float64 `json:"-"`
+	Heading        float64 `json:"-"`
+	IdleS          float64 `json:"-"`
+	AcceptanceRate float64 `json:"-"`
+}
+
+// GetDriversNearby busca drivers disponibles cercanos, ampliando el radio si
+// hay pocos. Lee las posiciones del índice GEO de Redis y, si Redis falla,
+// vuelve a la consulta PostGIS.
+func (s *Server) GetDriversNearby(c *gin.Context) {
+	policy := s.cfg.NearbySearch
+
+	lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+	lng, errLng := strconv.ParseFloat(c.Query("lng"), 64)
+	if errLat != nil || errLng != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lng are required"})
+		return
+	}
+	radius := policy.DefaultRadiusM // metros
+	if raw := c.Query("radius"); raw != "" {
+		var err error
+		if radius, err = strconv.ParseFloat(raw, 64); err != nil || radius <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "radius must be a positive number of meters"})
+			return
+		}
+	}
+	limit := policy.DefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+	}
+	radius = min(radius, policy.MaxRadiusM)
+	limit = min(limit, policy.MaxLimit)
+
+	ctx := c.Request.Context()
+	drivers, source, err := s.nearbyDrivers(ctx, lat, lng, radius, limit)
+	// Pocos drivers: ampliar el radio por pasos hasta el máximo
+	for err == nil && len(drivers) < policy.MinDrivers && radius < policy.MaxRadiusM {
+		radius = min(radius*2, policy.MaxRadiusM)
+		drivers, source, err = s.nearbyDrivers(ctx, lat, lng, radius, limit)
+	}
+	if err != nil {
+		s.log.WithError(err).Error("Failed to query nearby drivers")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query drivers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"drivers":  drivers,
+		"count":    len(drivers),
+		"source":   source,
+		"radius_m": radius,
+		"limit":    limit,
+	})
+}
+
+// nearbyDrivers devuelve hasta limit drivers disponibles del radio ordenados
+// por el scorer (el mejor primero) y de dónde salieron las posiciones ("redis"
+// o "postgis"). También la usa el dispatcher.
+func (s *Server) nearbyDrivers(ctx context.Context, lat, lng, radius float64, limit int) ([]NearbyDriver, string, error) {
+	source := "redis"
+	drivers, err := s.nearbyFromIndex(ctx, lat, lng, radius, limit*candidatesPerResult)
+	if err != nil {
+		s.log.WithError(err).Warn("Geo index unavailable, falling back to PostGIS")
+		source = "postgis"
+		drivers, err = s.nearbyFromPostGIS(ctx, lat, lng, radius, limit*candidatesPerResult)
+	}
+	if err != nil {
+		return nil, source, err
+	}
+
+	s.rankDrivers(matching.Request{OriginLat: lat, OriginLng: lng}, drivers)
+	if len(drivers) > limit {
+		drivers = drivers[:limit]
+	}
+	return drivers, source, nil
+}
+
+// nearbyFromIndex toma los candidatos del índice GEO y deja sólo los
+// disponibles, consultando drivers por clave primaria. En zonas con muchos
+// drivers ocupados los primeros count del índice pueden no alcanzar: se pide
+// el doble (consultando sólo los nuevos) hasta juntar count o agotar el radio.
+func (s *Server) nearbyFromIndex(ctx context.Context, lat, lng, radius float64, count int) ([]NearbyDriver, error) {
+	drivers := []NearbyDriver{}
+	seen := make(map[string]bool)
+	for fetch := count; ; fetch *= 2 {
+		candidates, more, err := s.geo.Nearby(ctx, lat, lng, radius, fetch)
+		if err != nil {
+			return nil, err
+		}
+
+		// El índice devuelve de nuevo los más cercanos: ya se consultaron
+		fresh := make([]geo.Nearby, 0, len(candidates))
+		for _, cand := range candidates {
+			if !seen[cand.DriverID] {
+				seen[cand.DriverID] = true
+				fresh = append(fresh, cand)
+			}
+		}
+		available, err := s.availableCandidates(ctx, fresh)
+		if err != nil {
+			return nil, err
+		}
+		drivers = append(drivers, available...)
+
+		if len(drivers) >= count || !more {
+			break
+		}
+	}
+	if len(drivers) > count {
+		drivers = drivers[:count]
+	}
+	return drivers, nil
+}
+
+// availableCandidates deja los candidatos del índice cuyo driver está
+// disponible, en el mismo orden por distancia
+func (s *Server) availableCandidates(ctx context.Context, candidates []geo.Nearby) ([]NearbyDriver, error) {
+	drivers := []NearbyDriver{}
+	if len(candidates) == 0 {
+		return drivers, nil
+	}
+
+	ids := make([]string, len(candidates))
+	for i, cand := range candidates {
+		ids[i] = cand.DriverID
+	}
+
+	query := `
+		SELECT
+			d.id,
+			d.user_id,
+			COALESCE(d.rating, 0)::float8,
+			` + driverIdleSQL + ` AS idle_s,
+			` + activeVehicleJSON + ` AS vehicle
+		FROM drivers d
+		LEFT JOIN vehicles v ON v.driver_id = d.id AND v.is_active
+		WHERE d.id = ANY($1::uuid[]) AND d.status = 'available'
+	`
+	rows, err := s.db.Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	available := make(map[string]NearbyDriver, len(ids))
+	for rows.Next() {
+		var d NearbyDriver
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Rating, &d.IdleS, &d.Vehicle); err != nil {
+			return nil, err
+		}
+		available[d.ID] = d
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Conservar el orden por distancia del índice
+	for _, cand := range candidates {
+		d, ok := available[cand.DriverID]
+		if !ok {
+			continue
+		}
+		d.DistanceM = cand.DistanceM
+		d.Lat = cand.Lat
+		d.Lng = cand.Lng
+		d.Speed = cand.Speed
+		d.Heading = cand.Heading
+		drivers = append(drivers, d)
+	}
+	return drivers, nil
+}
+
+// nearbyFromPostGIS es la búsqueda original sobre la tabla locations. Toma sólo
+// la última ubicación reciente de cada driver (idx_locations_driver_ts): con
+// varios pings en la ventana aparecería repetido y ocuparía lugares del límite.
+func (s *Server) nearbyFromPostGIS(ctx context.Context, lat, lng, radius float64, count int) ([]NearbyDriver, error) {
+	query := `
+		SELECT
+			d.id,
+			d.user_id,
+			ST_Distance(l.geom, p.geom) AS distance_m,
+			ST_Y(l.geom::geometry) AS lat,
+			ST_X(l.geom::geometry) AS lng,
+			COALESCE(l.speed, 0)::float8,
+			COALESCE(l.heading, 0)::float8,
+			COALESCE(d.rating, 0)::float8,
+			` + driverIdleSQL + ` AS idle_s,
+			` + activeVehicleJSON + ` AS vehicle
+		FROM drivers d
+		JOIN LATERAL (
+			SELECT geom, speed, heading
+			FROM locations
+			WHERE driver_id = d.id AND ts > now() - make_interval(secs => $4)
+			ORDER BY ts DESC
+			LIMIT 1
+		) l ON true
+		LEFT JOIN vehicles v ON v.driver_id = d.id AND v.is_active
+		CROSS JOIN (SELECT ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography AS geom) p
+		WHERE
+			d.status = 'available'
+			AND ST_DWithin(l.geom, p.geom, $3)
+		ORDER BY distance_m ASC
+		LIMIT $5
+	`
+
+	rows, err := s.db.Query(ctx, query, lng, lat, radius, driverFreshness.Seconds(), count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drivers := []NearbyDriver{}
+	for rows.Next() {
+		var d NearbyDriver
+		if err := rows.Scan(&d.ID, &d.UserID, &d.DistanceM, &d.Lat, &d.Lng,
+			&d.Speed, &d.Heading, &d.Rating, &d.IdleS, &d.Vehicle); err != nil {
+			s.log.WithError(err).Warn("Failed to scan driver row")
+			continue
+		}
+		drivers = append(drivers, d)
+	}
+	return drivers, rows.Err()
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/realtime"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ratesWindow es el periodo por defecto de las tasas de aceptación y cancelación
+const ratesWindow = 30 * 24 * time.Hour
+
+// DriverRates resume cómo respondió un driver a las ofertas y cuántos de sus
+// viajes canceló él mismo en el periodo (no los que canceló el pasajero o un
+// admin). Las tasas son nil sin datos.
+type DriverRates struct {
+	DriverID string `json:"driver_id"`
+	// Offers cuenta sólo ofertas respondidas o vencidas (no las retiradas)
+	Offers           int      `json:"offers"`
+	Accepted         int      `json:"accepted"`
+	Declined         int      `json:"declined"`
+	Expired          int      `json:"expired"`
+	AcceptanceRate   *float64 `json:"acceptance_rate"`
+	Trips            int      `json:"trips"`
+	Cancelled        int      `json:"cancelled"`
+	CancellationRate *float64 `json:"cancellation_rate"`
+}
+
+// DeclineTrip rechaza la oferta vigente del driver para el viaje; el
+// dispatcher pasa enseguida al siguiente candidato
+func (s *Server) DeclineTrip(c *gin.Context) {
+	driverID, ok := currentDriverID(c)
+	if !ok {
+		return
+	}
+	tripID := c.Param("id")
+
+	ctx := c.Request.Context()
+	tag, err := s.db.Exec(ctx, `
+		UPDATE trip_offers
+		SET outcome = 'declined', responded_at = now()
+		WHERE trip_id = $1 AND driver_id = $2 AND outcome = 'pending' AND expires_at > now()
+	`, tripID, driverID)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to decline trip")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline trip"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "No active offer for this trip"})
+		return
+	}
+
+	s.releaseOffer(ctx, tripID, driverID)
+	event := gin.H{"trip_id": tripID, "driver_id": driverID}
+	if err := s.hub.PublishTopic(ctx, realtime.OfferTopic(tripID), realtime.TypeTripOfferDeclined, event); err != nil {
+		s.log.WithError(err).Warn("Failed to publish trip offer decline")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trip_id": tripID,
+		"status":  "declined",
+	})
+}
+
+// GetDriverRates lista las tasas de aceptación y cancelación de los drivers
+// (admin). ?days= cambia el periodo (30 por defecto) y ?driver_id= filtra.
+func (s *Server) GetDriverRates(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+		return
+	}
+
+	var ids []string
+	if id := c.Query("driver_id"); id != "" {
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid driver_id"})
+			return
+		}
+		ids = []string{id}
+	}
+
+	rates, err := s.driverRates(c.Request.Context(), ids, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to query driver rates")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query driver rates"})
+		return
+	}
+
+	drivers := make([]DriverRates, 0, len(rates))
+	for _, r := range rates {
+		drivers = append(drivers, r)
+	}
+	sortDriverRates(drivers)
+
+	c.JSON(http.StatusOK, gin.H{
+		"drivers": drivers,
+		"count":   len(drivers),
+		"days":    days,
+	})
+}
+
+// driverRates calcula las tasas de los drivers indicados (nil = todos los que
+// tuvieron ofertas o viajes) sobre la ventana que termina ahora
+func (s *Server) driverRates(ctx context.Context, ids []string, window time.Duration) (map[string]DriverRates, error) {
+	query := `
+		WITH o AS (
+			SELECT
+				driver_id,
+				count(*) FILTER (WHERE outcome IN ('accepted', 'declined', 'expired')) AS offers,
+				count(*) FILTER (WHERE outcome = 'accepted') AS accepted,
+				count(*) FILTER (WHERE outcome = 'declined') AS declined,
+				count(*) FILTER (WHERE outcome = 'expired') AS expired
+			FROM trip_offers
+			WHERE offered_at > now() - make_interval(secs => $1)
+				AND ($2::uuid[] IS NULL OR driver_id = ANY($2))
+			GROUP BY driver_id
+		), t AS (
+			SELECT
+				driver_id,
+				count(*) AS trips,
+				count(*) FILTER (WHERE status = 'cancelled' AND cancelled_by = 'driver') AS cancelled
+			FROM trips
+			WHERE driver_id IS NOT NULL
+				AND created_at > now() - make_interval(secs => $1)
+				AND ($2::uuid[] IS NULL OR driver_id = ANY($2))
+			GROUP BY driver_id
+		)
+		SELECT
+			COALESCE(o.driver_id, t.driver_id),
+			COALESCE(o.offers, 0), COALESCE(o.accepted, 0),
+			COALESCE(o.declined, 0), COALESCE(o.expired, 0),
+			COALESCE(t.trips, 0), COALESCE(t.cancelled, 0)
+		FROM o
+		FULL JOIN t ON t.driver_id = o.driver_id
+	`
+	rows, err := s.db.Query(ctx, query, window.Seconds(), ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := make(map[string]DriverRates)
+	for rows.Next() {
+		var r DriverRates
+		if err := rows.Scan(&r.DriverID, &r.Offers, &r.Accepted, &r.Declined, &r.Expired, &r.Trips, &r.Cancelled); err != nil {
+			return nil, err
+		}
+		r.AcceptanceRate = ratio(r.Accepted, r.Offers)
+		r.CancellationRate = ratio(r.Cancelled, r.Trips)
+		rates[r.DriverID] = r
+	}
+	return rates, rows.Err()
+}
+
+// sortDriverRates deja primero a quienes más ofertas dejan pasar
+func sortDriverRates(drivers []DriverRates) {
+	rate := func(r DriverRates) float64 {
+		if r.AcceptanceRate == nil {
+			return 2
+		}
+		return *r.AcceptanceRate
+	}
+	sort.SliceStable(drivers, func(a, b int) bool {
+		if ra, rb := rate(drivers[a]), rate(drivers[b]); ra != rb {
+			return ra < rb
+		}
+		return drivers[a].Offers > drivers[b].Offers
+	})
+}
+
+func ratio(n, total int) *float64 {
+	if total == 0 {
+		return nil
+	}
+	r := float64(n) / float64(total)
+	return &r
+}
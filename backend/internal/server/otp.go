@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/criston04/TaxyTac/backend/internal/auth"
+	"github.com/criston04/TaxyTac/backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// normalizePhone deja el número en 9 dígitos (formato local de Perú)
+func normalizePhone(phone string) string {
+	phone = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(phone)
+	phone = strings.TrimPrefix(phone, "+")
+	if len(phone) == 11 && strings.HasPrefix(phone, "51") {
+		phone = phone[2:]
+	}
+	return phone
+}
+
+// RequestOTP envía por SMS un código de acceso al teléfono
+func (s *Server) RequestOTP(c *gin.Context) {
+	var body struct {
+		Phone string `json:"phone" binding:"required"`
+	}
+
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+
+	phone := normalizePhone(body.Phone)
+	if verr := middleware.ValidatePhone(phone); verr != nil {
+		middleware.RespondWithValidationErrors(c, []*middleware.ValidationError{verr})
+		return
+	}
+
+	ctx := c.Request.Context()
+	code, err := s.otp.Request(ctx, phone)
+	if errors.Is(err, auth.ErrOTPLocked) {
+		s.respondOTPLocked(c, phone)
+		return
+	}
+	if errors.Is(err, auth.ErrOTPCooldown) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "OTP requested too recently",
+			"retry_after": int(s.otp.CooldownRemaining(ctx, phone).Seconds()),
+		})
+		return
+	}
+	if err != nil {
+		s.log.WithError(err).Error("Failed to create OTP")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send code"})
+		return
+	}
+
+	message := fmt.Sprintf("Tu código TaxyTac es %s. Vence en %d minutos.", code, int(auth.OTPTTL.Minutes()))
+	if err := s.sms.SendSMS(ctx, "+51"+phone, message); err != nil {
+		s.log.WithError(err).Error("Failed to send OTP SMS")
+		// Sin SMS no hay código que esperar: se puede pedir otro de inmediato
+		if err := s.otp.Cancel(ctx, phone); err != nil {
+			s.log.WithError(err).Warn("Failed to clear OTP cooldown")
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send code"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"expires_in": int(auth.OTPTTL.Seconds()),
+		"resend_in":  int(auth.OTPResendCooldown.Seconds()),
+	})
+}
+
+// VerifyOTP valida el código y abre sesión; crea la cuenta de pasajero si el
+// teléfono aún no está registrado
+func (s *Server) VerifyOTP(c *gin.Context) {
+	var body struct {
+		Phone string `json:"phone" binding:"required"`
+		Code  string `json:"code" binding:"required"`
+		Name  string `json:"name"` // usado sólo al crear la cuenta
+	}
+
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+
+	phone := normalizePhone(body.Phone)
+	err := s.otp.Verify(c.Request.Context(), phone, body.Code)
+	switch {
+	case errors.Is(err, auth.ErrOTPLocked):
+		s.respondOTPLocked(c, phone)
+		return
+	case errors.Is(err, auth.ErrOTPTooManyAttempts):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, request a new code"})
+		return
+	case errors.Is(err, auth.ErrOTPNotFound), errors.Is(err, auth.ErrOTPInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+		return
+	case err != nil:
+		s.log.WithError(err).Error("Failed to verify OTP")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	if s.loginPhoneUser(c, phone) {
+		return
+	}
+	s.createPhoneUser(c, phone, body.Name)
+}
+
+// respondOTPLocked responde 429 a un teléfono bloqueado por códigos errados
+func (s *Server) respondOTPLocked(c *gin.Context, phone string) {
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed codes for this phone, try again later",
+		"retry_after": int(s.otp.LockRemaining(c.Request.Context(), phone).Seconds()),
+	})
+}
+
+// loginPhoneUser abre sesión con la cuenta del teléfono ya verificado.
+// Devuelve false sin responder si el teléfono no está registrado.
+func (s *Server) loginPhoneUser(c *gin.Context, phone string) bool {
+	var user sessionUser
+	var emailVerified bool
+	query := `
+		UPDATE users SET phone_verified_at = COALESCE(phone_verified_at, now())
+		WHERE phone = $1
+		RETURNING id, name, COALESCE(email, ''), role, email_verified_at IS NOT NULL
+	`
+	err := s.db.QueryRow(context.Background(), query, phone).Scan(
+		&user.ID, &user.Name, &user.Email, &user.Role, &emailVerified,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		s.log.WithError(err).Error("Failed to load user by phone")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return true
+	}
+	if s.emailUnverified(user.Email, emailVerified) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email not verified"})
+		return true
+	}
+
+	s.respondWithSession(c, http.StatusOK, user)
+	return true
+}
+
+// createPhoneUser crea la cuenta de pasajero del teléfono. Si otra petición
+// la creó entre medio (dos verify simultáneos del primer login, o un registro
+// con el mismo teléfono), se abre sesión con esa cuenta.
+func (s *Server) createPhoneUser(c *gin.Context, phone, name string) {
+	if name == "" {
+		name = "Pasajero"
+	}
+
+	user := sessionUser{ID: uuid.New().String(), Name: name, Role: auth.RolePassenger}
+	query := `
+		INSERT INTO users (id, name, phone, role, phone_verified_at, created_at)
+		VALUES ($1, $2, $3, $4, now(), now())
+	`
+	_, err := s.db.Exec(context.Background(), query, user.ID, user.Name, phone, user.Role)
+	if isUniqueViolation(err) && s.loginPhoneUser(c, phone) {
+		return
+	}
+	if err != nil {
+		s.log.WithError(err).Error("Failed to create user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	s.respondWithSession(c, http.StatusCreated, user)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/criston04/TaxyTac/backend/internal/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// flakySMSSender falla los primeros envíos y guarda los que salen
+type flakySMSSender struct {
+	failures int
+	sent     []string
+}
+
+func (f *flakySMSSender) SendSMS(_ context.Context, to, message string) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("gateway unavailable")
+	}
+	f.sent = append(f.sent, to+": "+message)
+	return nil
+}
+
+func requestOTP(s *Server, phone string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/auth/otp/request", strings.NewReader(`{"phone":"`+phone+`"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	s.RequestOTP(c)
+	return w
+}
+
+// Si el SMS no sale, el usuario puede volver a pedir el código sin esperar
+// el cooldown
+func TestRequestOTPSMSFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	sms := &flakySMSSender{failures: 1}
+	s := &Server{log: log, sms: sms, otp: auth.NewOTPStore(newTestRedis(t), "test-secret")}
+
+	if w := requestOTP(s, "+51987654321"); w.Code != http.StatusBadGateway {
+		t.Fatalf("failed SMS: status %d, want 502", w.Code)
+	}
+	if w := requestOTP(s, "+51987654321"); w.Code != http.StatusAccepted {
+		t.Fatalf("retry after a failed SMS: status %d, want 202: %s", w.Code, w.Body)
+	}
+	if len(sms.sent) != 1 || !strings.HasPrefix(sms.sent[0], "+51987654321: ") {
+		t.Fatalf("sent = %q", sms.sent)
+	}
+	if w := requestOTP(s, "+51987654321"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("request during the cooldown: status %d, want 429", w.Code)
+	}
+}
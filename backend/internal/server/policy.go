@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/criston04/TaxyTac/backend/internal/auth"
+	"github.com/criston04/TaxyTac/backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	ctxDriverID = "policy.driver_id"
+	ctxTrip     = "policy.trip"
+)
+
+// tripParties son los datos de un viaje necesarios para autorizar acciones
+type tripParties struct {
+	ID       string
+	RiderID  string
+	DriverID string
+	Status   string
+}
+
+// tripPolicy decide si el usuario (y su driver, si aplica) puede actuar sobre el viaje
+type tripPolicy func(claims *auth.Claims, driverID string, trip *tripParties) bool
+
+// tripRiderPolicy: sólo el pasajero que pidió el viaje
+func tripRiderPolicy(claims *auth.Claims, _ string, trip *tripParties) bool {
+	return trip.RiderID != "" && trip.RiderID == claims.UserID()
+}
+
+// tripDriverPolicy: sólo el driver asignado al viaje
+func tripDriverPolicy(_ *auth.Claims, driverID string, trip *tripParties) bool {
+	return driverID != "" && trip.DriverID == driverID
+}
+
+// tripPartyPolicy: el pasajero o el driver del viaje
+func tripPartyPolicy(claims *auth.Claims, driverID string, trip *tripParties) bool {
+	return tripRiderPolicy(claims, driverID, trip) || tripDriverPolicy(claims, driverID, trip)
+}
+
+// riderRoles son los roles que pueden pedir viajes
+var riderRoles = []string{auth.RoleRider, auth.RolePassenger}
+
+// requireDriverProfile resuelve el registro de driver del usuario autenticado
+// y lo deja en el contexto. Los admin pasan sin driver asociado.
+func (s *Server) requireDriverProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := middleware.ClaimsFromContext(c)
+		if claims.IsAdmin() {
+			c.Next()
+			return
+		}
+
+		driverID, err := s.driverIDForUser(c.Request.Context(), claims.UserID())
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "User has no driver profile"})
+			return
+		}
+		if err != nil {
+			s.log.WithError(err).Error("Failed to load driver profile")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to load driver profile"})
+			return
+		}
+
+		c.Set(ctxDriverID, driverID)
+		c.Next()
+	}
+}
+
+// loadDriverProfile es como requireDriverProfile pero no exige ser driver:
+// sólo resuelve el driver cuando el rol lo es
+func (s *Server) loadDriverProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := middleware.ClaimsFromContext(c)
+		if claims.Role != auth.RoleDriver {
+			c.Next()
+			return
+		}
+		s.requireDriverProfile()(c)
+	}
+}
+
+// authorizeTrip carga el viaje de :id y aplica la política (admin siempre pasa)
+func (s *Server) authorizeTrip(policy tripPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		trip, err := s.loadTripParties(c.Request.Context(), c.Param("id"))
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Trip not found"})
+			return
+		}
+		if err != nil {
+			s.log.WithError(err).Error("Failed to load trip")
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Trip not found"})
+			return
+		}
+
+		claims, _ := middleware.ClaimsFromContext(c)
+		if !claims.IsAdmin() && !policy(claims, c.GetString(ctxDriverID), trip) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+
+		c.Set(ctxTrip, trip)
+		c.Next()
+	}
+}
+
+func (s *Server) loadTripParties(ctx context.Context, tripID string) (*tripParties, error) {
+	query := `
+		SELECT id, COALESCE(rider_id::text, ''), COALESCE(driver_id::text, ''), status
+		FROM trips
+		WHERE id::text = $1
+	`
+
+	var t tripParties
+	err := s.db.QueryRow(ctx, query, tripID).Scan(&t.ID, &t.RiderID, &t.DriverID, &t.Status)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *Server) driverIDForUser(ctx context.Context, userID string) (string, error) {
+	var driverID string
+	err := s.db.QueryRow(ctx, `SELECT id FROM drivers WHERE user_id = $1 LIMIT 1`, userID).Scan(&driverID)
+	return driverID, err
+}
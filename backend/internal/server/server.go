@@ -2,11 +2,24 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"sync"
+	"time"
 
+	"github.com/criston04/TaxyTac/backend/internal/auth"
+	"github.com/criston04/TaxyTac/backend/internal/dispatch"
+	"github.com/criston04/TaxyTac/backend/internal/geo"
+	"github.com/criston04/TaxyTac/backend/internal/ingest"
+	"github.com/criston04/TaxyTac/backend/internal/matching"
 	"github.com/criston04/TaxyTac/backend/internal/middleware"
+	"github.com/criston04/TaxyTac/backend/internal/notify"
+	"github.com/criston04/TaxyTac/backend/internal/realtime"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/sirupsen/logrus"
 )
@@ -16,15 +29,71 @@ type Config struct {
 	Database  string
 	Redis     string
 	JWTSecret string
+	// JWTPrivateKeyFile, si está definido, activa RS256 en lugar de HS256
+	JWTPrivateKeyFile string
+	AccessTokenTTL    time.Duration
+	RefreshTokenTTL   time.Duration
+	// SMSSender elige cómo se envían los SMS: "log" (por defecto) o "file"
+	SMSSender     string
+	SMSOutboxFile string
+	// EmailSender elige cómo se envían los correos: "log" (por defecto) u "outbox"
+	EmailSender string
+	// AppBaseURL es la URL de la app que abre los links enviados por correo
+	// (/reset-password y /verify-email); es obligatoria
+	AppBaseURL string
+	// RequireVerifiedEmail hace que Register no abra sesión y que Login, OTP y
+	// refresh rechacen cuentas con el correo sin verificar
+	RequireVerifiedEmail bool
+	// AllowedOrigins son los orígenes aceptados en /ws ("*" = todos; vacío = mismo host)
+	AllowedOrigins []string
+	// LocationFilter son los límites para descartar ubicaciones imposibles
+	LocationFilter ingest.FilterConfig
+	// NearbySearch son el radio y el límite de la búsqueda de drivers cercanos
+	NearbySearch NearbySearch
+	// MQTTBroker (host:puerto o URL) activa el puente MQTT; vacío lo desactiva
+	MQTTBroker   string
+	MQTTClientID string
+	// MQTTJWTSecret firma los tokens con los que backend y drivers se
+	// autentican en el broker; es obligatorio con MQTTBroker
+	MQTTJWTSecret string
+	// Dispatch controla cómo se ofrecen los viajes nuevos a los drivers
+	Dispatch dispatch.Config
+	// Scorer ordena a los drivers candidatos; por defecto un WeightedScorer
+	// con DefaultWeights
+	Scorer matching.Scorer
 }
 
 type Server struct {
-	ctx    context.Context
-	cfg    Config
-	log    *logrus.Logger
-	engine *gin.Engine
-	db     *pgxpool.Pool
-	redis  *redis.Client
+	ctx      context.Context
+	cfg      Config
+	log      *logrus.Logger
+	engine   *gin.Engine
+	db       *pgxpool.Pool
+	redis    *redis.Client
+	tokens   *auth.TokenManager
+	refresh  *auth.RefreshStore
+	otp      *auth.OTPStore
+	sms      notify.SMSSender
+	email    notify.EmailSender
+	oneTime  *auth.OneTimeTokens
+	upgrader websocket.Upgrader
+	hub      *realtime.Hub
+	geo      *geo.Index
+	ingest   *ingest.Pipeline
+	filter   *ingest.Filter
+	seqs     *ingest.SeqTracker
+	mqtt     *mqttBridge
+	// scorer ordena a los drivers en la búsqueda y en el dispatcher
+	scorer matching.Scorer
+	// acceptance son las tasas de aceptación que usa el scorer
+	acceptance acceptanceRates
+	// dispatcher ofrece los viajes nuevos a los drivers cercanos
+	dispatcher *dispatch.Dispatcher
+	http       *http.Server
+
+	// tripWatches son los viajes que siguen las conexiones de /ws
+	watchMu     sync.Mutex
+	tripWatches map[tripWatchKey]*tripWatch
 }
 
 func New(ctx context.Context, cfg Config, log *logrus.Logger) (*Server, error) {
@@ -67,22 +136,102 @@ func New(ctx context.Context, cfg Config, log *logrus.Logger) (*Server, error) {
 	}
 	log.Info("Connected to Redis")
 
+	if cfg.AppBaseURL, err = appBaseURL(cfg.AppBaseURL); err != nil {
+		return nil, err
+	}
+	cfg.NearbySearch = cfg.NearbySearch.withDefaults()
+	if cfg.Scorer == nil {
+		cfg.Scorer = matching.NewWeightedScorer(matching.DefaultWeights())
+	}
+
+	tokens, err := newTokenManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sin secreto el broker no podría autenticar a nadie: no se arranca el
+	// puente en lugar de aceptar topics de cualquiera
+	var mqttTokens *auth.MQTTTokens
+	if cfg.MQTTBroker != "" {
+		if mqttTokens, err = auth.NewMQTTTokens(cfg.MQTTJWTSecret); err != nil {
+			return nil, fmt.Errorf("MQTT_BROKER_URL requires MQTT_JWT_SECRET: %w", err)
+		}
+	}
+
 	s := &Server{
-		ctx:    ctx,
-		cfg:    cfg,
-		log:    log,
-		engine: engine,
-		db:     dbpool,
-		redis:  rdb,
+		ctx:      ctx,
+		cfg:      cfg,
+		log:      log,
+		engine:   engine,
+		db:       dbpool,
+		redis:    rdb,
+		tokens:   tokens,
+		refresh:  auth.NewRefreshStore(rdb, refreshTTL(cfg)),
+		otp:      auth.NewOTPStore(rdb, cfg.JWTSecret),
+		sms:      newSMSSender(cfg, log),
+		email:    newEmailSender(cfg, log),
+		oneTime:  auth.NewOneTimeTokens(rdb),
+		upgrader: newUpgrader(cfg),
+		hub:      realtime.NewHub(rdb, log),
+		geo:      geo.NewIndex(rdb, "geo", driverFreshness),
+		ingest:   ingest.New(ingest.DefaultConfig(), ingest.NewPostgresWriter(dbpool), log),
+		filter:   ingest.NewFilter(cfg.LocationFilter),
+		seqs:     ingest.NewSeqTracker(rdb, "locseq", 24*time.Hour),
+		scorer:   cfg.Scorer,
+
+		tripWatches: make(map[tripWatchKey]*tripWatch),
+	}
+
+	// Reparte a los clientes locales lo que llega por Redis
+	go s.hub.Run(ctx)
+
+	// Pesos del scorer fijados por un admin y tasas de aceptación
+	go s.syncMatchingWeights(ctx)
+	go s.syncAcceptanceRates(ctx)
+
+	// Estado del filtro y del pipeline de drivers que ya no reportan
+	go s.pruneLocationState(ctx)
+
+	// Drivers que reportan por MQTT en lugar de WebSocket
+	if mqttTokens != nil {
+		s.mqtt = newMQTTBridge(s, cfg, mqttTokens)
 	}
 
+	s.dispatcher = dispatch.New(ctx, cfg.Dispatch, dispatchBackend{s: s}, log)
+	go s.dispatcher.Run(ctx)
+
 	s.registerRoutes()
 
 	return s, nil
 }
 
 func (s *Server) Run(addr string) error {
-	return http.ListenAndServe(addr, s.engine)
+	s.http = &http.Server{Addr: addr, Handler: s.engine}
+	err := s.http.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown deja de aceptar peticiones (HTTP y MQTT), escribe las ubicaciones pendientes y
+// cierra las conexiones a DB y Redis
+func (s *Server) Shutdown(ctx context.Context) error {
+	var errs []error
+	if s.http != nil {
+		errs = append(errs, s.http.Shutdown(ctx))
+	}
+	if s.mqtt != nil {
+		s.mqtt.Close()
+	}
+	if err := s.ingest.Close(ctx); err != nil {
+		errs = append(errs, err)
+	} else {
+		s.log.WithField("stats", s.ingest.Stats()).Info("Location pipeline flushed")
+	}
+	s.db.Close()
+	errs = append(errs, s.redis.Close())
+	return errors.Join(errs...)
 }
 
 func (s *Server) registerRoutes() {
@@ -93,32 +242,137 @@ func (s *Server) registerRoutes() {
 	api := s.engine.Group("/api")
 	{
 		// Auth
-		auth := api.Group("/auth")
+		authGroup := api.Group("/auth")
 		{
-			auth.POST("/register", s.Register)
-			auth.POST("/login", s.Login)
+			authGroup.POST("/register", s.Register)
+			authGroup.POST("/login", s.Login)
+			authGroup.POST("/refresh", s.RefreshToken)
+			authGroup.POST("/logout", s.Logout)
+			authGroup.POST("/otp/request", s.RequestOTP)
+			authGroup.POST("/otp/verify", s.VerifyOTP)
+			authGroup.POST("/password/forgot", s.ForgotPassword)
+			authGroup.POST("/password/reset", s.ResetPassword)
+			authGroup.POST("/email/verify", s.VerifyEmail)
+			authGroup.POST("/email/verify/request", middleware.Auth(s.tokens), s.RequestEmailVerification)
+			authGroup.GET("/me", middleware.Auth(s.tokens), s.Me)
 		}
 
 		// Drivers
-		drivers := api.Group("/drivers")
+		drivers := api.Group("/drivers", middleware.Auth(s.tokens))
 		{
-			drivers.GET("/nearby", s.GetDriversNearby)
+			drivers.GET("/nearby", middleware.RequireRole(riderRoles...), s.GetDriversNearby)
+
+			// Perfil propio del driver autenticado
+			me := drivers.Group("/me", middleware.RequireRole(auth.RoleDriver), s.requireDriverProfile())
+			me.PATCH("/status", s.UpdateMyStatus)
+			me.GET("/shifts", s.GetMyShifts)
+			// Gin toma ":batch" como parámetro; customMethod exige el literal
+			me.POST("/locations:method", customMethod("batch", s.UploadMyLocations))
+			me.POST("/mqtt/token", s.IssueMyMQTTToken)
+
+			me.GET("/vehicles", s.ListMyVehicles)
+			me.POST("/vehicles", s.CreateMyVehicle)
+			me.PATCH("/vehicles/:vehicleId", s.UpdateMyVehicle)
+			me.DELETE("/vehicles/:vehicleId", s.DeleteMyVehicle)
+			me.POST("/vehicles/:vehicleId/activate", s.ActivateMyVehicle)
+
+			me.GET("/documents", s.ListMyDocuments)
+			me.POST("/documents", s.UploadMyDocument)
 		}
 
 		// Trips
-		trips := api.Group("/trips")
+		trips := api.Group("/trips", middleware.Auth(s.tokens))
 		{
-			trips.POST("", s.CreateTrip)
-			trips.PATCH("/:id/accept", s.AcceptTrip)
-			trips.PATCH("/:id/start", s.StartTrip)
-			trips.PATCH("/:id/end", s.EndTrip)
+			// Pasajero o driver del viaje
+			trips.GET("/:id", s.loadDriverProfile(), s.authorizeTrip(tripPartyPolicy), s.GetTrip)
+			trips.PATCH("/:id/cancel", s.loadDriverProfile(), s.authorizeTrip(tripPartyPolicy), s.CancelTrip)
+			// Seguimiento en vivo del driver para el pasajero (SSE)
+			trips.GET("/:id/stream", s.authorizeTrip(tripRiderPolicy), s.StreamTrip)
+
+			// Pasajeros: crean sus propios viajes
+			riderTrips := trips.Group("", middleware.RequireRole(riderRoles...))
+			riderTrips.POST("", s.CreateTrip)
+
+			// Drivers: aceptan viajes y sólo el asignado puede iniciarlos/terminarlos
+			driverTrips := trips.Group("", middleware.RequireRole(auth.RoleDriver), s.requireDriverProfile())
+			driverTrips.PATCH("/:id/accept", s.AcceptTrip)
+			driverTrips.PATCH("/:id/decline", s.DeclineTrip)
+			driverTrips.PATCH("/:id/start", s.authorizeTrip(tripDriverPolicy), s.StartTrip)
+			driverTrips.PATCH("/:id/end", s.authorizeTrip(tripDriverPolicy), s.EndTrip)
 		}
 	}
 
+	// Admin
+	admin := s.engine.Group("/api/admin", middleware.Auth(s.tokens), middleware.RequireRole())
+	{
+		admin.GET("/documents", s.ListDocumentsForReview)
+		admin.PATCH("/documents/:id/approve", s.ApproveDocument)
+		admin.PATCH("/documents/:id/reject", s.RejectDocument)
+		admin.GET("/ingest/stats", s.GetIngestStats)
+		admin.GET("/drivers/rates", s.GetDriverRates)
+		admin.GET("/matching/weights", s.GetMatchingWeights)
+		admin.PUT("/matching/weights", s.UpdateMatchingWeights)
+	}
+
 	// WebSocket endpoint for location updates
 	s.engine.GET("/ws", s.HandleWebsocket)
 }
 
+// customMethod atiende rutas estilo "/recurso:verbo". Gin registra ":verbo"
+// como parámetro, así que la ruta se declara con uno (":method") y aquí se
+// exige que su valor sea el verbo literal.
+func customMethod(verb string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Param("method") != ":"+verb {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		handler(c)
+	}
+}
+
+// newTokenManager elige RS256 si hay llave privada configurada, si no HS256
+func newTokenManager(cfg Config) (*auth.TokenManager, error) {
+	ttl := cfg.AccessTokenTTL
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+
+	if cfg.JWTPrivateKeyFile != "" {
+		pem, err := os.ReadFile(cfg.JWTPrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewRS256(pem, ttl)
+	}
+	return auth.NewHS256(cfg.JWTSecret, ttl)
+}
+
+func refreshTTL(cfg Config) time.Duration {
+	if cfg.RefreshTokenTTL <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return cfg.RefreshTokenTTL
+}
+
+func newSMSSender(cfg Config, log *logrus.Logger) notify.SMSSender {
+	if cfg.SMSSender == "file" {
+		path := cfg.SMSOutboxFile
+		if path == "" {
+			path = "sms_outbox.log"
+		}
+		return notify.NewFileSMSSender(path)
+	}
+	return notify.NewLogSMSSender(log)
+}
+
+func newEmailSender(cfg Config, log *logrus.Logger) notify.EmailSender {
+	if cfg.EmailSender == "outbox" {
+		return notify.NewOutboxEmailSender()
+	}
+	return notify.NewLogEmailSender(log)
+}
+
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
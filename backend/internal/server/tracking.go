@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/geo"
+	"github.com/criston04/TaxyTac/backend/internal/realtime"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// avgCitySpeedMps es la velocidad usada para el ETA cuando el driver está
+	// detenido o no reporta velocidad (~18 km/h en mototaxi)
+	avgCitySpeedMps = 5.0
+	// minMovingSpeedMps: por debajo se considera que el driver está detenido
+	minMovingSpeedMps = 1.0
+	// streamHeartbeat mantiene viva la conexión SSE a través de proxies
+	streamHeartbeat = 15 * time.Second
+)
+
+// TrackingUpdate es lo que recibe el pasajero por cada ubicación del driver
+type TrackingUpdate struct {
+	LocationPayload
+	// Target es "pickup" mientras el driver va a recoger y "destination" en viaje
+	Target    string  `json:"target"`
+	DistanceM float64 `json:"distance_m"`
+	ETAS      int     `json:"eta_s"`
+}
+
+// trackedTrip son los datos del viaje necesarios para calcular el ETA
+type trackedTrip struct {
+	Status    string
+	DriverID  string
+	OriginLat float64
+	OriginLng float64
+	DestLat   float64
+	DestLng   float64
+}
+
+// target devuelve el punto hacia el que se mueve el driver según el estado
+func (t *trackedTrip) target() (string, float64, float64) {
+	if t.Status == "started" {
+		return "destination", t.DestLat, t.DestLng
+	}
+	return "pickup", t.OriginLat, t.OriginLng
+}
+
+func (t *trackedTrip) update(loc LocationPayload) TrackingUpdate {
+	target, lat, lng := t.target()
+	distance := geo.DistanceMeters(loc.Lat, loc.Lng, lat, lng)
+
+	return TrackingUpdate{
+		LocationPayload: loc,
+		Target:          target,
+		DistanceM:       math.Round(distance),
+		ETAS:            etaSeconds(distance, loc.Speed),
+	}
+}
+
+// etaSeconds estima cuánto tarda el driver en recorrer distance a su
+// velocidad actual, o a la velocidad promedio si está detenido
+func etaSeconds(distance, speed float64) int {
+	if speed < minMovingSpeedMps {
+		speed = avgCitySpeedMps
+	}
+	return int(math.Ceil(distance / speed))
+}
+
+// StreamTrip envía por SSE la ubicación del driver del viaje con la distancia
+// y el ETA al punto de recojo (o al destino una vez iniciado). El stream
+// termina cuando el viaje se completa o se cancela.
+func (s *Server) StreamTrip(c *gin.Context) {
+	tripID := c.Param("id")
+
+	// Suscribirse antes de leer el estado para no perder un cambio intermedio
+	status := s.hub.Listen(realtime.TripTopic(tripID))
+	defer status.Close()
+
+	ctx := c.Request.Context()
+	trip, err := s.loadTrackedTrip(ctx, tripID)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to load trip for tracking")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trip not found"})
+		return
+	}
+	if trip.Status != "accepted" && trip.Status != "started" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Trip is not in progress"})
+		return
+	}
+
+	locations := s.hub.Listen(realtime.DriverTopic(trip.DriverID))
+	defer locations.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.SSEvent("status", gin.H{"trip_id": tripID, "status": trip.Status})
+	if loc, err := s.lastDriverLocation(ctx, trip.DriverID); err == nil {
+		c.SSEvent("location", trip.update(*loc))
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		s.log.WithError(err).Warn("Failed to load last driver location")
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-s.ctx.Done():
+			return false
+
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+
+		case raw := <-locations.C():
+			var msg realtime.Message
+			var loc LocationPayload
+			if json.Unmarshal(raw, &msg) != nil || json.Unmarshal(msg.Data, &loc) != nil {
+				return true
+			}
+			c.SSEvent("location", trip.update(loc))
+			return true
+
+		case raw := <-status.C():
+			var msg realtime.Message
+			var event struct {
+				Status string `json:"status"`
+			}
+			if json.Unmarshal(raw, &msg) != nil || json.Unmarshal(msg.Data, &event) != nil {
+				return true
+			}
+			trip.Status = event.Status
+			c.SSEvent("status", gin.H{"trip_id": tripID, "status": event.Status})
+			return event.Status == "accepted" || event.Status == "started"
+		}
+	})
+}
+
+func (s *Server) loadTrackedTrip(ctx context.Context, tripID string) (*trackedTrip, error) {
+	query := `
+		SELECT status, COALESCE(driver_id::text, ''),
+			ST_Y(origin::geometry), ST_X(origin::geometry),
+			ST_Y(destination::geometry), ST_X(destination::geometry)
+		FROM trips
+		WHERE id = $1
+	`
+
+	var t trackedTrip
+	err := s.db.QueryRow(ctx, query, tripID).Scan(
+		&t.Status, &t.DriverID, &t.OriginLat, &t.OriginLng, &t.DestLat, &t.DestLng)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// lastDriverLocation devuelve la última ubicación del driver. Primero la del
+// índice GEO, que se actualiza con cada punto en vivo; la de locations puede
+// estar atrasada hasta un lote del pipeline de ingesta.
+func (s *Server) lastDriverLocation(ctx context.Context, driverID string) (*LocationPayload, error) {
+	pos, err := s.geo.Get(ctx, driverID)
+	if err == nil {
+		return &LocationPayload{
+			DriverID: driverID,
+			Lat:      pos.Lat,
+			Lng:      pos.Lng,
+			TS:       pos.TS,
+			Speed:    pos.Speed,
+			Heading:  pos.Heading,
+		}, nil
+	}
+	if !errors.Is(err, geo.ErrNoPosition) {
+		s.log.WithError(err).Warn("Geo index unavailable, loading last location from PostGIS")
+	}
+
+	query := `
+		SELECT ST_Y(geom::geometry), ST_X(geom::geometry), COALESCE(speed, 0), COALESCE(heading, 0),
+			(EXTRACT(EPOCH FROM ts) * 1000)::bigint
+		FROM locations
+		WHERE driver_id = $1
+		ORDER BY ts DESC
+		LIMIT 1
+	`
+
+	loc := LocationPayload{DriverID: driverID}
+	err = s.db.QueryRow(ctx, query, driverID).Scan(&loc.Lat, &loc.Lng, &loc.Speed, &loc.Heading, &loc.TS)
+	if err != nil {
+		return nil, err
+	}
+	return &loc, nil
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const maxVehiclePhotos = 10
+
+var errVehicleInUse = errors.New("active vehicle in use")
+
+// Vehicle es la mototaxi de un driver
+type Vehicle struct {
+	ID        string    `json:"id"`
+	Make      string    `json:"make"`
+	Model     string    `json:"model"`
+	Plate     string    `json:"plate"`
+	Year      *int      `json:"year,omitempty"`
+	Color     *string   `json:"color,omitempty"`
+	Photos    []string  `json:"photos"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const vehicleColumns = `id, make, model, plate, year, color, photos, is_active, created_at`
+
+func scanVehicle(row pgx.Row) (*Vehicle, error) {
+	var v Vehicle
+	var photos []byte
+	if err := row.Scan(&v.ID, &v.Make, &v.Model, &v.Plate, &v.Year, &v.Color, &photos, &v.IsActive, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+	v.Photos = []string{}
+	if len(photos) > 0 {
+		_ = json.Unmarshal(photos, &v.Photos)
+	}
+	return &v, nil
+}
+
+// vehicleInput son los campos editables de un vehículo; nil = no cambia
+type vehicleInput struct {
+	Make   *string   `json:"make"`
+	Model  *string   `json:"model"`
+	Plate  *string   `json:"plate"`
+	Year   *int      `json:"year"`
+	Color  *string   `json:"color"`
+	Photos *[]string `json:"photos"`
+}
+
+// validate revisa los campos presentes; en creación make, model y plate son obligatorios
+func (in *vehicleInput) validate(creating bool) []*middleware.ValidationError {
+	var errs []*middleware.ValidationError
+
+	if in.Plate != nil {
+		plate := strings.ToUpper(strings.TrimSpace(*in.Plate))
+		in.Plate = &plate
+	}
+	if creating || in.Plate != nil {
+		plate := ""
+		if in.Plate != nil {
+			plate = *in.Plate
+		}
+		if verr := middleware.ValidatePlate(plate); verr != nil {
+			errs = append(errs, verr)
+		}
+	}
+	if (creating && in.Make == nil) || (in.Make != nil && strings.TrimSpace(*in.Make) == "") {
+		errs = append(errs, middleware.NewValidationError("make", "required"))
+	}
+	if (creating && in.Model == nil) || (in.Model != nil && strings.TrimSpace(*in.Model) == "") {
+		errs = append(errs, middleware.NewValidationError("model", "required"))
+	}
+	if in.Year != nil && (*in.Year < 1980 || *in.Year > time.Now().Year()+1) {
+		errs = append(errs, middleware.NewValidationError("year", "invalid"))
+	}
+	if in.Photos != nil {
+		if len(*in.Photos) > maxVehiclePhotos {
+			errs = append(errs, middleware.NewValidationError("photos", "max", strconv.Itoa(maxVehiclePhotos)))
+		}
+		for _, p := range *in.Photos {
+			u, err := url.Parse(p)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, middleware.NewValidationError("photos", "url"))
+				break
+			}
+		}
+	}
+
+	return errs
+}
+
+// ListMyVehicles lista los vehículos del driver autenticado
+func (s *Server) ListMyVehicles(c *gin.Context) {
+	driverID, ok := currentDriverID(c)
+	if !ok {
+		return
+	}
+
+	query := `SELECT ` + vehicleColumns + ` FROM vehicles WHERE driver_id = $1 ORDER BY is_active DESC, created_at DESC`
+	rows, err := s.db.Query(context.Background(), query, driverID)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to query vehicles")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query vehicles"})
+		return
+	}
+	defer rows.Close()
+
+	vehicles := []*Vehicle{}
+	for rows.Next() {
+		v, err := scanVehicle(rows)
+		if err != nil {
+			s.log.WithError(err).Warn("Failed to scan vehicle row")
+			continue
+		}
+		vehicles = append(vehicles, v)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"vehicles": vehicles,
+		"count":    len(vehicles),
+	})
+}
+
+// CreateMyVehicle registra un vehículo; el primero queda activo automáticamente
+func (s *Server) CreateMyVehicle(c *gin.Context) {
+	driverID, ok := currentDriverID(c)
+	if !ok {
+		return
+	}
+
+	var body vehicleInput
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+	if errs := body.validate(true); len(errs) > 0 {
+		middleware.RespondWithValidationErrors(c, errs)
+		return
+	}
+
+	photos := []string{}
+	if body.Photos != nil {
+		photos = *body.Photos
+	}
+	photosJSON, _ := json.Marshal(photos)
+
+	query := `
+		INSERT INTO vehicles (driver_id, make, model, plate, year, color, photos, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7,
+			NOT EXISTS (SELECT 1 FROM vehicles WHERE driver_id = $1 AND is_active))
+		RETURNING ` + vehicleColumns
+
+	v, err := scanVehicle(s.db.QueryRow(context.Background(), query,
+		driverID, *body.Make, *body.Model, *body.Plate, body.Year, body.Color, photosJSON))
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Plate already registered"})
+		return
+	}
+	if err != nil {
+		s.log.WithError(err).Error("Failed to create vehicle")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create vehicle"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, v)
+}
+
+// UpdateMyVehicle modifica los campos enviados de un vehículo del driver
+func (s *Server) UpdateMyVehicle(c *gin.Context) {
+	driverID, ok := currentDriverID(c)
+	if !ok {
+		return
+	}
+
+	var body vehicleInput
+	if !middleware.BindJSON(c, &body) {
+		return
+	}
+	if errs := body.validate(false); len(errs) > 0 {
+		middleware.RespondWithValidationErrors(c, errs)
+		return
+	}
+
+	var photosJSON []byte
+	if body.Photos != nil {
+		photosJSON, _ = json.Marshal(*body.Photos)
+	}
+
+	query := `
+		UPDATE vehicles SET
+			make = COALESCE($3, make),
+			model = COALESCE($4, model),
+			plate = COALESCE($5, plate),
+			year = COALESCE($6, year),
+			color = COALESCE($7, color),
+			photos = COALESCE($8::jsonb, photos)
+		WHERE id = $1 AND driver_id = $2
+		RETURNING ` + vehicleColumns
+
+	v, err := scanVehicle(s.db.QueryRow(context.Background(), query,
+		c.Param("vehicleId"), driverID, body.Make, body.Model, body.Plate, body.Year, body.Color, photosJSON))
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Plate already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vehicle not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
+
+// ActivateMyVehicle marca el vehículo como el activo del driver
+func (s *Server) ActivateMyVehicle(c *gin.Context) {
+	driverID, ok := currentDriverID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	var v *Vehicle
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		if err := ensureDriverNotBusy(ctx, tx, driverID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `UPDATE vehicles SET is_active = false WHERE driver_id = $1 AND is_active`, driverID); err != nil {
+			return err
+		}
+
+		query := `UPDATE vehicles SET is_active = true WHERE id = $1 AND driver_id = $2 RETURNING ` + vehicleColumns
+		var err error
+		v, err = scanVehicle(tx.QueryRow(ctx, query, c.Param("vehicleId"), driverID))
+		return err
+	})
+
+	switch {
+	case errors.Is(err, errVehicleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot change vehicle during a trip"})
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vehicle not found"})
+		return
+	case err != nil:
+		s.log.WithError(err).Error("Failed to activate vehicle")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to activate vehicle"})
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
+
+// DeleteMyVehicle elimina un vehículo del driver
+func (s *Server) DeleteMyVehicle(c *gin.Context) {
+	driverID, ok := currentDriverID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		var active bool
+		query := `SELECT is_active FROM vehicles WHERE id = $1 AND driver_id = $2 FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, c.Param("vehicleId"), driverID).Scan(&active); err != nil {
+			return err
+		}
+		if active {
+			if err := ensureDriverNotBusy(ctx, tx, driverID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM vehicles WHERE id = $1`, c.Param("vehicleId"))
+		return err
+	})
+
+	switch {
+	case errors.Is(err, errVehicleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot remove the active vehicle during a trip"})
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vehicle not found"})
+		return
+	case err != nil:
+		s.log.WithError(err).Error("Failed to delete vehicle")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vehicle"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func ensureDriverNotBusy(ctx context.Context, tx pgx.Tx, driverID string) error {
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT status FROM drivers WHERE id = $1 FOR UPDATE`, driverID).Scan(&status); err != nil {
+		return err
+	}
+	if status == "busy" {
+		return errVehicleInUse
+	}
+	return nil
+}
+
+// activeVehicle devuelve el vehículo activo del driver (nil si no tiene)
+func (s *Server) activeVehicle(ctx context.Context, driverID string) (*Vehicle, error) {
+	query := `SELECT ` + vehicleColumns + ` FROM vehicles WHERE driver_id = $1 AND is_active`
+	v, err := scanVehicle(s.db.QueryRow(ctx, query, driverID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return v, err
+}
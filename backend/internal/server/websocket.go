@@ -0,0 +1,363 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/auth"
+	"github.com/criston04/TaxyTac/backend/internal/geo"
+	"github.com/criston04/TaxyTac/backend/internal/ingest"
+	"github.com/criston04/TaxyTac/backend/internal/middleware"
+	"github.com/criston04/TaxyTac/backend/internal/realtime"
+	"github.com/criston04/TaxyTac/backend/internal/wire"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// newUpgrader arma el upgrader de WebSocket con la lista de orígenes permitidos
+func newUpgrader(cfg Config) websocket.Upgrader {
+	return websocket.Upgrader{
+		CheckOrigin:     originChecker(cfg.AllowedOrigins),
+		Subprotocols:    []string{wire.Subprotocol},
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+	}
+}
+
+// originChecker acepta clientes sin Origin (apps nativas), los orígenes de la
+// lista ("*" acepta todos) y, si la lista está vacía, sólo el mismo host
+func originChecker(allowed []string) func(r *http.Request) bool {
+	set := make(map[string]bool, len(allowed))
+	for _, origin := range allowed {
+		set[strings.TrimRight(strings.ToLower(origin), "/")] = true
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if set["*"] || set[strings.ToLower(origin)] {
+			return true
+		}
+		if len(set) > 0 {
+			return false
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// wsToken toma el access token del header Authorization o, para navegadores
+// que no pueden enviar headers en el upgrade, del query param ?token=
+func wsToken(r *http.Request) string {
+	if token := middleware.BearerToken(r); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+// HandleWebsocket abre la conexión en tiempo real del usuario autenticado.
+// Todos reciben los mensajes empujados por el hub y pueden seguir sus viajes
+// con subscribe (ver wssubscribe.go); los drivers además envían
+// sus ubicaciones, en JSON o en el formato binario de wire si negociaron el
+// subprotocolo, y el driver sale del token (un payload con otro driver_id se
+// rechaza).
+func (s *Server) HandleWebsocket(c *gin.Context) {
+	token := wsToken(c.Request)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing bearer token"})
+		return
+	}
+	claims, err := s.tokens.Verify(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	var driverID string
+	if claims.Role == auth.RoleDriver {
+		driverID, err = s.driverIDForUser(c.Request.Context(), claims.UserID())
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User has no driver profile"})
+			return
+		}
+		if err != nil {
+			s.log.WithError(err).Error("Failed to load driver profile")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load driver profile"})
+			return
+		}
+	}
+
+	conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		s.log.WithError(err).Warn("WS upgrade failed")
+		return
+	}
+
+	// La sesión dura lo que el access token; el cliente reconecta con uno nuevo
+	var expiresAt time.Time
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	client := realtime.NewClient(conn, claims.UserID(), claims.Role, expiresAt)
+	s.hub.Register(client)
+	go client.WritePump()
+
+	log := s.log.WithFields(logrus.Fields{"user": claims.UserID(), "role": claims.Role})
+	if driverID != "" {
+		log = log.WithField("driver", driverID)
+	}
+	// Con el subprotocolo binario las ubicaciones llegan como frames binarios
+	// y se confirman en ACK agrupados; los mensajes de texto siguen siendo JSON
+	var acks *ackCoalescer
+	if client.Subprotocol() == wire.Subprotocol {
+		acks = newAckCoalescer(client)
+		defer acks.stop()
+		log = log.WithField("protocol", wire.Subprotocol)
+	}
+	log.Info("New WebSocket connection established")
+
+	err = client.ReadPump(func(kind int, data []byte) {
+		if kind == websocket.TextMessage && s.handleSubscription(client, log, claims, driverID, data) {
+			return
+		}
+		if driverID == "" {
+			// Pasajeros y admin sólo reciben; ignoramos lo que envíen
+			return
+		}
+		if kind == websocket.BinaryMessage {
+			if acks == nil {
+				log.Warn("WS binary frame without negotiated subprotocol")
+				return
+			}
+			s.handleDriverBinary(acks, log, driverID, data)
+			return
+		}
+		s.handleDriverLocation(client, log, driverID, data)
+	})
+
+	s.hub.Unregister(client)
+	switch {
+	case client.Expired():
+		client.CloseWith(websocket.ClosePolicyViolation, "token expired")
+	case websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure):
+		log.WithError(err).Warn("WS unexpected close")
+		client.Close()
+	default:
+		client.Close()
+	}
+}
+
+// wsMessage es el sobre de lo que envía el driver; sin type es una ubicación
+type wsMessage struct {
+	Type string `json:"type"`
+	LocationPayload
+	// Points trae las ubicaciones de un mensaje "batch"
+	Points []LocationPayload `json:"points,omitempty"`
+}
+
+// handleDriverLocation procesa un mensaje del driver y le responde con el ACK
+func (s *Server) handleDriverLocation(client *realtime.Client, log *logrus.Entry, driverID string, data []byte) {
+	var msg wsMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.WithError(err).Warn("Invalid WS payload")
+		return
+	}
+	if msg.Type == "heartbeat" {
+		client.SendJSON(map[string]interface{}{
+			"status": "ok",
+			"ts":     time.Now().Unix(),
+		})
+		return
+	}
+	if msg.Type == "batch" {
+		s.handleDriverBatch(client, log, driverID, msg.Points)
+		return
+	}
+	loc := msg.LocationPayload
+
+	if loc.DriverID != "" && loc.DriverID != driverID {
+		log.WithField("claimed", loc.DriverID).Warn("WS payload for another driver rejected")
+		client.SendJSON(map[string]interface{}{
+			"status": "error",
+			"error":  "driver_id does not match token",
+		})
+		return
+	}
+	loc.DriverID = driverID
+
+	client.SendJSON(s.processLocation(log, loc))
+}
+
+// Estados del ACK de una ubicación
+const (
+	ackOK        = "ok"
+	ackLate      = "late"
+	ackDuplicate = "duplicate"
+	ackRejected  = "rejected"
+)
+
+// locationAck es la respuesta a cada ubicación. LastSeq es el último seq
+// aceptado del driver: el cliente puede borrar de su buffer todo lo anterior.
+type locationAck struct {
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Seq     int64  `json:"seq,omitempty"`
+	LastSeq int64  `json:"last_seq,omitempty"`
+	TS      int64  `json:"ts"`
+}
+
+// processLocation valida la ubicación de un driver ya autenticado, la publica
+// si es la más nueva y la persiste salvo que sea un reenvío
+func (s *Server) processLocation(log *logrus.Entry, loc LocationPayload) locationAck {
+	// Sin timestamp del teléfono se usa la hora de recepción
+	now := time.Now()
+	if loc.TS == 0 {
+		loc.TS = now.UnixMilli()
+	}
+	ack := locationAck{Status: ackOK, Seq: loc.Seq, LastSeq: loc.Seq, TS: now.Unix()}
+
+	// Descartar glitches de GPS antes de que lleguen al matching o a la tarifa
+	point := ingest.Point{
+		DriverID: loc.DriverID,
+		Lat:      loc.Lat,
+		Lng:      loc.Lng,
+		Speed:    loc.Speed,
+		Heading:  loc.Heading,
+		TS:       loc.TS,
+		Seq:      loc.Seq,
+	}
+	if reason := s.filter.Check(point, now); reason != "" {
+		log.WithFields(logrus.Fields{
+			"reason": reason,
+			"lat":    loc.Lat,
+			"lng":    loc.Lng,
+			"ts":     loc.TS,
+		}).Debug("Location rejected")
+		ack.Status = ackRejected
+		ack.Reason = reason
+		ack.LastSeq = 0
+		return ack
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	// Con seq se descartan reenvíos y los puntos atrasados sólo se archivan.
+	// Si Redis falla se trata como el más nuevo, igual que un cliente sin seq.
+	result := ingest.SeqLatest
+	if loc.Seq > 0 {
+		var err error
+		result, ack.LastSeq, err = s.seqs.Track(ctx, point)
+		if err != nil {
+			log.WithError(err).Warn("Failed to track location sequence")
+			result, ack.LastSeq = ingest.SeqLatest, loc.Seq
+		}
+	}
+
+	switch result {
+	case ingest.SeqDuplicate:
+		ack.Status = ackDuplicate
+		return ack
+	case ingest.SeqLate:
+		ack.Status = ackLate
+	default:
+		s.publishLocation(ctx, log, loc)
+	}
+
+	// Persistir en lote a PostgreSQL; bajo sobrecarga el pipeline puede descartarlo
+	s.ingest.Submit(point)
+
+	log.WithFields(logrus.Fields{
+		"lat":    loc.Lat,
+		"lng":    loc.Lng,
+		"seq":    loc.Seq,
+		"status": ack.Status,
+	}).Info("Location received")
+
+	return ack
+}
+
+// publishLocation lleva la ubicación a la vista en vivo: la publica en Redis
+// pub/sub (el hub la reparte a quien siga al driver) y actualiza el índice GEO
+// que usa la búsqueda de cercanos
+func (s *Server) publishLocation(ctx context.Context, log *logrus.Entry, loc LocationPayload) {
+	payload, _ := json.Marshal(loc)
+	if err := s.redis.Publish(ctx, realtime.LocationsChannel, string(payload)).Err(); err != nil {
+		log.WithError(err).Warn("Failed to publish to Redis")
+	}
+	err := s.geo.Update(ctx, geo.Position{
+		DriverID: loc.DriverID,
+		Lat:      loc.Lat,
+		Lng:      loc.Lng,
+		Speed:    loc.Speed,
+		Heading:  loc.Heading,
+		TS:       loc.TS,
+	})
+	if err != nil {
+		log.WithError(err).Warn("Failed to update geo index")
+	}
+}
+
+// notifyTripStatus avisa por el hub al pasajero, al driver (también por MQTT)
+// y a los streams del viaje que cambió su estado. Es best-effort: no bloquea ni falla la petición.
+func (s *Server) notifyTripStatus(tripID, status string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		query := `
+			SELECT COALESCE(t.rider_id::text, ''), COALESCE(t.driver_id::text, ''), COALESCE(d.user_id::text, '')
+			FROM trips t
+			LEFT JOIN drivers d ON d.id = t.driver_id
+			WHERE t.id = $1
+		`
+		var riderID, driverID, driverUserID string
+		if err := s.db.QueryRow(ctx, query, tripID).Scan(&riderID, &driverID, &driverUserID); err != nil {
+			s.log.WithError(err).Warn("Failed to load trip for notification")
+			return
+		}
+
+		event := gin.H{
+			"trip_id":   tripID,
+			"status":    status,
+			"driver_id": driverID,
+		}
+		if err := s.hub.PublishTopic(ctx, realtime.TripTopic(tripID), realtime.TypeTripStatus, event); err != nil {
+			s.log.WithError(err).Warn("Failed to publish trip status")
+		}
+		for _, userID := range []string{riderID, driverUserID} {
+			if userID == "" {
+				continue
+			}
+			if err := s.hub.SendToUser(ctx, userID, realtime.TypeTripStatus, event); err != nil {
+				s.log.WithError(err).Warn("Failed to push trip status")
+			}
+		}
+		if s.mqtt != nil && driverID != "" {
+			s.mqtt.PublishEvent(driverID, realtime.TypeTripStatus, event)
+		}
+	}()
+}
+
+// IngestStats son los contadores del pipeline más los rechazos del filtro
+type IngestStats struct {
+	ingest.Stats
+	Rejected map[string]int64 `json:"rejected"`
+}
+
+// GetIngestStats devuelve los contadores del pipeline de ubicaciones (admin)
+func (s *Server) GetIngestStats(c *gin.Context) {
+	c.JSON(http.StatusOK, IngestStats{
+		Stats:    s.ingest.Stats(),
+		Rejected: s.filter.Rejected(),
+	})
+}
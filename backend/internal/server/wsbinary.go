@@ -0,0 +1,150 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/realtime"
+	"github.com/criston04/TaxyTac/backend/internal/wire"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ackEvery y ackInterval controlan cada cuánto se confirma en el protocolo
+	// binario: tras ackEvery ubicaciones o ackInterval después de la primera
+	// sin confirmar, lo que ocurra antes
+	ackEvery    = 10
+	ackInterval = 2 * time.Second
+)
+
+// ackCoalescer junta los ACK de una conexión binaria en un solo frame
+type ackCoalescer struct {
+	client *realtime.Client
+	// send entrega el frame de ACK (client.SendBinary)
+	send     func([]byte) bool
+	every    uint16
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending wire.Ack
+	lastSeq int64
+	timer   *time.Timer
+}
+
+func newAckCoalescer(client *realtime.Client) *ackCoalescer {
+	return &ackCoalescer{
+		client:   client,
+		send:     client.SendBinary,
+		every:    ackEvery,
+		interval: ackInterval,
+	}
+}
+
+// add suma el resultado de una ubicación
+func (a *ackCoalescer) add(ack locationAck) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pending.Received++
+	switch ack.Status {
+	case ackRejected:
+		a.pending.Rejected++
+	case ackDuplicate:
+		a.pending.Duplicates++
+	}
+	if ack.LastSeq > 0 {
+		a.lastSeq = ack.LastSeq
+	}
+
+	if a.pending.Received >= a.every {
+		a.flushLocked()
+		return
+	}
+	if a.timer == nil {
+		a.timer = time.AfterFunc(a.interval, a.flush)
+	}
+}
+
+// addBatch suma el resultado de un lote y confirma de inmediato
+func (a *ackCoalescer) addBatch(ack batchAck) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pending.Received = clampAdd(a.pending.Received, ack.Received)
+	a.pending.Rejected = clampAdd(a.pending.Rejected, len(ack.Rejected))
+	a.pending.Duplicates = clampAdd(a.pending.Duplicates, int(ack.Duplicates))
+	if ack.LastSeq > 0 {
+		a.lastSeq = ack.LastSeq
+	}
+	a.flushLocked()
+}
+
+// flush envía lo pendiente; sin nada pendiente repite el último seq (heartbeat)
+func (a *ackCoalescer) flush() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.flushLocked()
+}
+
+func (a *ackCoalescer) flushLocked() {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	a.pending.LastSeq = a.lastSeq
+	a.send(wire.EncodeAck(a.pending))
+	a.pending = wire.Ack{}
+}
+
+// stop descarta el temporizador al cerrarse la conexión
+func (a *ackCoalescer) stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+}
+
+func clampAdd(v uint16, n int) uint16 {
+	if int(v)+n > 0xFFFF {
+		return 0xFFFF
+	}
+	return v + uint16(n)
+}
+
+// handleDriverBinary procesa un frame del protocolo binario
+func (s *Server) handleDriverBinary(acks *ackCoalescer, log *logrus.Entry, driverID string, data []byte) {
+	frame, err := wire.Decode(data)
+	if err != nil {
+		log.WithError(err).Warn("Invalid WS binary frame")
+		return
+	}
+
+	switch frame.Type {
+	case wire.FrameHeartbeat:
+		acks.flush()
+	case wire.FrameLocation:
+		acks.add(s.processLocation(log, wireToPayload(driverID, frame.Locations[0])))
+	case wire.FrameBatch:
+		points := make([]LocationPayload, len(frame.Locations))
+		for i, loc := range frame.Locations {
+			points[i] = wireToPayload(driverID, loc)
+		}
+		if ack, ok := s.processDriverBatch(acks.client, log, driverID, points); ok {
+			acks.addBatch(ack)
+		}
+	}
+}
+
+func wireToPayload(driverID string, loc wire.Location) LocationPayload {
+	return LocationPayload{
+		DriverID: driverID,
+		Lat:      loc.Lat,
+		Lng:      loc.Lng,
+		TS:       loc.TS,
+		Speed:    loc.Speed,
+		Heading:  loc.Heading,
+		Seq:      loc.Seq,
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/wire"
+)
+
+// ackRecorder guarda los frames de ACK que enviaría la conexión
+type ackRecorder struct {
+	mu   sync.Mutex
+	acks []wire.Ack
+	sent chan struct{}
+}
+
+func newAckRecorder() *ackRecorder {
+	return &ackRecorder{sent: make(chan struct{}, 16)}
+}
+
+func (r *ackRecorder) send(frame []byte) bool {
+	ack, err := wire.DecodeAck(frame)
+	if err != nil {
+		panic(err)
+	}
+	r.mu.Lock()
+	r.acks = append(r.acks, ack)
+	r.mu.Unlock()
+	r.sent <- struct{}{}
+	return true
+}
+
+func (r *ackRecorder) all() []wire.Ack {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]wire.Ack(nil), r.acks...)
+}
+
+func newTestCoalescer(rec *ackRecorder, interval time.Duration) *ackCoalescer {
+	return &ackCoalescer{send: rec.send, every: ackEvery, interval: interval}
+}
+
+func TestAckCoalescerFlushOnCount(t *testing.T) {
+	rec := newAckRecorder()
+	acks := newTestCoalescer(rec, time.Hour)
+	defer acks.stop()
+
+	statuses := []string{ackOK, ackOK, ackRejected, ackOK, ackDuplicate, ackOK, ackLate, ackOK, ackOK}
+	for i, status := range statuses {
+		ack := locationAck{Status: status, Seq: int64(i + 1), LastSeq: int64(i + 1)}
+		if status == ackRejected {
+			ack.LastSeq = 0
+		}
+		acks.add(ack)
+	}
+	if got := rec.all(); len(got) != 0 {
+		t.Fatalf("flushed before %d locations: %+v", ackEvery, got)
+	}
+
+	acks.add(locationAck{Status: ackOK, Seq: 10, LastSeq: 10})
+	got := rec.all()
+	want := wire.Ack{LastSeq: 10, Received: 10, Rejected: 1, Duplicates: 1}
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("acks = %+v, want [%+v]", got, want)
+	}
+
+	// Lo siguiente empieza una cuenta nueva
+	for i := 0; i < ackEvery; i++ {
+		acks.add(locationAck{Status: ackOK, Seq: int64(11 + i), LastSeq: int64(11 + i)})
+	}
+	got = rec.all()
+	want = wire.Ack{LastSeq: 20, Received: ackEvery}
+	if len(got) != 2 || got[1] != want {
+		t.Fatalf("acks = %+v, want second %+v", got, want)
+	}
+}
+
+func TestAckCoalescerFlushOnInterval(t *testing.T) {
+	rec := newAckRecorder()
+	acks := newTestCoalescer(rec, 20*time.Millisecond)
+	defer acks.stop()
+
+	acks.add(locationAck{Status: ackOK, Seq: 1, LastSeq: 1})
+	acks.add(locationAck{Status: ackRejected, Seq: 2})
+
+	select {
+	case <-rec.sent:
+	case <-time.After(time.Second):
+		t.Fatal("no ack after the interval")
+	}
+	got := rec.all()
+	want := wire.Ack{LastSeq: 1, Received: 2, Rejected: 1}
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("acks = %+v, want [%+v]", got, want)
+	}
+
+	// Sin ubicaciones nuevas no hay más ACK
+	select {
+	case <-rec.sent:
+		t.Fatalf("unexpected ack: %+v", rec.all())
+	case <-time.After(60 * time.Millisecond):
+	}
+}
+
+func TestAckCoalescerBatchAndHeartbeat(t *testing.T) {
+	rec := newAckRecorder()
+	acks := newTestCoalescer(rec, time.Hour)
+	defer acks.stop()
+
+	acks.add(locationAck{Status: ackOK, Seq: 1, LastSeq: 1})
+	acks.addBatch(batchAck{
+		Received:   5,
+		Duplicates: 1,
+		Rejected:   []rejectedPoint{{}},
+		LastSeq:    6,
+	})
+	// Heartbeat sin nada pendiente: repite el último seq
+	acks.flush()
+
+	got := rec.all()
+	want := []wire.Ack{
+		{LastSeq: 6, Received: 6, Rejected: 1, Duplicates: 1},
+		{LastSeq: 6},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("acks = %+v, want %+v", got, want)
+	}
+}
+
+func TestAckCoalescerStopCancelsTimer(t *testing.T) {
+	rec := newAckRecorder()
+	acks := newTestCoalescer(rec, 20*time.Millisecond)
+
+	acks.add(locationAck{Status: ackOK, Seq: 1, LastSeq: 1})
+	acks.stop()
+
+	select {
+	case <-rec.sent:
+		t.Fatalf("ack after stop: %+v", rec.all())
+	case <-time.After(60 * time.Millisecond):
+	}
+}
+
+// Una ubicación enviada en JSON y la misma en binario deben llegar iguales a
+// processLocation, salvo la precisión del formato binario
+func TestLocationFormatParity(t *testing.T) {
+	const driverID = "driver-1"
+	points := []LocationPayload{
+		{Lat: -12.0464, Lng: -77.0428, TS: 1699876543210, Seq: 42, Speed: 15.5, Heading: 180},
+		{Lat: -12.1, Lng: -76.95, TS: 1699876544210, Seq: 43},
+		{Lat: 0.0000001, Lng: -0.0000001, TS: 1699876545210, Seq: 44, Speed: 0.01, Heading: 359.99},
+	}
+
+	for _, p := range points {
+		raw, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg wsMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			t.Fatal(err)
+		}
+		fromJSON := msg.LocationPayload
+		fromJSON.DriverID = driverID
+
+		frame, err := wire.Decode(wire.EncodeLocation(payloadToWire(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromBinary := wireToPayload(driverID, frame.Locations[0])
+
+		assertSamePayload(t, fromBinary, fromJSON)
+	}
+
+	// Lo mismo para un lote
+	raw, err := json.Marshal(map[string]any{"type": "batch", "points": points})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg wsMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	locs := make([]wire.Location, len(points))
+	for i, p := range points {
+		locs[i] = payloadToWire(p)
+	}
+	frame, err := wire.Decode(wire.EncodeBatch(locs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "batch" || len(msg.Points) != len(frame.Locations) {
+		t.Fatalf("JSON batch has %d points, binary %d", len(msg.Points), len(frame.Locations))
+	}
+	for i, loc := range frame.Locations {
+		fromJSON := msg.Points[i]
+		fromJSON.DriverID = driverID
+		assertSamePayload(t, wireToPayload(driverID, loc), fromJSON)
+	}
+}
+
+func payloadToWire(p LocationPayload) wire.Location {
+	return wire.Location{Seq: p.Seq, TS: p.TS, Lat: p.Lat, Lng: p.Lng, Speed: p.Speed, Heading: p.Heading}
+}
+
+func assertSamePayload(t *testing.T, got, want LocationPayload) {
+	t.Helper()
+	near := func(a, b, tol float64) bool { return a-b <= tol && b-a <= tol }
+	if got.DriverID != want.DriverID || got.Seq != want.Seq || got.TS != want.TS ||
+		!near(got.Lat, want.Lat, 1e-7) || !near(got.Lng, want.Lng, 1e-7) ||
+		!near(got.Speed, want.Speed, 0.01) || !near(got.Heading, want.Heading, 0.01) {
+		t.Errorf("binary payload = %+v, JSON payload = %+v", got, want)
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/auth"
+	"github.com/criston04/TaxyTac/backend/internal/realtime"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Mensajes de /ws con los que un cliente sigue un viaje
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+)
+
+// wsSubscription es el cuerpo de subscribe/unsubscribe
+type wsSubscription struct {
+	Type   string `json:"type"`
+	TripID string `json:"trip_id"`
+}
+
+// tripWatchKey identifica el seguimiento de un viaje por una conexión
+type tripWatchKey struct {
+	client *realtime.Client
+	tripID string
+}
+
+// tripWatch es la gorutina watchFollowedTrip de un seguimiento. unfollowTrip
+// la cancela y espera done; recién entonces lee followed.
+type tripWatch struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	followed string
+}
+
+// wsSubscriptionAck es la respuesta a subscribe
+type wsSubscriptionAck struct {
+	Type   string `json:"type"`
+	TripID string `json:"trip_id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// handleSubscription atiende subscribe/unsubscribe de cualquier rol; devuelve
+// false si el mensaje es de otro tipo
+func (s *Server) handleSubscription(client *realtime.Client, log *logrus.Entry, claims *auth.Claims, driverID string, data []byte) bool {
+	var msg wsSubscription
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return false
+	}
+	switch msg.Type {
+	case wsSubscribe:
+		s.followTrip(client, log, claims, driverID, msg.TripID)
+	case wsUnsubscribe:
+		s.unfollowTrip(client, msg.TripID)
+	default:
+		return false
+	}
+	return true
+}
+
+// followTrip suscribe el cliente al estado del viaje y, mientras tenga driver
+// asignado y esté en curso, a las ubicaciones de ese driver. Sólo el pasajero,
+// el driver asignado o un admin pueden seguirlo; el driver asignado no recibe
+// su propia ubicación.
+func (s *Server) followTrip(client *realtime.Client, log *logrus.Entry, claims *auth.Claims, driverID, tripID string) {
+	reply := func(status, reason string) {
+		client.SendJSON(wsSubscriptionAck{Type: wsSubscribe, TripID: tripID, Status: status, Error: reason})
+	}
+	if tripID == "" {
+		reply("error", "trip_id is required")
+		return
+	}
+	tripTopic := realtime.TripTopic(tripID)
+	if s.hub.Subscribed(client, tripTopic) {
+		reply("ok", "")
+		return
+	}
+
+	// Escuchar antes de leer el estado para no perder un cambio intermedio
+	status := s.hub.Listen(tripTopic)
+
+	ctx, cancel := context.WithTimeout(s.ctx, 2*time.Second)
+	trip, err := s.loadTripParties(ctx, tripID)
+	cancel()
+	if err != nil {
+		status.Close()
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.WithError(err).Error("Failed to load trip for subscription")
+		}
+		reply("error", "trip not found")
+		return
+	}
+	if !claims.IsAdmin() && !tripPartyPolicy(claims, driverID, trip) {
+		status.Close()
+		reply("error", "forbidden")
+		return
+	}
+	if !tripActive(trip.Status) && trip.Status != "requested" {
+		status.Close()
+		reply("error", "trip is not in progress")
+		return
+	}
+
+	followed := ""
+	s.hub.Subscribe(client, tripTopic)
+	if tripActive(trip.Status) && trip.DriverID != "" && trip.DriverID != driverID {
+		followed = trip.DriverID
+		s.hub.Subscribe(client, realtime.DriverTopic(followed))
+	}
+	reply("ok", "")
+
+	s.startTripWatch(client, status, tripID, driverID, followed)
+}
+
+// startTripWatch registra y arranca el watchFollowedTrip del cliente para el
+// viaje. Sólo hay uno por conexión y viaje: unsubscribe lo detiene antes de
+// que un nuevo subscribe arranque otro.
+func (s *Server) startTripWatch(client *realtime.Client, status *realtime.Listener, tripID, self, followed string) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	w := &tripWatch{cancel: cancel, done: make(chan struct{})}
+	key := tripWatchKey{client: client, tripID: tripID}
+
+	s.watchMu.Lock()
+	prev := s.tripWatches[key]
+	s.tripWatches[key] = w
+	s.watchMu.Unlock()
+	if prev != nil {
+		prev.cancel()
+	}
+
+	go func() {
+		defer close(w.done)
+		w.followed = s.watchFollowedTrip(ctx, client, status, tripID, self, followed)
+
+		s.watchMu.Lock()
+		if s.tripWatches[key] == w {
+			delete(s.tripWatches, key)
+		}
+		s.watchMu.Unlock()
+		cancel()
+	}()
+}
+
+// watchFollowedTrip suscribe el cliente al driver cuando el viaje se acepta y
+// lo quita de ambos tópicos cuando termina, para no seguir recibiendo la
+// ubicación del driver después del viaje. self es el driver del propio cliente
+// y followed el driver cuyas ubicaciones recibe ("" si ninguno). Si ctx se
+// cancela sale sin tocar las suscripciones y devuelve el driver que seguía.
+func (s *Server) watchFollowedTrip(ctx context.Context, client *realtime.Client, status *realtime.Listener, tripID, self, followed string) string {
+	defer status.Close()
+	tripTopic := realtime.TripTopic(tripID)
+
+	for {
+		select {
+		case <-client.Done():
+			return followed
+		case <-ctx.Done():
+			return followed
+		case raw := <-status.C():
+			var msg realtime.Message
+			var event struct {
+				Status   string `json:"status"`
+				DriverID string `json:"driver_id"`
+			}
+			if json.Unmarshal(raw, &msg) != nil || json.Unmarshal(msg.Data, &event) != nil {
+				continue
+			}
+			if !tripActive(event.Status) {
+				s.hub.Unsubscribe(client, tripTopic)
+				if followed != "" {
+					s.hub.Unsubscribe(client, realtime.DriverTopic(followed))
+				}
+				return ""
+			}
+			if event.DriverID != "" && event.DriverID != self && event.DriverID != followed {
+				if followed != "" {
+					s.hub.Unsubscribe(client, realtime.DriverTopic(followed))
+				}
+				followed = event.DriverID
+				s.hub.Subscribe(client, realtime.DriverTopic(followed))
+			}
+		}
+	}
+}
+
+// unfollowTrip detiene el seguimiento y quita el cliente del viaje y del
+// driver que lo atiende
+func (s *Server) unfollowTrip(client *realtime.Client, tripID string) {
+	key := tripWatchKey{client: client, tripID: tripID}
+	s.watchMu.Lock()
+	w := s.tripWatches[key]
+	delete(s.tripWatches, key)
+	s.watchMu.Unlock()
+	if w == nil {
+		return
+	}
+
+	// Esperar a la gorutina: así no puede tocar las suscripciones de un
+	// subscribe posterior
+	w.cancel()
+	<-w.done
+	s.hub.Unsubscribe(client, realtime.TripTopic(tripID))
+	if w.followed != "" {
+		s.hub.Unsubscribe(client, realtime.DriverTopic(w.followed))
+	}
+}
+
+// tripActive indica si el viaje tiene driver yendo a recoger o en ruta
+func tripActive(status string) bool {
+	return status == "accepted" || status == "started"
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/criston04/TaxyTac/backend/internal/realtime"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestWatchServer(t *testing.T) *Server {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &Server{
+		ctx:         ctx,
+		log:         log,
+		hub:         realtime.NewHub(nil, log),
+		tripWatches: make(map[tripWatchKey]*tripWatch),
+	}
+}
+
+// follow hace lo mismo que followTrip después de autorizar: suscribe el
+// cliente al viaje y al driver y arranca el seguimiento
+func follow(s *Server, client *realtime.Client, tripID, driverID string) *realtime.Listener {
+	status := s.hub.Listen(realtime.TripTopic(tripID))
+	s.hub.Subscribe(client, realtime.TripTopic(tripID))
+	if driverID != "" {
+		s.hub.Subscribe(client, realtime.DriverTopic(driverID))
+	}
+	s.startTripWatch(client, status, tripID, "", driverID)
+	return status
+}
+
+func sendTripStatus(t *testing.T, status *realtime.Listener, tripStatus, driverID string) {
+	t.Helper()
+	msg, err := realtime.Encode("trip_status", map[string]string{"status": tripStatus, "driver_id": driverID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Send(msg) {
+		t.Fatal("status listener is full")
+	}
+}
+
+func (s *Server) tripWatch(client *realtime.Client, tripID string) *tripWatch {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	return s.tripWatches[tripWatchKey{client: client, tripID: tripID}]
+}
+
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUnfollowStopsTheWatcher(t *testing.T) {
+	s := newTestWatchServer(t)
+	client := realtime.NewClient(nil, "rider-1", "rider", time.Time{})
+	tripTopic, d1, d2 := realtime.TripTopic("t1"), realtime.DriverTopic("d1"), realtime.DriverTopic("d2")
+
+	first := follow(s, client, "t1", "d1")
+	firstWatch := s.tripWatch(client, "t1")
+	s.unfollowTrip(client, "t1")
+
+	select {
+	case <-firstWatch.done:
+	default:
+		t.Fatal("unfollowTrip returned with the watcher still running")
+	}
+	if s.hub.Subscribed(client, tripTopic) || s.hub.Subscribed(client, d1) {
+		t.Fatal("client still subscribed after unsubscribe")
+	}
+	if s.tripWatch(client, "t1") != nil {
+		t.Fatal("watcher still registered after unsubscribe")
+	}
+
+	// Volver a suscribirse arranca un único seguimiento nuevo; el anterior
+	// ya no reacciona a lo que le llegue
+	second := follow(s, client, "t1", "d1")
+	sendTripStatus(t, first, "cancelled", "")
+	sendTripStatus(t, second, "accepted", "d2")
+	waitUntil(t, "the new watcher to follow d2", func() bool { return s.hub.Subscribed(client, d2) })
+	if s.hub.Subscribed(client, d1) {
+		t.Error("still following the previous driver")
+	}
+	if !s.hub.Subscribed(client, tripTopic) {
+		t.Error("the old watcher removed the new subscription")
+	}
+
+	// El driver que sigue el watcher se quita al desuscribirse, aunque haya
+	// cambiado después del subscribe
+	s.unfollowTrip(client, "t1")
+	if s.hub.Subscribed(client, tripTopic) || s.hub.Subscribed(client, d2) {
+		t.Error("client still subscribed after the second unsubscribe")
+	}
+
+	// Desuscribirse de algo que no sigue no hace nada
+	s.unfollowTrip(client, "t1")
+	s.unfollowTrip(client, "other")
+}
+
+func TestWatcherEndsWithTheTrip(t *testing.T) {
+	s := newTestWatchServer(t)
+	client := realtime.NewClient(nil, "rider-1", "rider", time.Time{})
+
+	status := follow(s, client, "t1", "d1")
+	watch := s.tripWatch(client, "t1")
+	sendTripStatus(t, status, "completed", "d1")
+
+	<-watch.done
+	if s.hub.Subscribed(client, realtime.TripTopic("t1")) || s.hub.Subscribed(client, realtime.DriverTopic("d1")) {
+		t.Error("client still subscribed after the trip ended")
+	}
+	if s.tripWatch(client, "t1") != nil {
+		t.Error("watcher still registered after the trip ended")
+	}
+}
+
+func TestFollowReplacesTheWatcher(t *testing.T) {
+	s := newTestWatchServer(t)
+	client := realtime.NewClient(nil, "rider-1", "rider", time.Time{})
+
+	follow(s, client, "t1", "")
+	first := s.tripWatch(client, "t1")
+	follow(s, client, "t1", "")
+	<-first.done
+
+	second := s.tripWatch(client, "t1")
+	if second == nil || second == first {
+		t.Fatal("the second watcher is not the registered one")
+	}
+	s.unfollowTrip(client, "t1")
+	<-second.done
+}
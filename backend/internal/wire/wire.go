@@ -0,0 +1,191 @@
+// Package wire define el protocolo binario compacto de /ws para ubicaciones y
+// sus ACK. Se negocia con el subprotocolo "taxytac.bin.v1"; sin él la conexión
+// sigue usando JSON. Cada frame binario empieza con un byte de tipo y los
+// enteros van en big endian.
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Subprotocol es el valor de Sec-WebSocket-Protocol que activa este formato
+const Subprotocol = "taxytac.bin.v1"
+
+// Tipos de frame
+const (
+	// FrameLocation: tipo + una ubicación (25 bytes)
+	FrameLocation byte = 0x01
+	// FrameHeartbeat: sólo el tipo; pide el ACK de lo pendiente
+	FrameHeartbeat byte = 0x02
+	// FrameBatch: tipo + uint16 cantidad + ubicaciones
+	FrameBatch byte = 0x03
+	// FrameAck: tipo + uint32 last_seq + uint16 received, rejected, duplicates (11 bytes)
+	FrameAck byte = 0x81
+)
+
+// LocationSize es lo que ocupa una ubicación sin el byte de tipo:
+//
+//	seq      uint32
+//	ts       int64   epoch en milisegundos
+//	lat      int32   grados × 1e7
+//	lng      int32   grados × 1e7
+//	speed    uint16  cm/s
+//	heading  uint16  centésimas de grado
+const LocationSize = 24
+
+const (
+	ackSize   = 11
+	coordUnit = 1e7
+)
+
+var (
+	ErrShortFrame   = errors.New("wire: frame too short")
+	ErrUnknownFrame = errors.New("wire: unknown frame type")
+)
+
+// Location es una ubicación decodificada
+type Location struct {
+	Seq     int64
+	TS      int64
+	Lat     float64
+	Lng     float64
+	Speed   float64 // m/s
+	Heading float64 // grados
+}
+
+// Frame es un mensaje binario del cliente ya decodificado
+type Frame struct {
+	Type      byte
+	Locations []Location
+}
+
+// Ack confirma lo recibido desde el ACK anterior
+type Ack struct {
+	LastSeq    int64
+	Received   uint16
+	Rejected   uint16
+	Duplicates uint16
+}
+
+// Decode lee un frame enviado por el cliente
+func Decode(data []byte) (Frame, error) {
+	if len(data) == 0 {
+		return Frame{}, ErrShortFrame
+	}
+
+	f := Frame{Type: data[0]}
+	body := data[1:]
+	switch f.Type {
+	case FrameHeartbeat:
+		return f, nil
+
+	case FrameLocation:
+		if len(body) < LocationSize {
+			return f, ErrShortFrame
+		}
+		f.Locations = []Location{decodeLocation(body)}
+		return f, nil
+
+	case FrameBatch:
+		if len(body) < 2 {
+			return f, ErrShortFrame
+		}
+		n := int(binary.BigEndian.Uint16(body))
+		body = body[2:]
+		if len(body) < n*LocationSize {
+			return f, ErrShortFrame
+		}
+		f.Locations = make([]Location, n)
+		for i := range f.Locations {
+			f.Locations[i] = decodeLocation(body[i*LocationSize:])
+		}
+		return f, nil
+	}
+	return f, ErrUnknownFrame
+}
+
+// EncodeLocation arma un FrameLocation
+func EncodeLocation(l Location) []byte {
+	buf := make([]byte, 1+LocationSize)
+	buf[0] = FrameLocation
+	encodeLocation(buf[1:], l)
+	return buf
+}
+
+// EncodeBatch arma un FrameBatch; como mucho 65535 ubicaciones
+func EncodeBatch(locs []Location) []byte {
+	if len(locs) > math.MaxUint16 {
+		locs = locs[:math.MaxUint16]
+	}
+	buf := make([]byte, 3+len(locs)*LocationSize)
+	buf[0] = FrameBatch
+	binary.BigEndian.PutUint16(buf[1:], uint16(len(locs)))
+	for i, l := range locs {
+		encodeLocation(buf[3+i*LocationSize:], l)
+	}
+	return buf
+}
+
+// EncodeAck arma un FrameAck
+func EncodeAck(a Ack) []byte {
+	buf := make([]byte, ackSize)
+	buf[0] = FrameAck
+	binary.BigEndian.PutUint32(buf[1:], uint32(a.LastSeq))
+	binary.BigEndian.PutUint16(buf[5:], a.Received)
+	binary.BigEndian.PutUint16(buf[7:], a.Rejected)
+	binary.BigEndian.PutUint16(buf[9:], a.Duplicates)
+	return buf
+}
+
+// DecodeAck lee un FrameAck (lado cliente)
+func DecodeAck(data []byte) (Ack, error) {
+	if len(data) < ackSize {
+		return Ack{}, ErrShortFrame
+	}
+	if data[0] != FrameAck {
+		return Ack{}, ErrUnknownFrame
+	}
+	return Ack{
+		LastSeq:    int64(binary.BigEndian.Uint32(data[1:])),
+		Received:   binary.BigEndian.Uint16(data[5:]),
+		Rejected:   binary.BigEndian.Uint16(data[7:]),
+		Duplicates: binary.BigEndian.Uint16(data[9:]),
+	}, nil
+}
+
+func decodeLocation(b []byte) Location {
+	return Location{
+		Seq:     int64(binary.BigEndian.Uint32(b[0:])),
+		TS:      int64(binary.BigEndian.Uint64(b[4:])),
+		Lat:     float64(int32(binary.BigEndian.Uint32(b[12:]))) / coordUnit,
+		Lng:     float64(int32(binary.BigEndian.Uint32(b[16:]))) / coordUnit,
+		Speed:   float64(binary.BigEndian.Uint16(b[20:])) / 100,
+		Heading: float64(binary.BigEndian.Uint16(b[22:])) / 100,
+	}
+}
+
+func encodeLocation(b []byte, l Location) {
+	binary.BigEndian.PutUint32(b[0:], uint32(l.Seq))
+	binary.BigEndian.PutUint64(b[4:], uint64(l.TS))
+	binary.BigEndian.PutUint32(b[12:], uint32(int32(math.Round(l.Lat*coordUnit))))
+	binary.BigEndian.PutUint32(b[16:], uint32(int32(math.Round(l.Lng*coordUnit))))
+	binary.BigEndian.PutUint16(b[20:], clampUint16(l.Speed*100))
+	heading := math.Mod(l.Heading, 360)
+	if heading < 0 {
+		heading += 360
+	}
+	binary.BigEndian.PutUint16(b[22:], clampUint16(heading*100))
+}
+
+func clampUint16(v float64) uint16 {
+	v = math.Round(v)
+	if v <= 0 || math.IsNaN(v) {
+		return 0
+	}
+	if v >= math.MaxUint16 {
+		return math.MaxUint16
+	}
+	return uint16(v)
+}
@@ -0,0 +1,195 @@
+package wire
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestLocationRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Location
+		want Location
+	}{
+		{
+			name: "lima",
+			in:   Location{Seq: 42, TS: 1699876543210, Lat: -12.0464, Lng: -77.0428, Speed: 15.5, Heading: 180},
+			want: Location{Seq: 42, TS: 1699876543210, Lat: -12.0464, Lng: -77.0428, Speed: 15.5, Heading: 180},
+		},
+		{
+			name: "coordinate precision",
+			in:   Location{Seq: 1, TS: 1, Lat: 12.34567891, Lng: -0.00000004},
+			want: Location{Seq: 1, TS: 1, Lat: 12.3456789, Lng: 0},
+		},
+		{
+			name: "extremes",
+			in:   Location{Seq: math.MaxUint32, TS: math.MaxInt64, Lat: -90, Lng: 180},
+			want: Location{Seq: math.MaxUint32, TS: math.MaxInt64, Lat: -90, Lng: 180},
+		},
+		{
+			name: "negative heading wraps",
+			in:   Location{Seq: 2, TS: 2, Heading: -90},
+			want: Location{Seq: 2, TS: 2, Heading: 270},
+		},
+		{
+			name: "heading over 360 wraps",
+			in:   Location{Seq: 3, TS: 3, Heading: 450.25},
+			want: Location{Seq: 3, TS: 3, Heading: 90.25},
+		},
+		{
+			name: "speed clamped",
+			in:   Location{Seq: 4, TS: 4, Speed: 1000},
+			want: Location{Seq: 4, TS: 4, Speed: 655.35},
+		},
+		{
+			name: "negative speed is zero",
+			in:   Location{Seq: 5, TS: 5, Speed: -3},
+			want: Location{Seq: 5, TS: 5, Speed: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := EncodeLocation(tt.in)
+			if len(data) != 1+LocationSize {
+				t.Fatalf("encoded size = %d, want %d", len(data), 1+LocationSize)
+			}
+			frame, err := Decode(data)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if frame.Type != FrameLocation || len(frame.Locations) != 1 {
+				t.Fatalf("frame = %+v, want one FrameLocation", frame)
+			}
+			assertLocation(t, frame.Locations[0], tt.want)
+		})
+	}
+}
+
+func TestBatchRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 3, 500} {
+		locs := make([]Location, n)
+		for i := range locs {
+			locs[i] = Location{
+				Seq:     int64(i + 1),
+				TS:      1699876543210 + int64(i)*1000,
+				Lat:     -12.0464 + float64(i)*1e-5,
+				Lng:     -77.0428 - float64(i)*1e-5,
+				Speed:   float64(i%20) / 2,
+				Heading: float64(i % 360),
+			}
+		}
+
+		data := EncodeBatch(locs)
+		if want := 3 + n*LocationSize; len(data) != want {
+			t.Fatalf("n=%d: encoded size = %d, want %d", n, len(data), want)
+		}
+		frame, err := Decode(data)
+		if err != nil {
+			t.Fatalf("n=%d: Decode: %v", n, err)
+		}
+		if frame.Type != FrameBatch || len(frame.Locations) != n {
+			t.Fatalf("n=%d: got type %#x with %d locations", n, frame.Type, len(frame.Locations))
+		}
+		for i := range locs {
+			assertLocation(t, frame.Locations[i], locs[i])
+		}
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	frame, err := Decode([]byte{FrameHeartbeat})
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if frame.Type != FrameHeartbeat || len(frame.Locations) != 0 {
+		t.Fatalf("frame = %+v, want empty heartbeat", frame)
+	}
+}
+
+func TestAckRoundTrip(t *testing.T) {
+	tests := []Ack{
+		{},
+		{LastSeq: 42, Received: 10, Rejected: 1, Duplicates: 2},
+		{LastSeq: math.MaxUint32, Received: math.MaxUint16, Rejected: math.MaxUint16, Duplicates: math.MaxUint16},
+	}
+	for _, want := range tests {
+		data := EncodeAck(want)
+		if len(data) != ackSize {
+			t.Fatalf("encoded size = %d, want %d", len(data), ackSize)
+		}
+		got, err := DecodeAck(data)
+		if err != nil {
+			t.Fatalf("DecodeAck: %v", err)
+		}
+		if got != want {
+			t.Errorf("DecodeAck = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	location := EncodeLocation(Location{Seq: 1, TS: 1})
+	batch := EncodeBatch([]Location{{Seq: 1, TS: 1}, {Seq: 2, TS: 2}})
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrShortFrame},
+		{"location type only", []byte{FrameLocation}, ErrShortFrame},
+		{"truncated location", location[:len(location)-1], ErrShortFrame},
+		{"batch type only", []byte{FrameBatch}, ErrShortFrame},
+		{"batch half count", []byte{FrameBatch, 0}, ErrShortFrame},
+		{"batch missing points", batch[:3+LocationSize], ErrShortFrame},
+		{"batch truncated point", batch[:len(batch)-1], ErrShortFrame},
+		{"ack sent by client", EncodeAck(Ack{LastSeq: 1}), ErrUnknownFrame},
+		{"unknown type", []byte{0x7f, 1, 2, 3}, ErrUnknownFrame},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("Decode error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeAckErrors(t *testing.T) {
+	ack := EncodeAck(Ack{LastSeq: 7, Received: 1})
+
+	if _, err := DecodeAck(ack[:ackSize-1]); !errors.Is(err, ErrShortFrame) {
+		t.Errorf("truncated ack: error = %v, want %v", err, ErrShortFrame)
+	}
+	if _, err := DecodeAck(nil); !errors.Is(err, ErrShortFrame) {
+		t.Errorf("empty ack: error = %v, want %v", err, ErrShortFrame)
+	}
+
+	wrongType := append([]byte(nil), ack...)
+	wrongType[0] = FrameLocation
+	if _, err := DecodeAck(wrongType); !errors.Is(err, ErrUnknownFrame) {
+		t.Errorf("wrong type: error = %v, want %v", err, ErrUnknownFrame)
+	}
+}
+
+func TestDecodeIgnoresTrailingBytes(t *testing.T) {
+	data := append(EncodeLocation(Location{Seq: 9, TS: 9, Lat: 1, Lng: 2}), 0xff, 0xff)
+	frame, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	assertLocation(t, frame.Locations[0], Location{Seq: 9, TS: 9, Lat: 1, Lng: 2})
+}
+
+// assertLocation compara con la precisión del formato: 1e-7 grados en
+// coordenadas y centésimas en velocidad y rumbo
+func assertLocation(t *testing.T, got, want Location) {
+	t.Helper()
+	if got.Seq != want.Seq || got.TS != want.TS ||
+		math.Abs(got.Lat-want.Lat) > 1e-9 || math.Abs(got.Lng-want.Lng) > 1e-9 ||
+		math.Abs(got.Speed-want.Speed) > 1e-9 || math.Abs(got.Heading-want.Heading) > 1e-9 {
+		t.Errorf("location = %+v, want %+v", got, want)
+	}
+}
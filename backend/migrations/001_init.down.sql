@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS trips;
+DROP TABLE IF EXISTS locations;
+DROP TABLE IF EXISTS vehicles;
+DROP TABLE IF EXISTS drivers;
+DROP TABLE IF EXISTS users;
+DROP FUNCTION IF EXISTS update_updated_at_column();
@@ -15,8 +15,8 @@ CREATE TABLE IF NOT EXISTS users (
     updated_at TIMESTAMPTZ DEFAULT now()
 );
 
-CREATE INDEX idx_users_phone ON users(phone);
-CREATE INDEX idx_users_role ON users(role);
+CREATE INDEX IF NOT EXISTS idx_users_phone ON users(phone);
+CREATE INDEX IF NOT EXISTS idx_users_role ON users(role);
 
 -- Drivers table
 CREATE TABLE IF NOT EXISTS drivers (
@@ -29,8 +29,8 @@ CREATE TABLE IF NOT EXISTS drivers (
     updated_at TIMESTAMPTZ DEFAULT now()
 );
 
-CREATE INDEX idx_drivers_user_id ON drivers(user_id);
-CREATE INDEX idx_drivers_status ON drivers(status) WHERE status = 'available';
+CREATE INDEX IF NOT EXISTS idx_drivers_user_id ON drivers(user_id);
+CREATE INDEX IF NOT EXISTS idx_drivers_status ON drivers(status) WHERE status = 'available';
 
 -- Vehicles table
 CREATE TABLE IF NOT EXISTS vehicles (
@@ -46,8 +46,8 @@ CREATE TABLE IF NOT EXISTS vehicles (
     updated_at TIMESTAMPTZ DEFAULT now()
 );
 
-CREATE INDEX idx_vehicles_driver_id ON vehicles(driver_id);
-CREATE INDEX idx_vehicles_plate ON vehicles(plate);
+CREATE INDEX IF NOT EXISTS idx_vehicles_driver_id ON vehicles(driver_id);
+CREATE INDEX IF NOT EXISTS idx_vehicles_plate ON vehicles(plate);
 
 -- Locations table (snapshot de ubicaciones)
 CREATE TABLE IF NOT EXISTS locations (
@@ -61,8 +61,8 @@ CREATE TABLE IF NOT EXISTS locations (
 );
 
 -- Índice geoespacial GiST para consultas de proximidad
-CREATE INDEX idx_locations_geom ON locations USING GIST (geom);
-CREATE INDEX idx_locations_driver_ts ON locations(driver_id, ts DESC);
+CREATE INDEX IF NOT EXISTS idx_locations_geom ON locations USING GIST (geom);
+CREATE INDEX IF NOT EXISTS idx_locations_driver_ts ON locations(driver_id, ts DESC);
 
 -- Trips table
 CREATE TABLE IF NOT EXISTS trips (
@@ -83,9 +83,9 @@ CREATE TABLE IF NOT EXISTS trips (
     updated_at TIMESTAMPTZ DEFAULT now()
 );
 
-CREATE INDEX idx_trips_rider_id ON trips(rider_id, created_at DESC);
-CREATE INDEX idx_trips_driver_id ON trips(driver_id, created_at DESC);
-CREATE INDEX idx_trips_status ON trips(status);
+CREATE INDEX IF NOT EXISTS idx_trips_rider_id ON trips(rider_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_trips_driver_id ON trips(driver_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_trips_status ON trips(status);
 
 -- Payments table
 CREATE TABLE IF NOT EXISTS payments (
@@ -102,8 +102,8 @@ CREATE TABLE IF NOT EXISTS payments (
     updated_at TIMESTAMPTZ DEFAULT now()
 );
 
-CREATE INDEX idx_payments_trip_id ON payments(trip_id);
-CREATE INDEX idx_payments_status ON payments(status);
+CREATE INDEX IF NOT EXISTS idx_payments_trip_id ON payments(trip_id);
+CREATE INDEX IF NOT EXISTS idx_payments_status ON payments(status);
 
 -- Audits/Events table (opcional, para event sourcing)
 CREATE TABLE IF NOT EXISTS events (
@@ -115,7 +115,7 @@ CREATE TABLE IF NOT EXISTS events (
     created_at TIMESTAMPTZ DEFAULT now()
 );
 
-CREATE INDEX idx_events_entity ON events(entity_type, entity_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_events_entity ON events(entity_type, entity_id, created_at DESC);
 
 -- Function to update updated_at timestamp
 CREATE OR REPLACE FUNCTION update_updated_at_column()
@@ -127,19 +127,19 @@ END;
 $$ LANGUAGE plpgsql;
 
 -- Triggers para actualizar updated_at
-CREATE TRIGGER update_users_updated_at BEFORE UPDATE ON users
+CREATE OR REPLACE TRIGGER update_users_updated_at BEFORE UPDATE ON users
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
-CREATE TRIGGER update_drivers_updated_at BEFORE UPDATE ON drivers
+CREATE OR REPLACE TRIGGER update_drivers_updated_at BEFORE UPDATE ON drivers
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
-CREATE TRIGGER update_vehicles_updated_at BEFORE UPDATE ON vehicles
+CREATE OR REPLACE TRIGGER update_vehicles_updated_at BEFORE UPDATE ON vehicles
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
-CREATE TRIGGER update_trips_updated_at BEFORE UPDATE ON trips
+CREATE OR REPLACE TRIGGER update_trips_updated_at BEFORE UPDATE ON trips
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
-CREATE TRIGGER update_payments_updated_at BEFORE UPDATE ON payments
+CREATE OR REPLACE TRIGGER update_payments_updated_at BEFORE UPDATE ON payments
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
 -- Insertar datos de prueba (opcional, comentar en producción)
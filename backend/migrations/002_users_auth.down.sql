@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_users_email;
+
+UPDATE users SET role = 'rider' WHERE role IN ('passenger', 'admin');
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check
+    CHECK (role IN ('rider', 'driver'));
+
+ALTER TABLE users DROP COLUMN IF EXISTS password_hash;
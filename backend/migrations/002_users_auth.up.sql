@@ -0,0 +1,8 @@
+-- Columnas y roles que usan Register/Login
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check
+    CHECK (role IN ('rider', 'passenger', 'driver', 'admin'));
+
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
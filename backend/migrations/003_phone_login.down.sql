@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS phone_verified_at;
+
+UPDATE users SET phone = 'sin-telefono-' || id WHERE phone IS NULL;
+ALTER TABLE users ALTER COLUMN phone SET NOT NULL;
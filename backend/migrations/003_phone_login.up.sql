@@ -0,0 +1,5 @@
+-- El teléfono pasa a ser opcional (login por email) y se registra su verificación
+ALTER TABLE users ALTER COLUMN phone DROP NOT NULL;
+UPDATE users SET phone = NULL WHERE phone = '000000000';
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMPTZ;
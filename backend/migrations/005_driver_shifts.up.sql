@@ -0,0 +1,12 @@
+-- Cada periodo en que un driver está en línea (available/busy)
+CREATE TABLE IF NOT EXISTS driver_shifts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    driver_id UUID NOT NULL REFERENCES drivers(id) ON DELETE CASCADE,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ended_at TIMESTAMPTZ,
+    CHECK (ended_at IS NULL OR ended_at >= started_at)
+);
+
+-- Sólo un turno abierto por driver
+CREATE UNIQUE INDEX IF NOT EXISTS idx_driver_shifts_open ON driver_shifts(driver_id) WHERE ended_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_driver_shifts_driver ON driver_shifts(driver_id, started_at DESC);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_vehicles_one_active;
+ALTER TABLE vehicles DROP COLUMN IF EXISTS is_active;
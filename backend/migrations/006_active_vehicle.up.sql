@@ -0,0 +1,13 @@
+-- Un driver puede registrar varios vehículos pero trabaja con uno a la vez
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS is_active BOOLEAN NOT NULL DEFAULT false;
+
+-- Activar el vehículo más reciente de cada driver existente
+UPDATE vehicles v SET is_active = true
+WHERE v.id = (
+    SELECT id FROM vehicles
+    WHERE driver_id = v.driver_id
+    ORDER BY created_at DESC
+    LIMIT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_vehicles_one_active ON vehicles(driver_id) WHERE is_active;
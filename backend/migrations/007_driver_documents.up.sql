@@ -0,0 +1,26 @@
+-- Documentos que un driver debe tener aprobados para trabajar
+CREATE TABLE IF NOT EXISTS driver_documents (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    driver_id UUID NOT NULL REFERENCES drivers(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('license', 'soat', 'vehicle_registration')),
+    number TEXT,
+    file_url TEXT NOT NULL,
+    file_name TEXT,
+    content_type TEXT,
+    size_bytes BIGINT,
+    expires_at DATE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (
+        status IN ('pending', 'approved', 'rejected', 'expired')
+    ),
+    rejection_reason TEXT,
+    reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_driver_documents_driver ON driver_documents(driver_id, type, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_driver_documents_pending ON driver_documents(created_at) WHERE status = 'pending';
+
+CREATE TRIGGER update_driver_documents_updated_at BEFORE UPDATE ON driver_documents
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_locations_driver_seq;
+ALTER TABLE locations DROP COLUMN IF EXISTS seq;
@@ -0,0 +1,6 @@
+-- Número de secuencia del dispositivo para descartar reenvíos de ubicaciones.
+-- Un reenvío repite seq y ts; incluir ts permite que el contador del teléfono
+-- vuelva a empezar (reinstalación) sin chocar con puntos antiguos.
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS seq BIGINT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_locations_driver_seq ON locations(driver_id, seq, ts) WHERE seq IS NOT NULL;
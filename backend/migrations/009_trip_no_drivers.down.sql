@@ -0,0 +1,6 @@
+UPDATE trips SET status = 'cancelled' WHERE status = 'no_drivers';
+
+ALTER TABLE trips DROP CONSTRAINT IF EXISTS trips_status_check;
+ALTER TABLE trips ADD CONSTRAINT trips_status_check CHECK (
+    status IN ('requested', 'accepted', 'started', 'completed', 'cancelled')
+);
@@ -0,0 +1,5 @@
+-- no_drivers: el dispatcher ofreció el viaje y ningún driver lo aceptó
+ALTER TABLE trips DROP CONSTRAINT IF EXISTS trips_status_check;
+ALTER TABLE trips ADD CONSTRAINT trips_status_check CHECK (
+    status IN ('requested', 'accepted', 'started', 'completed', 'cancelled', 'no_drivers')
+);
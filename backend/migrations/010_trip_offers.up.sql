@@ -0,0 +1,17 @@
+-- Cada oferta del dispatcher y cómo terminó; de aquí salen las tasas de
+-- aceptación de los drivers
+CREATE TABLE IF NOT EXISTS trip_offers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    trip_id UUID NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    driver_id UUID NOT NULL REFERENCES drivers(id) ON DELETE CASCADE,
+    distance_m NUMERIC,
+    outcome TEXT NOT NULL DEFAULT 'pending' CHECK (
+        outcome IN ('pending', 'accepted', 'declined', 'expired', 'withdrawn')
+    ),
+    offered_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    responded_at TIMESTAMPTZ,
+    UNIQUE (trip_id, driver_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_trip_offers_driver ON trip_offers(driver_id, offered_at DESC);
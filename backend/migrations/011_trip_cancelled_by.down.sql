@@ -0,0 +1,2 @@
+ALTER TABLE trips DROP CONSTRAINT IF EXISTS trips_cancelled_by_check;
+ALTER TABLE trips DROP COLUMN IF EXISTS cancelled_by;
@@ -0,0 +1,8 @@
+-- Quién canceló el viaje; la tasa de cancelación de un driver sólo cuenta las
+-- que hizo él. Los viajes cancelados antes de esta columna quedan en NULL.
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS cancelled_by TEXT;
+
+ALTER TABLE trips DROP CONSTRAINT IF EXISTS trips_cancelled_by_check;
+ALTER TABLE trips ADD CONSTRAINT trips_cancelled_by_check CHECK (
+    cancelled_by IN ('rider', 'driver', 'admin')
+);
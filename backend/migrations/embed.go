@@ -0,0 +1,10 @@
+// Package migrations embebe los archivos SQL versionados del esquema para que
+// el binario del backend pueda aplicarlos (ver internal/migrate).
+package migrations
+
+import "embed"
+
+// FS contiene los archivos NNN_nombre.up.sql / NNN_nombre.down.sql
+//
+//go:embed *.sql
+var FS embed.FS
@@ -47,13 +47,13 @@ BEGIN
   SELECT id INTO driver_id_5 FROM drivers WHERE user_id = user_id_5;
 
   -- Insertar vehículos
-  INSERT INTO vehicles (driver_id, make, model, plate, year, color)
+  INSERT INTO vehicles (driver_id, make, model, plate, year, color, is_active)
   VALUES 
-    (driver_id_1, 'Bajaj', 'RE', 'ABC-123', 2023, 'Amarillo'),
-    (driver_id_2, 'Bajaj', 'Maxima', 'DEF-456', 2022, 'Rojo'),
-    (driver_id_3, 'Bajaj', 'RE Compact', 'GHI-789', 2023, 'Verde'),
-    (driver_id_4, 'Bajaj', 'RE', 'JKL-012', 2021, 'Azul'),
-    (driver_id_5, 'Bajaj', 'Maxima', 'MNO-345', 2023, 'Naranja')
+    (driver_id_1, 'Bajaj', 'RE', 'ABC-123', 2023, 'Amarillo', true),
+    (driver_id_2, 'Bajaj', 'Maxima', 'DEF-456', 2022, 'Rojo', true),
+    (driver_id_3, 'Bajaj', 'RE Compact', 'GHI-789', 2023, 'Verde', true),
+    (driver_id_4, 'Bajaj', 'RE', 'JKL-012', 2021, 'Azul', true),
+    (driver_id_5, 'Bajaj', 'Maxima', 'MNO-345', 2023, 'Naranja', true)
   ON CONFLICT (plate) DO NOTHING;
 
   -- Insertar ubicaciones en diferentes puntos de Lima
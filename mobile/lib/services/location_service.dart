@@ -2,6 +2,7 @@ import 'dart:async';
 import 'dart:convert';
 import 'package:web_socket_channel/web_socket_channel.dart';
 import 'package:latlong2/latlong.dart';
+import 'auth_service.dart';
 
 class LocationService {
   static const String wsUrl = 'ws://localhost:8080/ws';
@@ -12,6 +13,8 @@ class LocationService {
   
   bool _isConnected = false;
   String? _driverId;
+  // Contador de ubicaciones enviadas; el backend lo usa para descartar reenvíos
+  int _seq = 0;
 
   // Stream de actualizaciones de ubicación
   Stream<Map<String, dynamic>>? get locationUpdates =>
@@ -25,7 +28,12 @@ class LocationService {
 
     try {
       _driverId = driverId;
-      _channel = WebSocketChannel.connect(Uri.parse(wsUrl));
+      // El backend identifica al driver por el access token
+      final token = AuthService.token;
+      final uri = Uri.parse(wsUrl).replace(
+        queryParameters: {if (token != null) 'token': token},
+      );
+      _channel = WebSocketChannel.connect(uri);
       _locationUpdates = StreamController<Map<String, dynamic>>.broadcast();
 
       _isConnected = true;
@@ -79,7 +87,8 @@ class LocationService {
       'lng': position.longitude,
       'speed': speed,
       'heading': heading,
-      'timestamp': DateTime.now().millisecondsSinceEpoch,
+      'ts': DateTime.now().millisecondsSinceEpoch,
+      'seq': ++_seq,
     };
 
     try {
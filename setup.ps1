@@ -53,7 +53,7 @@ Write-Host "✓ Servicios listos" -ForegroundColor Green
 # Ejecutar migraciones
 Write-Host "[6/6] Ejecutando migraciones de base de datos..." -ForegroundColor Yellow
 try {
-    Get-Content "backend\migrations\001_init.sql" | docker exec -i taxytac-db psql -U postgres -d taxytac
+    docker-compose exec -T backend /taxytac migrate up
     Write-Host "✓ Migraciones ejecutadas correctamente" -ForegroundColor Green
 } catch {
     Write-Host "⚠ Error al ejecutar migraciones (puede que ya existan)" -ForegroundColor Yellow